@@ -1,5 +1,26 @@
 package appconfig
 
+import "path/filepath"
+
+// ConfigFile is loaded by config.NewConfigMinimal, relative to working directory
+const ConfigFile = "config.yaml"
+
+// ResolvePath makes path relative to the config file directory absolute,
+// so files next to config are found regardless of working directory changes
+func ResolvePath(path string) (string, error) {
+	if filepath.IsAbs(path) {
+		return path, nil
+	}
+
+	configFile, err := filepath.Abs(ConfigFile)
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(filepath.Dir(configFile), path), nil
+}
+
 type TLSConfig struct {
 	Enabled  bool   `yaml:"enabled" json:"enabled"`
 	CertFile string `yaml:"certFile" json:"certFile"`
@@ -12,12 +33,150 @@ type AuthConfig struct {
 	Password string `yaml:"password" json:"password"`
 }
 
+type VirtualPrinterConfig struct {
+	Name      string `yaml:"name" json:"name"`
+	Directory string `yaml:"directory" json:"directory"`
+}
+
+// ZplFallbackConfig makes regular printer accept ZPL labels, they are rendered to PDF at given resolution
+type ZplFallbackConfig struct {
+	Printer string `yaml:"printer" json:"printer"`
+	// 0 means default, 203
+	Dpi int `yaml:"dpi" json:"dpi"`
+	// Label size in inches, 0 means default, 4x6. ZPL commands ^PW and ^LL override it
+	LabelWidth  float64 `yaml:"labelWidth" json:"labelWidth"`
+	LabelHeight float64 `yaml:"labelHeight" json:"labelHeight"`
+}
+
+type BackendConfig struct {
+	// "system" uses OS commands (lp/lpstat or wmic/SumatraPDF), "ipp" talks to CUPS server directly,
+	// "virtual" provides only virtual printers
+	Type         string `yaml:"type" json:"type"`
+	CupsUri      string `yaml:"cupsUri" json:"cupsUri"`
+	CupsUsername string `yaml:"cupsUsername" json:"cupsUsername"`
+	CupsPassword string `yaml:"cupsPassword" json:"cupsPassword"`
+	// Virtual printers save documents to directories, they are available with any backend type
+	VirtualPrinters []VirtualPrinterConfig `yaml:"virtualPrinters" json:"virtualPrinters"`
+	// Raw ZPL sent to these printers is printed as PDF
+	ZplFallbacks []ZplFallbackConfig `yaml:"zplFallbacks" json:"zplFallbacks"`
+}
+
+type JobsConfig struct {
+	// Number of jobs processed simultaneously, 0 means default
+	Workers int `yaml:"workers" json:"workers"`
+	// Max number of jobs waiting in the queue, 0 means default
+	QueueSize int `yaml:"queueSize" json:"queueSize"`
+	// Job history database file, relative to config file directory
+	HistoryFile string `yaml:"historyFile" json:"historyFile"`
+	// Finished jobs are removed from history after that many days, 0 means never
+	RetentionDays int `yaml:"retentionDays" json:"retentionDays"`
+	// Printed documents are kept for retry that many hours, 0 means as long as their jobs
+	DocumentRetentionHours int `yaml:"documentRetentionHours" json:"documentRetentionHours"`
+	// Max size of documents received on raw ports and LPD and of HTTP request bodies, 0 means default
+	MaxDocumentSizeMB int `yaml:"maxDocumentSizeMB" json:"maxDocumentSizeMB"`
+}
+
+type IPPServerConfig struct {
+	// Serves printers over IPP, so they can be added as IPP Everywhere printers
+	Enabled bool   `yaml:"enabled" json:"enabled"`
+	Port    uint16 `yaml:"port" json:"port"`
+	// Announce printers in local network using DNS-SD (Bonjour)
+	Advertise bool `yaml:"advertise" json:"advertise"`
+}
+
+type LPDServerConfig struct {
+	// Accepts jobs from LPR clients, LPD queue names are printer names
+	Enabled bool   `yaml:"enabled" json:"enabled"`
+	Port    uint16 `yaml:"port" json:"port"`
+}
+
+// RawPortConfig maps TCP port to printer, like JetDirect port 9100 of network printers
+type RawPortConfig struct {
+	Port    uint16 `yaml:"port" json:"port"`
+	Printer string `yaml:"printer" json:"printer"`
+}
+
+type OfficeConfig struct {
+	// LibreOffice executable, converts office documents to PDF
+	Command string `yaml:"command" json:"command"`
+	// 0 means default
+	TimeoutSeconds int `yaml:"timeoutSeconds" json:"timeoutSeconds"`
+	// Max number of documents converted simultaneously, 0 means default
+	MaxConcurrent int `yaml:"maxConcurrent" json:"maxConcurrent"`
+}
+
+type BrowserConfig struct {
+	// Max number of pages rendered simultaneously, other renders wait for a free page. 0 means default
+	MaxPages int `yaml:"maxPages" json:"maxPages"`
+}
+
+// HeaderFooterConfig is a named pair of header and footer templates for pages converted to PDF in browser,
+// see headerTemplate in https://chromedevtools.github.io/devtools-protocol/tot/Page/#method-printToPDF
+type HeaderFooterConfig struct {
+	Name   string `yaml:"name" json:"name"`
+	Header string `yaml:"header" json:"header"`
+	Footer string `yaml:"footer" json:"footer"`
+}
+
+// UrlCredentialsConfig is sent with requests made when printing from URL, so secrets don't have to be passed in
+// print requests. Credentials are sent only to their hosts, "*.example.com" matches subdomains of example.com.
+// Credentials without name are used automatically, named ones only if selected in print request
+type UrlCredentialsConfig struct {
+	Name    string            `yaml:"name" json:"name"`
+	Hosts   []string          `yaml:"hosts" json:"hosts"`
+	Headers map[string]string `yaml:"headers" json:"headers"`
+	Cookies map[string]string `yaml:"cookies" json:"cookies"`
+	// Basic authentication
+	Username    string `yaml:"username" json:"username"`
+	Password    string `yaml:"password" json:"password"`
+	BearerToken string `yaml:"bearerToken" json:"bearerToken"`
+}
+
+// UrlPolicyConfig restricts URLs fetched when printing, including redirects and resources loaded by pages.
+// Hosts resolving to loopback, private, link-local and other non-public addresses are not allowed
+type UrlPolicyConfig struct {
+	// Empty means http and https
+	AllowedSchemes []string `yaml:"allowedSchemes" json:"allowedSchemes"`
+	// If not empty, other hosts are not allowed. "*.example.com" matches subdomains of example.com
+	AllowedHosts []string `yaml:"allowedHosts" json:"allowedHosts"`
+	DeniedHosts  []string `yaml:"deniedHosts" json:"deniedHosts"`
+	// Non-public addresses in these networks are allowed, e.g. 10.1.0.0/16 for intranet
+	AllowedNetworks []string `yaml:"allowedNetworks" json:"allowedNetworks"`
+	// 0 means default
+	MaxRedirects int `yaml:"maxRedirects" json:"maxRedirects"`
+}
+
+type TemplatesConfig struct {
+	// Directory with a subdirectory for each template, relative to config file directory
+	Directory string `yaml:"directory" json:"directory"`
+}
+
+// FontConfig makes TrueType font available by name for documents generated by print server
+type FontConfig struct {
+	Name string `yaml:"name" json:"name"`
+	File string `yaml:"file" json:"file"`
+}
+
 type AppConfig struct {
 	Host            string            `yaml:"host" json:"host"`
 	Port            uint16            `yaml:"port" json:"port"`
 	ResponseHeaders map[string]string `yaml:"responseHeaders" json:"responseHeaders"`
 	TLS             TLSConfig         `yaml:"tls" json:"tls"`
 	Auth            AuthConfig        `yaml:"auth" json:"auth"`
+	Jobs            JobsConfig        `yaml:"jobs" json:"jobs"`
+	Backend         BackendConfig     `yaml:"backend" json:"backend"`
+	IPPServer       IPPServerConfig   `yaml:"ippServer" json:"ippServer"`
+	RawPorts        []RawPortConfig   `yaml:"rawPorts" json:"rawPorts"`
+	LPDServer       LPDServerConfig   `yaml:"lpdServer" json:"lpdServer"`
+	Fonts           []FontConfig      `yaml:"fonts" json:"fonts"`
+	Office          OfficeConfig      `yaml:"office" json:"office"`
+	RawPrinters     []string          `yaml:"rawPrinters" json:"rawPrinters"`
+	Templates       TemplatesConfig   `yaml:"templates" json:"templates"`
+	Browser         BrowserConfig     `yaml:"browser" json:"browser"`
+	// Presets are selected by header-footer param, in addition to built-in page-numbers and report presets
+	HeaderFooterPresets []HeaderFooterConfig   `yaml:"headerFooterPresets" json:"headerFooterPresets"`
+	UrlCredentials      []UrlCredentialsConfig `yaml:"urlCredentials" json:"urlCredentials"`
+	UrlPolicy           UrlPolicyConfig        `yaml:"urlPolicy" json:"urlPolicy"`
 }
 
 func NewDefaultConfig() AppConfig {
@@ -25,5 +184,45 @@ func NewDefaultConfig() AppConfig {
 		Host:            "0.0.0.0",
 		Port:            8888,
 		ResponseHeaders: map[string]string{},
+		Jobs: JobsConfig{
+			HistoryFile:            "jobs.db",
+			RetentionDays:          30,
+			DocumentRetentionHours: 24,
+			MaxDocumentSizeMB:      100,
+		},
+		Backend: BackendConfig{
+			Type:    "system",
+			CupsUri: "ipp://localhost:631",
+		},
+		IPPServer: IPPServerConfig{
+			Port:      8631,
+			Advertise: true,
+		},
+		RawPorts: []RawPortConfig{},
+		LPDServer: LPDServerConfig{
+			Port: 515,
+		},
+		Fonts: []FontConfig{},
+		Office: OfficeConfig{
+			Command:        "soffice",
+			TimeoutSeconds: 120,
+			MaxConcurrent:  2,
+		},
+		RawPrinters: []string{},
+		Templates: TemplatesConfig{
+			Directory: "templates",
+		},
+		Browser: BrowserConfig{
+			MaxPages: 2,
+		},
+		HeaderFooterPresets: []HeaderFooterConfig{},
+		UrlCredentials:      []UrlCredentialsConfig{},
+		UrlPolicy: UrlPolicyConfig{
+			AllowedSchemes:  []string{"http", "https"},
+			AllowedHosts:    []string{},
+			DeniedHosts:     []string{},
+			AllowedNetworks: []string{},
+			MaxRedirects:    10,
+		},
 	}
 }
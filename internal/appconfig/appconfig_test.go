@@ -0,0 +1,30 @@
+package appconfig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolvePath(t *testing.T) {
+	wd, err := os.Getwd()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ResolvePath("jobs.db")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(wd, "jobs.db"); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	abs := filepath.Join(t.TempDir(), "jobs.db")
+
+	if got, _ := ResolvePath(abs); got != abs {
+		t.Errorf("absolute path is changed to %s", got)
+	}
+}
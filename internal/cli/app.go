@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/downace/go-config"
 	"github.com/downace/print-server/internal/appconfig"
+	"github.com/downace/print-server/internal/printing"
 	"github.com/downace/print-server/internal/server"
 	"github.com/samber/lo"
 	"github.com/ttacon/chalk"
@@ -59,7 +60,25 @@ func RunApp() error {
 		chalk.Reset,
 	)
 
-	serv := server.CreateServer(conf.Data)
+	backend, err := printing.NewBackend(conf.Data.Backend)
+
+	if err != nil {
+		return err
+	}
+
+	// Closed after the queue, which waits for queued jobs
+	renderers := server.NewRenderers(conf.Data)
+	defer renderers.Close()
+
+	jobs, err := server.OpenJobQueue(conf.Data, backend)
+
+	if err != nil {
+		return err
+	}
+
+	defer jobs.Close()
+
+	serv := server.CreateServer(conf.Data, backend, jobs, renderers)
 
 	var proto string
 	if conf.Data.TLS.Enabled {
@@ -70,6 +89,15 @@ func RunApp() error {
 
 	fmt.Println()
 	fmt.Println(chalk.Green.Color(fmt.Sprintf("Running server on %s://%s:%d", proto, conf.Data.Host, conf.Data.Port)))
+	if conf.Data.IPPServer.Enabled {
+		fmt.Println(chalk.Green.Color(fmt.Sprintf("Serving IPP printers on %s:%d", conf.Data.Host, conf.Data.IPPServer.Port)))
+	}
+	for _, rawPort := range conf.Data.RawPorts {
+		fmt.Println(chalk.Green.Color(fmt.Sprintf("Printing raw data from %s:%d to %s", conf.Data.Host, rawPort.Port, rawPort.Printer)))
+	}
+	if conf.Data.LPDServer.Enabled {
+		fmt.Println(chalk.Green.Color(fmt.Sprintf("Serving LPD queues on %s:%d", conf.Data.Host, conf.Data.LPDServer.Port)))
+	}
 
 	err = server.RunServer(serv, conf.Data)
 
@@ -12,6 +12,7 @@ import (
 	"github.com/downace/print-server/internal/common"
 	"github.com/downace/print-server/internal/guiapp"
 	"github.com/downace/print-server/internal/logging"
+	"github.com/downace/print-server/internal/printing"
 	"github.com/downace/print-server/internal/server"
 	"github.com/samber/lo"
 	"github.com/wailsapp/wails/v2"
@@ -41,7 +42,10 @@ type App struct {
 
 	config        *config.Config[appconfig.AppConfig]
 	trayMenuItems AppTrayMenuItems
-	httpServer    *http.Server
+	httpServer    *server.Server
+	backend       printing.Backend
+	jobs          *printing.JobQueue
+	renderers     *server.Renderers
 }
 
 func RunApp(appName string, assets embed.FS) error {
@@ -81,6 +85,37 @@ func (a *App) startup(ctx context.Context) {
 	a.baseApp.Startup(ctx)
 
 	lo.Must0(a.config.Load())
+	a.renderers = server.NewRenderers(a.config.Data)
+	// Error is shown when server is started, e.g. history file may be locked by another running app
+	if err := a.openJobs(); err != nil {
+		log.Printf("error opening job queue: %s", err)
+	}
+}
+
+// openJobs creates printing backend and opens job queue if they are not open yet
+func (a *App) openJobs() error {
+	if a.jobs != nil {
+		return nil
+	}
+
+	if a.backend == nil {
+		backend, err := printing.NewBackend(a.config.Data.Backend)
+
+		if err != nil {
+			return fmt.Errorf("can't create printing backend: %w", err)
+		}
+
+		a.backend = backend
+	}
+
+	jobs, err := server.OpenJobQueue(a.config.Data, a.backend)
+
+	if err != nil {
+		return fmt.Errorf("can't open job history: %w", err)
+	}
+
+	a.jobs = jobs
+	return nil
 }
 
 func (a *App) beforeClose(ctx context.Context) (prevent bool) {
@@ -128,6 +163,13 @@ func (a *App) shutdown(ctx context.Context) {
 	if a.httpServer != nil {
 		_ = a.httpServer.Shutdown(ctx)
 	}
+	if a.jobs != nil {
+		_ = a.jobs.Close()
+	}
+	// Queued jobs are processed by now, so renderers are not used anymore
+	if a.renderers != nil {
+		_ = a.renderers.Close()
+	}
 	a.baseApp.Shutdown(ctx)
 }
 
@@ -330,7 +372,13 @@ func (a *App) StartServer() {
 	if a.httpServer != nil {
 		_ = a.httpServer.Close()
 	}
-	a.httpServer = server.CreateServer(a.config.Data)
+
+	if err := a.openJobs(); err != nil {
+		a.handleStatusChange(ServerStatus{Running: false, Error: err.Error()})
+		return
+	}
+
+	a.httpServer = server.CreateServer(a.config.Data, a.backend, a.jobs, a.renderers)
 
 	go func() {
 		err := server.RunServer(a.httpServer, a.config.Data)
@@ -0,0 +1,139 @@
+package ipp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const ContentType = "application/ipp"
+
+// Print-Job requests include the document, so they may take a while on slow networks
+const requestTimeout = 5 * time.Minute
+
+// Client sends IPP requests over HTTP, e.g. to CUPS server
+type Client struct {
+	// Base HTTP URL, e.g. http://localhost:631
+	baseUrl    string
+	username   string
+	password   string
+	httpClient *http.Client
+
+	requestID atomic.Uint32
+}
+
+// NewClient accepts ipp://, ipps://, http:// and https:// URIs.
+// Credentials, if not empty, are sent using basic auth
+func NewClient(uri string, username string, password string) (*Client, error) {
+	baseUrl, err := HttpUrl(uri)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		baseUrl:    strings.TrimSuffix(baseUrl, "/"),
+		username:   username,
+		password:   password,
+		httpClient: &http.Client{Timeout: requestTimeout},
+	}, nil
+}
+
+// HttpUrl converts ipp:// URI to http:// URL, using default IPP port if port is missing
+func HttpUrl(uri string) (string, error) {
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return "", err
+	}
+
+	switch u.Scheme {
+	case "ipp", "ipps":
+		if u.Port() == "" {
+			u.Host += ":631"
+		}
+		if u.Scheme == "ipp" {
+			u.Scheme = "http"
+		} else {
+			u.Scheme = "https"
+		}
+	case "http", "https":
+	default:
+		return "", fmt.Errorf("unsupported IPP URI scheme: %s", u.Scheme)
+	}
+
+	return u.String(), nil
+}
+
+// PrinterPath returns resource path of CUPS printer, to be passed to Do
+func (c *Client) PrinterPath(printer string) string {
+	return "/printers/" + url.PathEscape(printer)
+}
+
+// PrinterUri returns URI of CUPS printer, as expected in printer-uri attribute
+func (c *Client) PrinterUri(printer string) string {
+	return strings.Replace(c.baseUrl, "http", "ipp", 1) + c.PrinterPath(printer)
+}
+
+// NewRequest creates request with unique request ID
+func (c *Client) NewRequest(op Operation) *Message {
+	return NewRequest(op, c.requestID.Add(1))
+}
+
+// Do sends request to the resource path (e.g. "/" or "/printers/name") along with document data, if not nil.
+// Returns *StatusError if response status is not successful
+func (c *Client) Do(path string, request *Message, data io.Reader) (*Message, error) {
+	var body bytes.Buffer
+
+	if err := request.Encode(&body); err != nil {
+		return nil, err
+	}
+
+	var reader io.Reader = &body
+	if data != nil {
+		reader = io.MultiReader(&body, data)
+	}
+
+	httpRequest, err := http.NewRequest(http.MethodPost, c.baseUrl+path, reader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	httpRequest.Header.Set("Content-Type", ContentType)
+	if c.username != "" {
+		httpRequest.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.httpClient.Do(httpRequest)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("IPP server responded with %s", resp.Status)
+	}
+
+	response, err := Decode(resp.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !response.Status().Successful() {
+		return nil, &StatusError{
+			Status:  response.Status(),
+			Message: response.Group(TagOperationGroup).Get("status-message").First().String(),
+		}
+	}
+
+	return response, nil
+}
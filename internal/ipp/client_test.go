@@ -0,0 +1,65 @@
+package ipp
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHttpUrl(t *testing.T) {
+	tests := []struct {
+		uri     string
+		want    string
+		wantErr bool
+	}{
+		{uri: "ipp://localhost", want: "http://localhost:631"},
+		{uri: "ipps://printer.local/ipp/print", want: "https://printer.local:631/ipp/print"},
+		{uri: "ipp://printer.local:8631", want: "http://printer.local:8631"},
+		{uri: "http://localhost:631", want: "http://localhost:631"},
+		{uri: "lpd://localhost", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := HttpUrl(tt.uri)
+
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error", tt.uri)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got %q (%v), want %q", tt.uri, got, err, tt.want)
+		}
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	c, err := NewClient(server.URL, "", "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.httpClient.Timeout != requestTimeout {
+		t.Fatalf("unexpected timeout %s", c.httpClient.Timeout)
+	}
+
+	// Server never responds
+	c.httpClient.Timeout = 100 * time.Millisecond
+	_, err = c.Do("/", c.NewRequest(OpGetPrinterAttributes), nil)
+
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("expected timeout, got %v", err)
+	}
+}
@@ -0,0 +1,214 @@
+package ipp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+var ErrMalformedMessage = errors.New("malformed IPP message")
+
+// Collections nest a couple of levels at most, e.g. media-col contains media-size
+const maxCollectionDepth = 16
+
+// Encode writes message header and attributes. Document data, if any, should be written right after
+func (m *Message) Encode(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	header := make([]byte, 0, 8)
+	header = binary.BigEndian.AppendUint16(header, m.Version)
+	header = binary.BigEndian.AppendUint16(header, m.Code)
+	header = binary.BigEndian.AppendUint32(header, m.RequestID)
+	_, _ = bw.Write(header)
+
+	for _, g := range m.Groups {
+		_ = bw.WriteByte(byte(g.Tag))
+		for _, attr := range g.Attributes {
+			if err := encodeAttribute(bw, attr); err != nil {
+				return err
+			}
+		}
+	}
+	_ = bw.WriteByte(byte(TagEndOfAttributes))
+
+	return bw.Flush()
+}
+
+func encodeAttribute(w *bufio.Writer, attr Attribute) error {
+	if len(attr.Values) == 0 {
+		return encodeValue(w, attr.Name, Value{Tag: TagNoValue})
+	}
+	for i, v := range attr.Values {
+		name := attr.Name
+		// Additional values have empty name
+		if i > 0 {
+			name = ""
+		}
+		if err := encodeValue(w, name, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeValue(w *bufio.Writer, name string, v Value) error {
+	if len(name) > math.MaxUint16 || len(v.Data) > math.MaxUint16 {
+		return fmt.Errorf("%w: attribute %q is too long", ErrMalformedMessage, name)
+	}
+
+	_ = w.WriteByte(byte(v.Tag))
+	_, _ = w.Write(binary.BigEndian.AppendUint16(nil, uint16(len(name))))
+	_, _ = w.WriteString(name)
+	_, _ = w.Write(binary.BigEndian.AppendUint16(nil, uint16(len(v.Data))))
+	_, _ = w.Write(v.Data)
+
+	if v.Tag != TagBeginCollection {
+		return nil
+	}
+
+	for _, member := range v.Members {
+		if err := encodeValue(w, "", String(TagMemberName, member.Name)); err != nil {
+			return err
+		}
+		for _, mv := range member.Values {
+			if err := encodeValue(w, "", mv); err != nil {
+				return err
+			}
+		}
+	}
+
+	return encodeValue(w, "", Value{Tag: TagEndCollection})
+}
+
+// Decode reads message header and attributes. Reader is left positioned at the start of document data
+func Decode(r io.Reader) (*Message, error) {
+	d := decoder{r: r}
+
+	m := &Message{
+		Version:   d.uint16(),
+		Code:      d.uint16(),
+		RequestID: d.uint32(),
+	}
+
+	var group *Group
+
+	for d.err == nil {
+		tag := Tag(d.byte())
+		if d.err != nil {
+			break
+		}
+
+		if tag == TagEndOfAttributes {
+			return m, nil
+		}
+
+		if tag.isDelimiter() {
+			m.Groups = append(m.Groups, Group{Tag: tag})
+			group = &m.Groups[len(m.Groups)-1]
+			continue
+		}
+
+		if group == nil {
+			return nil, fmt.Errorf("%w: attribute outside of group", ErrMalformedMessage)
+		}
+
+		name, value := d.value(tag, 0)
+
+		if name != "" {
+			group.Attributes = append(group.Attributes, Attribute{Name: name})
+		} else if len(group.Attributes) == 0 {
+			return nil, fmt.Errorf("%w: additional value without attribute", ErrMalformedMessage)
+		}
+
+		attr := &group.Attributes[len(group.Attributes)-1]
+		attr.Values = append(attr.Values, value)
+	}
+
+	if errors.Is(d.err, io.EOF) || errors.Is(d.err, io.ErrUnexpectedEOF) {
+		return nil, fmt.Errorf("%w: unexpected end of message", ErrMalformedMessage)
+	}
+
+	return nil, d.err
+}
+
+// decoder remembers the first error, so reads can be chained without checks
+type decoder struct {
+	r   io.Reader
+	err error
+}
+
+func (d *decoder) read(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	buf := make([]byte, n)
+	_, d.err = io.ReadFull(d.r, buf)
+	return buf
+}
+
+func (d *decoder) byte() byte {
+	buf := d.read(1)
+	if d.err != nil {
+		return 0
+	}
+	return buf[0]
+}
+
+func (d *decoder) uint16() uint16 {
+	buf := d.read(2)
+	if d.err != nil {
+		return 0
+	}
+	return binary.BigEndian.Uint16(buf)
+}
+
+func (d *decoder) uint32() uint32 {
+	buf := d.read(4)
+	if d.err != nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(buf)
+}
+
+// value reads the rest of attribute after its value tag, depth is the number of enclosing collections
+func (d *decoder) value(tag Tag, depth int) (string, Value) {
+	name := string(d.read(int(d.uint16())))
+	value := Value{Tag: tag, Data: d.read(int(d.uint16()))}
+
+	if tag == TagBeginCollection && d.err == nil {
+		if depth >= maxCollectionDepth {
+			d.err = fmt.Errorf("%w: collections are nested too deep", ErrMalformedMessage)
+			return name, value
+		}
+		value.Members = d.collectionMembers(depth + 1)
+	}
+
+	return name, value
+}
+
+func (d *decoder) collectionMembers(depth int) []Attribute {
+	var members []Attribute
+
+	for d.err == nil {
+		tag := Tag(d.byte())
+		_, value := d.value(tag, depth)
+
+		switch {
+		case d.err != nil:
+			return nil
+		case tag == TagEndCollection:
+			return members
+		case tag == TagMemberName:
+			members = append(members, Attribute{Name: value.String()})
+		case len(members) == 0:
+			d.err = fmt.Errorf("%w: collection value without member name", ErrMalformedMessage)
+		default:
+			members[len(members)-1].Values = append(members[len(members)-1].Values, value)
+		}
+	}
+
+	return nil
+}
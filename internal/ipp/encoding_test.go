@@ -0,0 +1,66 @@
+package ipp
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// nestedCollection returns media-col like attribute with collections nested depth times
+func nestedCollection(depth int) Attribute {
+	attr := NewAttribute("x-dimension", Integer(TagInteger, 21000))
+	for i := 0; i < depth; i++ {
+		attr = NewAttribute("media-col", Collection(attr))
+	}
+	return attr
+}
+
+func TestDecodeCollection(t *testing.T) {
+	request := NewRequest(OpPrintJob, 1)
+	request.Group(TagJobGroup).Add(nestedCollection(2))
+
+	var encoded bytes.Buffer
+	if err := request.Encode(&encoded); err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := Decode(&encoded)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mediaCol := decoded.Group(TagJobGroup).Get("media-col").First()
+	if len(mediaCol.Members) != 1 || mediaCol.Members[0].First().Members[0].First().Int() != 21000 {
+		t.Errorf("unexpected collection %+v", mediaCol)
+	}
+}
+
+func TestDecodeCollectionTooDeep(t *testing.T) {
+	tests := []struct {
+		depth   int
+		wantErr bool
+	}{
+		{depth: maxCollectionDepth, wantErr: false},
+		{depth: maxCollectionDepth + 1, wantErr: true},
+		{depth: 10000, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		request := NewRequest(OpPrintJob, 1)
+		request.Group(TagJobGroup).Add(nestedCollection(tt.depth))
+
+		var encoded bytes.Buffer
+		if err := request.Encode(&encoded); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := Decode(&encoded)
+
+		if tt.wantErr && !errors.Is(err, ErrMalformedMessage) {
+			t.Errorf("depth %d: expected ErrMalformedMessage, got %v", tt.depth, err)
+		} else if !tt.wantErr && err != nil {
+			t.Errorf("depth %d: %s", tt.depth, err)
+		}
+	}
+}
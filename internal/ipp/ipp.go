@@ -0,0 +1,296 @@
+// Package ipp implements Internet Printing Protocol message encoding (RFC 8010)
+// along with a minimal client
+package ipp
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+type Tag byte
+
+// Delimiter tags
+const (
+	TagOperationGroup   Tag = 0x01
+	TagJobGroup         Tag = 0x02
+	TagEndOfAttributes  Tag = 0x03
+	TagPrinterGroup     Tag = 0x04
+	TagUnsupportedGroup Tag = 0x05
+)
+
+// Value tags
+const (
+	TagUnsupportedValue Tag = 0x10
+	TagUnknown          Tag = 0x12
+	TagNoValue          Tag = 0x13
+	TagInteger          Tag = 0x21
+	TagBoolean          Tag = 0x22
+	TagEnum             Tag = 0x23
+	TagOctetString      Tag = 0x30
+	TagDateTime         Tag = 0x31
+	TagResolution       Tag = 0x32
+	TagRange            Tag = 0x33
+	TagBeginCollection  Tag = 0x34
+	TagTextLang         Tag = 0x35
+	TagNameLang         Tag = 0x36
+	TagEndCollection    Tag = 0x37
+	TagText             Tag = 0x41
+	TagName             Tag = 0x42
+	TagKeyword          Tag = 0x44
+	TagUri              Tag = 0x45
+	TagUriScheme        Tag = 0x46
+	TagCharset          Tag = 0x47
+	TagLanguage         Tag = 0x48
+	TagMimeType         Tag = 0x49
+	TagMemberName       Tag = 0x4A
+)
+
+func (t Tag) isDelimiter() bool {
+	return t < 0x10
+}
+
+type Operation uint16
+
+const (
+	OpPrintJob             Operation = 0x0002
+	OpValidateJob          Operation = 0x0004
+	OpCreateJob            Operation = 0x0005
+	OpSendDocument         Operation = 0x0006
+	OpCancelJob            Operation = 0x0008
+	OpGetJobAttributes     Operation = 0x0009
+	OpGetJobs              Operation = 0x000A
+	OpGetPrinterAttributes Operation = 0x000B
+	OpCupsGetDefault       Operation = 0x4001
+	OpCupsGetPrinters      Operation = 0x4002
+)
+
+type Status uint16
+
+const (
+	StatusOk                           Status = 0x0000
+	StatusOkIgnoredOrSubstituted       Status = 0x0001
+	StatusErrorBadRequest              Status = 0x0400
+	StatusErrorForbidden               Status = 0x0401
+	StatusErrorNotAuthenticated        Status = 0x0402
+	StatusErrorNotPossible             Status = 0x0404
+	StatusErrorNotFound                Status = 0x0406
+	StatusErrorRequestEntityTooLarge   Status = 0x0408
+	StatusErrorDocumentFormat          Status = 0x040A
+	StatusErrorAttributesOrValues      Status = 0x040B
+	StatusErrorInternal                Status = 0x0500
+	StatusErrorOperationNotSupported   Status = 0x0501
+	StatusErrorVersionNotSupported     Status = 0x0503
+	StatusErrorNotAcceptingJobs        Status = 0x0506
+	StatusErrorDocumentFormatNotValid  Status = 0x040E
+	StatusErrorCompressionNotSupported Status = 0x040F
+	StatusErrorBusy                    Status = 0x0507
+)
+
+func (s Status) Successful() bool {
+	return s < 0x0100
+}
+
+// Printer and job states, see RFC 8011
+const (
+	PrinterStateIdle       = 3
+	PrinterStateProcessing = 4
+	PrinterStateStopped    = 5
+
+	JobStatePending    = 3
+	JobStateHeld       = 4
+	JobStateProcessing = 5
+	JobStateStopped    = 6
+	JobStateCanceled   = 7
+	JobStateAborted    = 8
+	JobStateCompleted  = 9
+)
+
+const Version11 uint16 = 0x0101
+const Version20 uint16 = 0x0200
+
+type Value struct {
+	Tag  Tag
+	Data []byte
+	// Only for TagBeginCollection
+	Members []Attribute
+}
+
+func (v Value) String() string {
+	return string(v.Data)
+}
+
+func (v Value) Int() int {
+	if len(v.Data) != 4 {
+		return 0
+	}
+	return int(int32(binary.BigEndian.Uint32(v.Data)))
+}
+
+// Range returns bounds of rangeOfInteger value
+func (v Value) Range() (int, int) {
+	if len(v.Data) != 8 {
+		return 0, 0
+	}
+	return int(int32(binary.BigEndian.Uint32(v.Data))), int(int32(binary.BigEndian.Uint32(v.Data[4:])))
+}
+
+func (v Value) Bool() bool {
+	return len(v.Data) == 1 && v.Data[0] != 0
+}
+
+func String(tag Tag, s string) Value {
+	return Value{Tag: tag, Data: []byte(s)}
+}
+
+func Integer(tag Tag, n int) Value {
+	return Value{Tag: tag, Data: binary.BigEndian.AppendUint32(nil, uint32(int32(n)))}
+}
+
+func Boolean(b bool) Value {
+	if b {
+		return Value{Tag: TagBoolean, Data: []byte{1}}
+	}
+	return Value{Tag: TagBoolean, Data: []byte{0}}
+}
+
+func Range(lower int, upper int) Value {
+	data := binary.BigEndian.AppendUint32(nil, uint32(int32(lower)))
+	return Value{Tag: TagRange, Data: binary.BigEndian.AppendUint32(data, uint32(int32(upper)))}
+}
+
+// Resolution is in dots per inch
+func Resolution(x int, y int) Value {
+	data := binary.BigEndian.AppendUint32(nil, uint32(int32(x)))
+	data = binary.BigEndian.AppendUint32(data, uint32(int32(y)))
+	return Value{Tag: TagResolution, Data: append(data, 3)}
+}
+
+func Collection(members ...Attribute) Value {
+	return Value{Tag: TagBeginCollection, Members: members}
+}
+
+type Attribute struct {
+	Name   string
+	Values []Value
+}
+
+func NewAttribute(name string, values ...Value) Attribute {
+	return Attribute{Name: name, Values: values}
+}
+
+func Keywords(name string, keywords ...string) Attribute {
+	attr := Attribute{Name: name}
+	for _, k := range keywords {
+		attr.Values = append(attr.Values, String(TagKeyword, k))
+	}
+	return attr
+}
+
+// First returns zero Value if attribute has no values
+func (a Attribute) First() Value {
+	if len(a.Values) == 0 {
+		return Value{}
+	}
+	return a.Values[0]
+}
+
+func (a Attribute) Strings() []string {
+	result := make([]string, 0, len(a.Values))
+	for _, v := range a.Values {
+		result = append(result, v.String())
+	}
+	return result
+}
+
+type Group struct {
+	Tag        Tag
+	Attributes []Attribute
+}
+
+// Get returns attribute with empty Name if there is no such attribute
+func (g Group) Get(name string) Attribute {
+	for _, attr := range g.Attributes {
+		if attr.Name == name {
+			return attr
+		}
+	}
+	return Attribute{}
+}
+
+func (g *Group) Add(attrs ...Attribute) {
+	g.Attributes = append(g.Attributes, attrs...)
+}
+
+// Message is either a request or a response. Code holds operation ID for requests and status code for responses
+type Message struct {
+	Version   uint16
+	Code      uint16
+	RequestID uint32
+	Groups    []Group
+}
+
+// NewRequest adds attributes-charset and attributes-natural-language which are required in every request
+func NewRequest(op Operation, requestID uint32) *Message {
+	return &Message{
+		Version:   Version11,
+		Code:      uint16(op),
+		RequestID: requestID,
+		Groups: []Group{{
+			Tag: TagOperationGroup,
+			Attributes: []Attribute{
+				NewAttribute("attributes-charset", String(TagCharset, "utf-8")),
+				NewAttribute("attributes-natural-language", String(TagLanguage, "en")),
+			},
+		}},
+	}
+}
+
+// NewResponse adds attributes-charset and attributes-natural-language which are required in every response
+func NewResponse(status Status, requestID uint32) *Message {
+	m := NewRequest(Operation(status), requestID)
+	m.Version = Version20
+	return m
+}
+
+func (m *Message) Operation() Operation {
+	return Operation(m.Code)
+}
+
+func (m *Message) Status() Status {
+	return Status(m.Code)
+}
+
+// Group returns the first group with given tag, adding it if there is none
+func (m *Message) Group(tag Tag) *Group {
+	for i := range m.Groups {
+		if m.Groups[i].Tag == tag {
+			return &m.Groups[i]
+		}
+	}
+	m.Groups = append(m.Groups, Group{Tag: tag})
+	return &m.Groups[len(m.Groups)-1]
+}
+
+// GroupsOf returns all groups with given tag, e.g. one printer group per printer in CUPS-Get-Printers response
+func (m *Message) GroupsOf(tag Tag) []Group {
+	var groups []Group
+	for _, g := range m.Groups {
+		if g.Tag == tag {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// StatusError is returned by Client when response status is not successful
+type StatusError struct {
+	Status  Status
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("IPP error 0x%04x: %s", uint16(e.Status), e.Message)
+	}
+	return fmt.Sprintf("IPP error 0x%04x", uint16(e.Status))
+}
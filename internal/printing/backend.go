@@ -0,0 +1,81 @@
+package printing
+
+import (
+	"fmt"
+	"github.com/downace/print-server/internal/appconfig"
+	"io"
+)
+
+const (
+	BackendSystem  = "system"
+	BackendIPP     = "ipp"
+	BackendVirtual = "virtual"
+)
+
+// Backend talks to the print spooler
+type Backend interface {
+	ListPrinters() ([]Printer, error)
+	GetPrinter(name string) (PrinterDetails, error)
+	// CheckPrintOptions reports options which can't be applied by the backend
+	CheckPrintOptions(printer string, options PrintOptions) error
+	// PrintPDF returns job ID assigned by the spooler, or empty string if spooler doesn't report it
+	PrintPDF(printer string, file io.Reader, options PrintOptions) (string, error)
+	// PrintRaw sends printer-specific data (e.g. ZPL, ESC/POS or PCL) to the printer as is
+	PrintRaw(printer string, file io.Reader) (string, error)
+	CancelPrintJob(spoolId string) error
+}
+
+// systemBackend uses platform-specific commands, see printing_<os>.go
+type systemBackend struct{}
+
+func NewSystemBackend() Backend {
+	return systemBackend{}
+}
+
+// NewBackend creates backend selected in config. Virtual printers and ZPL fallbacks, if any, are added on top of it
+func NewBackend(config appconfig.BackendConfig) (Backend, error) {
+	b, err := newPrintersBackend(config)
+
+	if err != nil || len(config.ZplFallbacks) == 0 {
+		return b, err
+	}
+
+	printers := make([]ZplFallbackPrinter, 0, len(config.ZplFallbacks))
+	for _, p := range config.ZplFallbacks {
+		printers = append(printers, ZplFallbackPrinter{
+			Name:     p.Printer,
+			ZplLabel: ZplLabel{Dpi: p.Dpi, Width: p.LabelWidth, Height: p.LabelHeight},
+		})
+	}
+
+	return NewZplFallbackBackend(printers, b), nil
+}
+
+func newPrintersBackend(config appconfig.BackendConfig) (Backend, error) {
+	var b Backend
+	var err error
+
+	switch config.Type {
+	case "", BackendSystem:
+		b = NewSystemBackend()
+	case BackendIPP:
+		b, err = NewIppBackend(config.CupsUri, config.CupsUsername, config.CupsPassword)
+		if err != nil {
+			return nil, err
+		}
+	case BackendVirtual:
+		b = nil
+	default:
+		return nil, fmt.Errorf("unknown printing backend: %s", config.Type)
+	}
+
+	if config.Type == BackendVirtual || len(config.VirtualPrinters) > 0 {
+		printers := make([]VirtualPrinter, 0, len(config.VirtualPrinters))
+		for _, p := range config.VirtualPrinters {
+			printers = append(printers, VirtualPrinter{Name: p.Name, Directory: p.Directory})
+		}
+		return NewVirtualBackend(printers, b)
+	}
+
+	return b, nil
+}
@@ -0,0 +1,280 @@
+package printing
+
+import (
+	"errors"
+	"fmt"
+	"github.com/downace/print-server/internal/ipp"
+	"github.com/samber/lo"
+	"io"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// ippBackend talks to CUPS server using IPP instead of parsing lp/lpstat output
+type ippBackend struct {
+	client   *ipp.Client
+	username string
+}
+
+var ippPrinterStates = map[int]PrinterState{
+	ipp.PrinterStateIdle:       PrinterStateIdle,
+	ipp.PrinterStateProcessing: PrinterStateProcessing,
+	ipp.PrinterStateStopped:    PrinterStateStopped,
+}
+
+// NewIppBackend accepts CUPS server URI, e.g. ipp://localhost:631
+func NewIppBackend(uri string, username string, password string) (Backend, error) {
+	client, err := ipp.NewClient(uri, username, password)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// requesting-user-name is shown by CUPS as job owner
+	if username == "" {
+		if u, err := user.Current(); err == nil {
+			username = u.Username
+		}
+	}
+
+	return &ippBackend{client: client, username: username}, nil
+}
+
+func (b *ippBackend) ListPrinters() ([]Printer, error) {
+	req := b.client.NewRequest(ipp.OpCupsGetPrinters)
+	req.Group(ipp.TagOperationGroup).Add(ipp.Keywords("requested-attributes", "printer-name"))
+
+	resp, err := b.client.Do("/", req, nil)
+
+	if err != nil {
+		return nil, b.wrapError(err)
+	}
+
+	return lo.Map(resp.GroupsOf(ipp.TagPrinterGroup), func(g ipp.Group, _ int) Printer {
+		return Printer{Name: g.Get("printer-name").First().String()}
+	}), nil
+}
+
+func (b *ippBackend) GetPrinter(name string) (PrinterDetails, error) {
+	req := b.client.NewRequest(ipp.OpGetPrinterAttributes)
+	req.Group(ipp.TagOperationGroup).Add(
+		ipp.NewAttribute("printer-uri", ipp.String(ipp.TagUri, b.client.PrinterUri(name))),
+		ipp.Keywords("requested-attributes",
+			"printer-state",
+			"printer-state-reasons",
+			"printer-is-accepting-jobs",
+			"queued-job-count",
+			"media-supported",
+			"media-source-supported",
+			"sides-supported",
+			"print-color-mode-supported",
+		),
+	)
+
+	resp, err := b.client.Do(b.client.PrinterPath(name), req, nil)
+
+	if err != nil {
+		return PrinterDetails{}, b.wrapError(err)
+	}
+
+	attrs := resp.Group(ipp.TagPrinterGroup)
+
+	details := PrinterDetails{
+		Printer:       Printer{Name: name},
+		State:         lo.ValueOr(ippPrinterStates, attrs.Get("printer-state").First().Int(), PrinterStateIdle),
+		StateReasons:  lo.Without(attrs.Get("printer-state-reasons").Strings(), "none"),
+		AcceptingJobs: attrs.Get("printer-is-accepting-jobs").First().Bool(),
+		QueuedJobs:    attrs.Get("queued-job-count").First().Int(),
+		Media:         attrs.Get("media-supported").Strings(),
+		InputTrays:    attrs.Get("media-source-supported").Strings(),
+		Duplex: lo.ContainsBy(attrs.Get("sides-supported").Strings(), func(s string) bool {
+			return s != "one-sided"
+		}),
+		Color: lo.ContainsBy(attrs.Get("print-color-mode-supported").Strings(), func(s string) bool {
+			return s != "monochrome" && s != "bi-level" && s != "process-monochrome"
+		}),
+	}
+
+	defaultReq := b.client.NewRequest(ipp.OpCupsGetDefault)
+	defaultReq.Group(ipp.TagOperationGroup).Add(ipp.Keywords("requested-attributes", "printer-name"))
+
+	defaultResp, err := b.client.Do("/", defaultReq, nil)
+
+	// Fails if there is no default destination, that's fine
+	if err == nil {
+		details.IsDefault = defaultResp.Group(ipp.TagPrinterGroup).Get("printer-name").First().String() == name
+	}
+
+	return details, nil
+}
+
+func (b *ippBackend) CheckPrintOptions(_ string, _ PrintOptions) error {
+	return nil
+}
+
+func (b *ippBackend) PrintPDF(printer string, file io.Reader, options PrintOptions) (string, error) {
+	return b.printJob(printer, file, "application/pdf", options)
+}
+
+// PrintRaw uses CUPS raw format, so no filters are applied
+func (b *ippBackend) PrintRaw(printer string, file io.Reader) (string, error) {
+	return b.printJob(printer, file, "application/vnd.cups-raw", PrintOptions{})
+}
+
+func (b *ippBackend) printJob(printer string, file io.Reader, format string, options PrintOptions) (string, error) {
+	req := b.client.NewRequest(ipp.OpPrintJob)
+	req.Group(ipp.TagOperationGroup).Add(
+		ipp.NewAttribute("printer-uri", ipp.String(ipp.TagUri, b.client.PrinterUri(printer))),
+		ipp.NewAttribute("requesting-user-name", ipp.String(ipp.TagName, b.username)),
+		ipp.NewAttribute("job-name", ipp.String(ipp.TagName, "print-server")),
+		ipp.NewAttribute("document-format", ipp.String(ipp.TagMimeType, format)),
+	)
+	if jobAttrs := ippJobAttributes(options); len(jobAttrs) > 0 {
+		req.Group(ipp.TagJobGroup).Add(jobAttrs...)
+	}
+
+	resp, err := b.client.Do(b.client.PrinterPath(printer), req, file)
+
+	if err != nil {
+		return "", b.wrapError(err)
+	}
+
+	jobId := resp.Group(ipp.TagJobGroup).Get("job-id").First().Int()
+
+	// Same format as lp uses
+	return fmt.Sprintf("%s-%d", printer, jobId), nil
+}
+
+func (b *ippBackend) CancelPrintJob(spoolId string) error {
+	printer, jobId, err := parseSpoolId(spoolId)
+
+	if err != nil {
+		return err
+	}
+
+	state, err := b.getJobState(printer, jobId)
+
+	if err != nil {
+		return err
+	}
+
+	if state >= ipp.JobStateCanceled {
+		return fmt.Errorf("%w: job is already finished by printer", ErrJobNotCancellable)
+	}
+
+	req := b.client.NewRequest(ipp.OpCancelJob)
+	req.Group(ipp.TagOperationGroup).Add(
+		ipp.NewAttribute("printer-uri", ipp.String(ipp.TagUri, b.client.PrinterUri(printer))),
+		ipp.NewAttribute("job-id", ipp.Integer(ipp.TagInteger, jobId)),
+		ipp.NewAttribute("requesting-user-name", ipp.String(ipp.TagName, b.username)),
+	)
+
+	_, err = b.client.Do(b.client.PrinterPath(printer), req, nil)
+
+	return b.wrapError(err)
+}
+
+func (b *ippBackend) getJobState(printer string, jobId int) (int, error) {
+	req := b.client.NewRequest(ipp.OpGetJobAttributes)
+	req.Group(ipp.TagOperationGroup).Add(
+		ipp.NewAttribute("printer-uri", ipp.String(ipp.TagUri, b.client.PrinterUri(printer))),
+		ipp.NewAttribute("job-id", ipp.Integer(ipp.TagInteger, jobId)),
+		ipp.Keywords("requested-attributes", "job-state"),
+	)
+
+	resp, err := b.client.Do(b.client.PrinterPath(printer), req, nil)
+
+	if err != nil {
+		return 0, b.wrapError(err)
+	}
+
+	return resp.Group(ipp.TagJobGroup).Get("job-state").First().Int(), nil
+}
+
+// wrapError converts IPP errors to package errors where possible
+func (b *ippBackend) wrapError(err error) error {
+	var statusErr *ipp.StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.Status {
+		case ipp.StatusErrorNotFound:
+			return fmt.Errorf("%w: %w", ErrPrinterNotFound, err)
+		case ipp.StatusErrorAttributesOrValues, ipp.StatusErrorDocumentFormat:
+			return fmt.Errorf("%w: %w", ErrRequestError, err)
+		}
+	}
+	return err
+}
+
+// parseSpoolId splits job ID in lp format, e.g. "Brother_MFC_L2700DN_series-42"
+func parseSpoolId(spoolId string) (string, int, error) {
+	pos := strings.LastIndex(spoolId, "-")
+	if pos < 0 {
+		return "", 0, fmt.Errorf("invalid spool job ID: %s", spoolId)
+	}
+	jobId, err := strconv.Atoi(spoolId[pos+1:])
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid spool job ID: %s", spoolId)
+	}
+	return spoolId[:pos], jobId, nil
+}
+
+// ippJobAttributes converts options to IPP job template attributes
+func ippJobAttributes(options PrintOptions) []ipp.Attribute {
+	var attrs []ipp.Attribute
+
+	if options.Copies > 0 {
+		attrs = append(attrs, ipp.NewAttribute("copies", ipp.Integer(ipp.TagInteger, options.Copies)))
+	}
+	if options.Sides != "" {
+		attrs = append(attrs, ipp.Keywords("sides", options.Sides))
+	}
+	if options.ColorMode != "" {
+		attrs = append(attrs, ipp.Keywords("print-color-mode", options.ColorMode))
+	}
+	if options.InputTray != "" {
+		members := []ipp.Attribute{ipp.Keywords("media-source", options.InputTray)}
+		if options.Media != "" {
+			members = append(members, ipp.Keywords("media-size-name", options.Media))
+		}
+		attrs = append(attrs, ipp.NewAttribute("media-col", ipp.Collection(members...)))
+	} else if options.Media != "" {
+		attrs = append(attrs, ipp.Keywords("media", options.Media))
+	}
+	if options.PageRanges != "" {
+		attrs = append(attrs, ipp.NewAttribute("page-ranges", ippPageRanges(options.PageRanges)...))
+	}
+	if options.FitToPage {
+		attrs = append(attrs, ipp.Keywords("print-scaling", "fit"))
+	}
+	switch options.Orientation {
+	case "portrait":
+		attrs = append(attrs, ipp.NewAttribute("orientation-requested", ipp.Integer(ipp.TagEnum, 3)))
+	case "landscape":
+		attrs = append(attrs, ipp.NewAttribute("orientation-requested", ipp.Integer(ipp.TagEnum, 4)))
+	}
+	if options.Collate != nil {
+		handling := "separate-documents-uncollated-copies"
+		if *options.Collate {
+			handling = "separate-documents-collated-copies"
+		}
+		attrs = append(attrs, ipp.Keywords("multiple-document-handling", handling))
+	}
+
+	return attrs
+}
+
+// ippPageRanges converts e.g. "1-3,5" to rangeOfInteger values. Ranges are expected to be validated already
+func ippPageRanges(pageRanges string) []ipp.Value {
+	var values []ipp.Value
+	for _, part := range strings.Split(pageRanges, ",") {
+		lower, upper, found := strings.Cut(part, "-")
+		if !found {
+			upper = lower
+		}
+		l, _ := strconv.Atoi(lower)
+		u, _ := strconv.Atoi(upper)
+		values = append(values, ipp.Range(l, u))
+	}
+	return values
+}
@@ -0,0 +1,266 @@
+package printing
+
+import (
+	"bufio"
+	"errors"
+	"github.com/downace/print-server/internal/ipp"
+	"github.com/samber/lo"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeCups serves a single printer "Office" with job 42 being printed and job 43 completed
+type fakeCups struct {
+	mu       sync.Mutex
+	requests []*ipp.Message
+	paths    []string
+	document []byte
+}
+
+func (c *fakeCups) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body := bufio.NewReader(r.Body)
+	request, err := ipp.Decode(body)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	document, _ := io.ReadAll(body)
+
+	c.mu.Lock()
+	c.requests = append(c.requests, request)
+	c.paths = append(c.paths, r.URL.Path)
+	if request.Operation() == ipp.OpPrintJob {
+		c.document = document
+	}
+	c.mu.Unlock()
+
+	response := ipp.NewResponse(ipp.StatusOk, request.RequestID)
+	operation := request.Group(ipp.TagOperationGroup)
+
+	if r.URL.Path != "/" && r.URL.Path != "/printers/Office" {
+		response = ipp.NewResponse(ipp.StatusErrorNotFound, request.RequestID)
+		w.Header().Set("Content-Type", ipp.ContentType)
+		_ = response.Encode(w)
+		return
+	}
+
+	switch request.Operation() {
+	case ipp.OpCupsGetPrinters:
+		response.Groups = append(response.Groups,
+			ipp.Group{Tag: ipp.TagPrinterGroup, Attributes: []ipp.Attribute{ipp.NewAttribute("printer-name", ipp.String(ipp.TagName, "Office"))}},
+			ipp.Group{Tag: ipp.TagPrinterGroup, Attributes: []ipp.Attribute{ipp.NewAttribute("printer-name", ipp.String(ipp.TagName, "Labels"))}},
+		)
+	case ipp.OpCupsGetDefault:
+		response.Group(ipp.TagPrinterGroup).Add(ipp.NewAttribute("printer-name", ipp.String(ipp.TagName, "Office")))
+	case ipp.OpGetPrinterAttributes:
+		response.Group(ipp.TagPrinterGroup).Add(
+			ipp.NewAttribute("printer-state", ipp.Integer(ipp.TagEnum, ipp.PrinterStateProcessing)),
+			ipp.Keywords("printer-state-reasons", "none"),
+			ipp.NewAttribute("printer-is-accepting-jobs", ipp.Boolean(true)),
+			ipp.NewAttribute("queued-job-count", ipp.Integer(ipp.TagInteger, 1)),
+			ipp.Keywords("media-supported", "iso_a4_210x297mm", "na_letter_8.5x11in"),
+			ipp.Keywords("sides-supported", "one-sided", "two-sided-long-edge"),
+			ipp.Keywords("print-color-mode-supported", "monochrome"),
+		)
+	case ipp.OpPrintJob:
+		response.Group(ipp.TagJobGroup).Add(ipp.NewAttribute("job-id", ipp.Integer(ipp.TagInteger, 42)))
+	case ipp.OpGetJobAttributes:
+		state := ipp.JobStateProcessing
+		if operation.Get("job-id").First().Int() == 43 {
+			state = ipp.JobStateCompleted
+		}
+		response.Group(ipp.TagJobGroup).Add(ipp.NewAttribute("job-state", ipp.Integer(ipp.TagEnum, state)))
+	case ipp.OpCancelJob:
+	default:
+		response = ipp.NewResponse(ipp.StatusErrorOperationNotSupported, request.RequestID)
+	}
+
+	w.Header().Set("Content-Type", ipp.ContentType)
+	_ = response.Encode(w)
+}
+
+// operations returns operations of received requests in order
+func (c *fakeCups) operations() []ipp.Operation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ops := make([]ipp.Operation, 0, len(c.requests))
+	for _, request := range c.requests {
+		ops = append(ops, request.Operation())
+	}
+	return ops
+}
+
+func newTestIppBackend(t *testing.T) (*fakeCups, Backend) {
+	t.Helper()
+
+	cups := &fakeCups{}
+	server := httptest.NewServer(cups)
+	t.Cleanup(server.Close)
+
+	backend, err := NewIppBackend(server.URL, "alice", "secret")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cups, backend
+}
+
+func TestIppBackendListPrinters(t *testing.T) {
+	_, backend := newTestIppBackend(t)
+
+	printers, err := backend.ListPrinters()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(printers) != 2 || printers[0].Name != "Office" || printers[1].Name != "Labels" {
+		t.Errorf("unexpected printers %+v", printers)
+	}
+}
+
+func TestIppBackendGetPrinter(t *testing.T) {
+	_, backend := newTestIppBackend(t)
+
+	printer, err := backend.GetPrinter("Office")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if printer.State != PrinterStateProcessing || !printer.AcceptingJobs || printer.QueuedJobs != 1 || !printer.IsDefault {
+		t.Errorf("unexpected printer state %+v", printer)
+	}
+	if len(printer.StateReasons) != 0 {
+		t.Errorf("unexpected state reasons %v", printer.StateReasons)
+	}
+	if len(printer.Media) != 2 || !printer.Duplex || printer.Color {
+		t.Errorf("unexpected printer capabilities %+v", printer)
+	}
+
+	if _, err := backend.GetPrinter("Unknown"); !errors.Is(err, ErrPrinterNotFound) {
+		t.Errorf("expected ErrPrinterNotFound, got %v", err)
+	}
+}
+
+func TestIppBackendPrintPDF(t *testing.T) {
+	cups, backend := newTestIppBackend(t)
+
+	spoolId, err := backend.PrintPDF("Office", strings.NewReader("%PDF-1.4"), PrintOptions{Copies: 2})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spoolId != "Office-42" {
+		t.Errorf("got spool ID %q, want Office-42", spoolId)
+	}
+
+	request := cups.requests[0]
+	operation := request.Group(ipp.TagOperationGroup)
+
+	if cups.paths[0] != "/printers/Office" {
+		t.Errorf("request is sent to %s", cups.paths[0])
+	}
+	if format := operation.Get("document-format").First().String(); format != "application/pdf" {
+		t.Errorf("got document-format %q", format)
+	}
+	if user := operation.Get("requesting-user-name").First().String(); user != "alice" {
+		t.Errorf("got requesting-user-name %q", user)
+	}
+	if copies := request.Group(ipp.TagJobGroup).Get("copies").First().Int(); copies != 2 {
+		t.Errorf("got copies %d, want 2", copies)
+	}
+	if string(cups.document) != "%PDF-1.4" {
+		t.Errorf("unexpected document %q", cups.document)
+	}
+}
+
+func TestIppBackendCancelPrintJob(t *testing.T) {
+	tests := []struct {
+		name    string
+		spoolId string
+		wantErr error
+		// Operations sent to CUPS
+		want []ipp.Operation
+	}{
+		{name: "printing", spoolId: "Office-42", want: []ipp.Operation{ipp.OpGetJobAttributes, ipp.OpCancelJob}},
+		{name: "completed", spoolId: "Office-43", wantErr: ErrJobNotCancellable, want: []ipp.Operation{ipp.OpGetJobAttributes}},
+		{name: "unknown printer", spoolId: "Unknown-42", wantErr: ErrPrinterNotFound, want: []ipp.Operation{ipp.OpGetJobAttributes}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cups, backend := newTestIppBackend(t)
+
+			err := backend.CancelPrintJob(tt.spoolId)
+
+			if tt.wantErr == nil && err != nil {
+				t.Fatal(err)
+			} else if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+
+			if ops := cups.operations(); !slices.Equal(ops, tt.want) {
+				t.Errorf("got operations %v, want %v", ops, tt.want)
+			}
+		})
+	}
+}
+
+func TestIppJobAttributes(t *testing.T) {
+	tests := []struct {
+		name    string
+		options PrintOptions
+		want    []ipp.Attribute
+	}{
+		{name: "defaults", options: PrintOptions{}, want: nil},
+		{
+			name:    "copies and sides",
+			options: PrintOptions{Copies: 2, Sides: "two-sided-long-edge", ColorMode: "monochrome"},
+			want: []ipp.Attribute{
+				ipp.NewAttribute("copies", ipp.Integer(ipp.TagInteger, 2)),
+				ipp.Keywords("sides", "two-sided-long-edge"),
+				ipp.Keywords("print-color-mode", "monochrome"),
+			},
+		},
+		{name: "media", options: PrintOptions{Media: "iso_a4_210x297mm"}, want: []ipp.Attribute{ipp.Keywords("media", "iso_a4_210x297mm")}},
+		{
+			name:    "media with tray",
+			options: PrintOptions{Media: "iso_a4_210x297mm", InputTray: "tray-2"},
+			want: []ipp.Attribute{
+				ipp.NewAttribute("media-col", ipp.Collection(ipp.Keywords("media-source", "tray-2"), ipp.Keywords("media-size-name", "iso_a4_210x297mm"))),
+			},
+		},
+		{
+			name:    "page ranges",
+			options: PrintOptions{PageRanges: "1-3,5"},
+			want:    []ipp.Attribute{ipp.NewAttribute("page-ranges", ipp.Range(1, 3), ipp.Range(5, 5))},
+		},
+		{
+			name:    "layout",
+			options: PrintOptions{FitToPage: true, Orientation: "landscape", Collate: lo.ToPtr(false)},
+			want: []ipp.Attribute{
+				ipp.Keywords("print-scaling", "fit"),
+				ipp.NewAttribute("orientation-requested", ipp.Integer(ipp.TagEnum, 4)),
+				ipp.Keywords("multiple-document-handling", "separate-documents-uncollated-copies"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ippJobAttributes(tt.options); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package printing
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// VirtualPrinter saves printed documents to a directory instead of printing them
+type VirtualPrinter struct {
+	Name      string
+	Directory string
+}
+
+// VirtualDocumentMeta is saved next to each document
+type VirtualDocumentMeta struct {
+	Printer   string       `json:"printer"`
+	Options   PrintOptions `json:"options"`
+	Raw       bool         `json:"raw,omitempty"`
+	Size      int64        `json:"size"`
+	CreatedAt time.Time    `json:"createdAt"`
+}
+
+// virtualBackend handles virtual printers and passes everything else to the next backend
+type virtualBackend struct {
+	printers []VirtualPrinter
+	next     Backend
+}
+
+// NewVirtualBackend creates directories of virtual printers. Next backend may be nil,
+// then only virtual printers are available
+func NewVirtualBackend(printers []VirtualPrinter, next Backend) (Backend, error) {
+	for _, p := range printers {
+		if p.Name == "" || p.Directory == "" {
+			return nil, fmt.Errorf("virtual printer must have name and directory")
+		}
+		if err := os.MkdirAll(p.Directory, 0o775); err != nil {
+			return nil, err
+		}
+	}
+
+	return &virtualBackend{printers: printers, next: next}, nil
+}
+
+func (b *virtualBackend) find(name string) (VirtualPrinter, bool) {
+	i := slices.IndexFunc(b.printers, func(p VirtualPrinter) bool {
+		return p.Name == name
+	})
+	if i < 0 {
+		return VirtualPrinter{}, false
+	}
+	return b.printers[i], true
+}
+
+// nextBackend returns ErrPrinterNotFound if there is no next backend
+func (b *virtualBackend) nextBackend(printer string) (Backend, error) {
+	if b.next == nil {
+		return nil, fmt.Errorf("%w: %s", ErrPrinterNotFound, printer)
+	}
+	return b.next, nil
+}
+
+func (b *virtualBackend) ListPrinters() ([]Printer, error) {
+	printers := make([]Printer, 0, len(b.printers))
+
+	for _, p := range b.printers {
+		printers = append(printers, Printer{Name: p.Name})
+	}
+
+	if b.next == nil {
+		return printers, nil
+	}
+
+	nextPrinters, err := b.next.ListPrinters()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return append(printers, nextPrinters...), nil
+}
+
+func (b *virtualBackend) GetPrinter(name string) (PrinterDetails, error) {
+	if _, ok := b.find(name); !ok {
+		next, err := b.nextBackend(name)
+		if err != nil {
+			return PrinterDetails{}, err
+		}
+		return next.GetPrinter(name)
+	}
+
+	return PrinterDetails{
+		Printer:       Printer{Name: name},
+		State:         PrinterStateIdle,
+		StateReasons:  make([]string, 0),
+		AcceptingJobs: true,
+		Media:         make([]string, 0),
+		InputTrays:    make([]string, 0),
+		Duplex:        true,
+		Color:         true,
+	}, nil
+}
+
+func (b *virtualBackend) CheckPrintOptions(printer string, options PrintOptions) error {
+	if _, ok := b.find(printer); !ok {
+		next, err := b.nextBackend(printer)
+		if err != nil {
+			return err
+		}
+		return next.CheckPrintOptions(printer, options)
+	}
+
+	return nil
+}
+
+// PrintPDF saves document as <timestamp>.pdf and metadata as <timestamp>.json
+func (b *virtualBackend) PrintPDF(printer string, file io.Reader, options PrintOptions) (string, error) {
+	p, ok := b.find(printer)
+
+	if !ok {
+		next, err := b.nextBackend(printer)
+		if err != nil {
+			return "", err
+		}
+		return next.PrintPDF(printer, file, options)
+	}
+
+	return saveVirtualDocument(p, file, ".pdf", VirtualDocumentMeta{Printer: printer, Options: options})
+}
+
+// PrintRaw saves data as <timestamp>.bin and metadata as <timestamp>.json
+func (b *virtualBackend) PrintRaw(printer string, file io.Reader) (string, error) {
+	p, ok := b.find(printer)
+
+	if !ok {
+		next, err := b.nextBackend(printer)
+		if err != nil {
+			return "", err
+		}
+		return next.PrintRaw(printer, file)
+	}
+
+	return saveVirtualDocument(p, file, ".bin", VirtualDocumentMeta{Printer: printer, Raw: true})
+}
+
+// saveVirtualDocument fills the rest of metadata and returns spool ID
+func saveVirtualDocument(p VirtualPrinter, file io.Reader, ext string, meta VirtualDocumentMeta) (string, error) {
+	now := time.Now()
+	basePath := filepath.Join(p.Directory, strconv.FormatInt(now.UnixNano(), 10))
+	// Nanoseconds are unique enough, but let's not overwrite anything
+	docFile, err := os.OpenFile(basePath+ext, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o664)
+
+	if err != nil {
+		return "", err
+	}
+
+	size, err := io.Copy(docFile, file)
+	closeErr := docFile.Close()
+
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	meta.Size = size
+	meta.CreatedAt = now
+	metaJson, err := json.MarshalIndent(meta, "", "  ")
+
+	if err != nil {
+		return "", err
+	}
+
+	err = os.WriteFile(basePath+".json", metaJson, 0o664)
+
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s-%d", p.Name, now.UnixNano()), nil
+}
+
+func (b *virtualBackend) CancelPrintJob(spoolId string) error {
+	printer, _, err := parseSpoolId(spoolId)
+
+	if err != nil {
+		return err
+	}
+
+	if _, ok := b.find(printer); !ok {
+		next, err := b.nextBackend(printer)
+		if err != nil {
+			return err
+		}
+		return next.CancelPrintJob(spoolId)
+	}
+
+	return fmt.Errorf("%w: document is already saved", ErrJobNotCancellable)
+}
@@ -0,0 +1,123 @@
+package printing
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readVirtualDocument reads the only document saved to dir and its metadata
+func readVirtualDocument(t *testing.T, dir string, ext string) (string, VirtualDocumentMeta) {
+	t.Helper()
+
+	docs, _ := filepath.Glob(filepath.Join(dir, "*"+ext))
+
+	if len(docs) != 1 {
+		t.Fatalf("expected one %s document, got %v", ext, docs)
+	}
+
+	data, err := os.ReadFile(docs[0])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metaJson, err := os.ReadFile(strings.TrimSuffix(docs[0], ext) + ".json")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var meta VirtualDocumentMeta
+
+	if err := json.Unmarshal(metaJson, &meta); err != nil {
+		t.Fatal(err)
+	}
+
+	return string(data), meta
+}
+
+func TestVirtualBackendPrint(t *testing.T) {
+	pdfDir := filepath.Join(t.TempDir(), "pdf")
+	rawDir := filepath.Join(t.TempDir(), "raw")
+	backend, err := NewVirtualBackend([]VirtualPrinter{{Name: "Archive", Directory: pdfDir}, {Name: "Labels", Directory: rawDir}}, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spoolId, err := backend.PrintPDF("Archive", strings.NewReader("%PDF-1.4"), PrintOptions{Copies: 2})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(spoolId, "Archive-") {
+		t.Errorf("unexpected spool ID %q", spoolId)
+	}
+
+	data, meta := readVirtualDocument(t, pdfDir, ".pdf")
+
+	if data != "%PDF-1.4" || meta.Printer != "Archive" || meta.Options.Copies != 2 || meta.Raw || meta.Size != 8 {
+		t.Errorf("unexpected PDF document %q: %+v", data, meta)
+	}
+
+	if _, err := backend.PrintRaw("Labels", strings.NewReader("^XA^XZ")); err != nil {
+		t.Fatal(err)
+	}
+
+	data, meta = readVirtualDocument(t, rawDir, ".bin")
+
+	if data != "^XA^XZ" || meta.Printer != "Labels" || !meta.Raw || meta.Size != 6 {
+		t.Errorf("unexpected raw document %q: %+v", data, meta)
+	}
+
+	if err := backend.CancelPrintJob(spoolId); !errors.Is(err, ErrJobNotCancellable) {
+		t.Errorf("expected job to be not cancellable, got %v", err)
+	}
+	if _, err := backend.PrintPDF("Office", strings.NewReader("%PDF-1.4"), PrintOptions{}); !errors.Is(err, ErrPrinterNotFound) {
+		t.Errorf("expected printer not found, got %v", err)
+	}
+}
+
+func TestVirtualBackendNext(t *testing.T) {
+	nextDir := t.TempDir()
+	next, err := NewVirtualBackend([]VirtualPrinter{{Name: "Office", Directory: nextDir}}, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend, err := NewVirtualBackend([]VirtualPrinter{{Name: "Archive", Directory: t.TempDir()}}, next)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	printers, err := backend.ListPrinters()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(printers) != 2 || printers[0].Name != "Archive" || printers[1].Name != "Office" {
+		t.Errorf("unexpected printers %+v", printers)
+	}
+
+	if _, err := backend.PrintPDF("Office", strings.NewReader("%PDF-1.4"), PrintOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	readVirtualDocument(t, nextDir, ".pdf")
+
+	if _, err := backend.GetPrinter("Unknown"); !errors.Is(err, ErrPrinterNotFound) {
+		t.Errorf("expected printer not found, got %v", err)
+	}
+}
+
+func TestNewVirtualBackendInvalid(t *testing.T) {
+	if _, err := NewVirtualBackend([]VirtualPrinter{{Name: "Archive"}}, nil); err == nil {
+		t.Error("expected error for printer without directory")
+	}
+}
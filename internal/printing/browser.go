@@ -0,0 +1,140 @@
+package printing
+
+import (
+	"github.com/downace/print-server/internal/appconfig"
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBrowserMaxPages = 2
+	browserHealthTimeout   = 5 * time.Second
+)
+
+// BrowserPool opens pages in headless browser. Each page is opened in a separate incognito context,
+// so pages don't share cookies and storage. Browser is launched on first use and relaunched if it
+// crashes or stops responding
+type BrowserPool struct {
+	mu      sync.Mutex
+	browser *rod.Browser
+	// Each open page takes a slot, renders wait for a free slot
+	slots chan struct{}
+	// URLs loaded by pages are checked by the policy
+	policy *UrlPolicy
+	// Pages connect to hosts through the proxy, so addresses are checked by the policy as well
+	proxy  *browserProxy
+	closed bool
+}
+
+func NewBrowserPool(config appconfig.BrowserConfig, policy *UrlPolicy) *BrowserPool {
+	maxPages := config.MaxPages
+	if maxPages <= 0 {
+		maxPages = defaultBrowserMaxPages
+	}
+
+	return &BrowserPool{slots: make(chan struct{}, maxPages), policy: policy}
+}
+
+// page opens blank page, release closes it along with its context and frees the slot
+func (p *BrowserPool) page() (page *rod.Page, release func(), err error) {
+	p.slots <- struct{}{}
+
+	defer func() {
+		if err != nil {
+			<-p.slots
+		}
+	}()
+
+	browser, proxy, err := p.connect()
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Same as browser.Incognito, but with proxy. Loopback addresses are proxied too, so they are checked
+	res, err := proto.TargetCreateBrowserContext{ProxyServer: proxy.addr(), ProxyBypassList: "<-loopback>"}.Call(browser)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	disposeContext := func() {
+		_ = proto.TargetDisposeBrowserContext{BrowserContextID: res.BrowserContextID}.Call(browser)
+	}
+
+	incognito := *browser
+	incognito.BrowserContextID = res.BrowserContextID
+
+	page, err = incognito.Page(proto.TargetCreateTarget{})
+
+	if err != nil {
+		disposeContext()
+		return nil, nil, err
+	}
+
+	release = func() {
+		_ = page.Close()
+		disposeContext()
+		<-p.slots
+	}
+
+	return page, release, nil
+}
+
+// connect returns running browser and proxy, new browser is launched if there is no browser or it doesn't respond
+func (p *BrowserPool) connect() (*rod.Browser, *browserProxy, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil, nil, ErrRendererClosed
+	}
+
+	if p.proxy == nil {
+		proxy, err := startBrowserProxy(p.policy)
+		if err != nil {
+			return nil, nil, err
+		}
+		p.proxy = proxy
+	}
+
+	if p.browser != nil {
+		if _, err := (proto.BrowserGetVersion{}).Call(p.browser.Timeout(browserHealthTimeout)); err == nil {
+			return p.browser, p.proxy, nil
+		}
+		_ = p.browser.Close()
+		p.browser = nil
+	}
+
+	browser := rod.New()
+
+	if err := browser.Connect(); err != nil {
+		return nil, nil, err
+	}
+
+	p.browser = browser
+	return browser, p.proxy, nil
+}
+
+// Close closes the browser and the proxy. Pool can't be used after that, so browser is not launched again
+func (p *BrowserPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+
+	if p.proxy != nil {
+		_ = p.proxy.Close()
+		p.proxy = nil
+	}
+
+	if p.browser == nil {
+		return nil
+	}
+
+	err := p.browser.Close()
+	p.browser = nil
+	return err
+}
@@ -0,0 +1,26 @@
+package printing
+
+import (
+	"errors"
+	"github.com/downace/print-server/internal/appconfig"
+	"testing"
+)
+
+func TestBrowserPoolClose(t *testing.T) {
+	p := NewBrowserPool(appconfig.BrowserConfig{MaxPages: 1}, NewUrlPolicy(appconfig.UrlPolicyConfig{}))
+
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Queued jobs may still render pages, browser and proxy must not be started for them
+	for range 2 {
+		if _, _, err := p.page(); !errors.Is(err, ErrRendererClosed) {
+			t.Fatalf("expected ErrRendererClosed, got %v", err)
+		}
+	}
+
+	if p.browser != nil || p.proxy != nil {
+		t.Error("browser is launched after Close")
+	}
+}
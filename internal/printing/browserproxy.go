@@ -0,0 +1,137 @@
+package printing
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// browserProxy is HTTP proxy for browser pages. Browser would resolve hosts itself, so a host could
+// resolve to another address after it was checked, and WebSocket connections are not intercepted at all.
+// Proxy connects to hosts using the policy dialer, so addresses are checked for every connection
+type browserProxy struct {
+	policy   *UrlPolicy
+	listener net.Listener
+	server   *http.Server
+	forward  *httputil.ReverseProxy
+}
+
+// startBrowserProxy listens on a random loopback port
+func startBrowserProxy(policy *UrlPolicy) (*browserProxy, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		return nil, err
+	}
+
+	p := &browserProxy{policy: policy, listener: listener}
+	p.forward = &httputil.ReverseProxy{
+		// Requests to proxy have absolute URLs, so they are sent as is
+		Rewrite:      func(*httputil.ProxyRequest) {},
+		Transport:    policy.transport,
+		ErrorHandler: p.respondError,
+	}
+	p.server = &http.Server{Handler: p, ReadHeaderTimeout: 30 * time.Second}
+
+	go func() {
+		if err := p.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("browser proxy stopped: %s", err)
+		}
+	}()
+
+	return p, nil
+}
+
+func (p *browserProxy) addr() string {
+	return p.listener.Addr().String()
+}
+
+func (p *browserProxy) Close() error {
+	return p.server.Close()
+}
+
+func (p *browserProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, r)
+		return
+	}
+
+	if !r.URL.IsAbs() {
+		http.Error(w, "proxy request must have absolute URL", http.StatusBadRequest)
+		return
+	}
+
+	if err := p.policy.checkUrl(r.URL); err != nil {
+		p.respondError(w, r, err)
+		return
+	}
+
+	p.forward.ServeHTTP(w, r)
+}
+
+// tunnel connects client to the host for HTTPS and secure WebSocket connections
+func (p *browserProxy) tunnel(w http.ResponseWriter, r *http.Request) {
+	// Tunnel may carry secure WebSocket as well, host is checked the same way
+	if err := p.policy.checkUrl(&url.URL{Scheme: "https", Host: r.Host}); err != nil {
+		p.respondError(w, r, err)
+		return
+	}
+
+	target, err := p.policy.dialer.DialContext(r.Context(), "tcp", r.Host)
+
+	if err != nil {
+		p.respondError(w, r, err)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+
+	if !ok {
+		_ = target.Close()
+		http.Error(w, "tunneling is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	conn, buf, err := hijacker.Hijack()
+
+	if err != nil {
+		_ = target.Close()
+		return
+	}
+
+	if _, err := io.WriteString(conn, "HTTP/1.1 200 Connection Established\r\n\r\n"); err != nil {
+		_ = conn.Close()
+		_ = target.Close()
+		return
+	}
+
+	var once sync.Once
+	closeBoth := func() {
+		_ = conn.Close()
+		_ = target.Close()
+	}
+
+	go func() {
+		// Client may have sent data right after CONNECT, it is already buffered
+		_, _ = io.Copy(target, buf)
+		once.Do(closeBoth)
+	}()
+
+	_, _ = io.Copy(conn, target)
+	once.Do(closeBoth)
+}
+
+func (p *browserProxy) respondError(w http.ResponseWriter, _ *http.Request, err error) {
+	if errors.Is(err, ErrUrlNotAllowed) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	http.Error(w, err.Error(), http.StatusBadGateway)
+}
@@ -0,0 +1,92 @@
+package printing
+
+import (
+	"crypto/tls"
+	"github.com/downace/print-server/internal/appconfig"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func newTestBrowserProxy(t *testing.T, config appconfig.UrlPolicyConfig) *url.URL {
+	t.Helper()
+
+	proxy, err := startBrowserProxy(NewUrlPolicy(config))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = proxy.Close() })
+
+	return &url.URL{Scheme: "http", Host: proxy.addr()}
+}
+
+func TestBrowserProxy(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "page")
+	})
+	plain := httptest.NewServer(handler)
+	defer plain.Close()
+	secure := httptest.NewTLSServer(handler)
+	defer secure.Close()
+
+	tests := []struct {
+		name   string
+		config appconfig.UrlPolicyConfig
+		// Status of proxied response, 0 if connection fails
+		want int
+	}{
+		{name: "loopback", config: appconfig.UrlPolicyConfig{}, want: http.StatusForbidden},
+		{name: "allowed network", config: appconfig.UrlPolicyConfig{AllowedNetworks: []string{"127.0.0.0/8"}}, want: http.StatusOK},
+		{
+			name:   "denied host",
+			config: appconfig.UrlPolicyConfig{AllowedNetworks: []string{"127.0.0.0/8"}, DeniedHosts: []string{"127.0.0.1"}},
+			want:   http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxyUrl := newTestBrowserProxy(t, tt.config)
+
+			transport := secure.Client().Transport.(*http.Transport).Clone()
+			transport.Proxy = http.ProxyURL(proxyUrl)
+			transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+			client := &http.Client{Transport: transport}
+
+			resp, err := client.Get(plain.URL)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = resp.Body.Close()
+
+			if resp.StatusCode != tt.want {
+				t.Errorf("HTTP: got status %d, want %d", resp.StatusCode, tt.want)
+			}
+
+			// Tunnel is refused with an error
+			resp, err = client.Get(secure.URL)
+
+			if tt.want != http.StatusOK {
+				if err == nil {
+					_ = resp.Body.Close()
+					t.Error("HTTPS: expected tunnel to be refused")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+
+			if string(body) != "page" {
+				t.Errorf("HTTPS: unexpected response %q", body)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package printing
+
+import (
+	"encoding/base64"
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+	"net/http"
+	"strings"
+)
+
+// UrlCredentials are sent with requests to given hosts, e.g. to print pages behind login
+type UrlCredentials struct {
+	// "*.example.com" matches subdomains of example.com
+	Hosts   []string
+	Headers map[string]string
+	Cookies map[string]string
+	// Basic authentication, takes precedence over bearer token
+	Username    string
+	Password    string
+	BearerToken string
+}
+
+// Matches reports whether credentials are sent to the host
+func (c UrlCredentials) Matches(host string) bool {
+	return matchHost(host, c.Hosts)
+}
+
+// UrlAuth is a set of credentials, each of them is used only for its hosts
+type UrlAuth []UrlCredentials
+
+// header returns extra headers for host, except cookies
+func (auth UrlAuth) header(host string) http.Header {
+	header := http.Header{}
+
+	for _, c := range auth {
+		if !c.Matches(host) {
+			continue
+		}
+
+		if c.Username != "" {
+			credentials := base64.StdEncoding.EncodeToString([]byte(c.Username + ":" + c.Password))
+			header.Set("Authorization", "Basic "+credentials)
+		} else if c.BearerToken != "" {
+			header.Set("Authorization", "Bearer "+c.BearerToken)
+		}
+
+		for name, value := range c.Headers {
+			header.Set(name, value)
+		}
+	}
+
+	return header
+}
+
+func (auth UrlAuth) cookies(host string) []*http.Cookie {
+	var cookies []*http.Cookie
+
+	for _, c := range auth {
+		if !c.Matches(host) {
+			continue
+		}
+		for name, value := range c.Cookies {
+			cookies = append(cookies, &http.Cookie{Name: name, Value: value})
+		}
+	}
+
+	return cookies
+}
+
+// authTransport adds credentials to each request, including redirects, so they are never sent to other hosts
+type authTransport struct {
+	auth UrlAuth
+	next http.RoundTripper
+}
+
+func (t authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	header := t.auth.header(req.URL.Hostname())
+	cookies := t.auth.cookies(req.URL.Hostname())
+
+	if len(header) == 0 && len(cookies) == 0 {
+		return t.next.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+
+	return t.next.RoundTrip(req)
+}
+
+// setAuthCookies sets cookies in page context, so they are sent along with cookies set by pages.
+// Cookies of "*.example.com" hosts are set for example.com domain, so they are also sent to example.com itself
+func setAuthCookies(page *rod.Page, auth UrlAuth) error {
+	var cookies []*proto.NetworkCookieParam
+
+	for _, c := range auth {
+		for _, host := range c.Hosts {
+			for name, value := range c.Cookies {
+				cookie := &proto.NetworkCookieParam{Name: name, Value: value}
+				if domain, ok := strings.CutPrefix(host, "*."); ok {
+					cookie.Domain = domain
+				} else {
+					cookie.URL = "http://" + host + "/"
+				}
+				cookies = append(cookies, cookie)
+			}
+		}
+	}
+
+	// Empty list would clear cookies
+	if len(cookies) == 0 {
+		return nil
+	}
+
+	return page.SetCookies(cookies)
+}
+
+// authorizedRequest continues request as is, or with extra headers, if there are credentials for its host
+func authorizedRequest(e *proto.FetchRequestPaused, host string, auth UrlAuth) proto.FetchContinueRequest {
+	extra := auth.header(host)
+
+	if len(extra) == 0 {
+		return proto.FetchContinueRequest{RequestID: e.RequestID}
+	}
+
+	var headers []*proto.FetchHeaderEntry
+
+	for name, value := range e.Request.Headers {
+		if extra.Get(name) == "" {
+			headers = append(headers, &proto.FetchHeaderEntry{Name: name, Value: value.Str()})
+		}
+	}
+	for name := range extra {
+		headers = append(headers, &proto.FetchHeaderEntry{Name: name, Value: extra.Get(name)})
+	}
+
+	return proto.FetchContinueRequest{RequestID: e.RequestID, Headers: headers}
+}
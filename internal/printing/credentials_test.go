@@ -0,0 +1,73 @@
+package printing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUrlCredentialsMatches(t *testing.T) {
+	c := UrlCredentials{Hosts: []string{"intranet.example.com", "*.corp.example.com"}}
+
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{host: "intranet.example.com", want: true},
+		{host: "INTRANET.example.com", want: true},
+		{host: "eu.corp.example.com", want: true},
+		{host: "a.b.corp.example.com", want: true},
+		{host: "corp.example.com", want: false},
+		{host: "evilcorp.example.com", want: false},
+		{host: "intranet.example.com.attacker.example", want: false},
+		{host: "example.com", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := c.Matches(tt.host); got != tt.want {
+			t.Errorf("Matches(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestUrlAuthHeader(t *testing.T) {
+	auth := UrlAuth{
+		{Hosts: []string{"a.example"}, Username: "user", Password: "pass", BearerToken: "ignored"},
+		{Hosts: []string{"b.example"}, BearerToken: "token", Headers: map[string]string{"X-Tenant": "acme"}},
+	}
+
+	if got := auth.header("a.example").Get("Authorization"); got != "Basic dXNlcjpwYXNz" {
+		t.Errorf("unexpected basic authorization: %q", got)
+	}
+	if got := auth.header("b.example").Get("Authorization"); got != "Bearer token" {
+		t.Errorf("unexpected bearer authorization: %q", got)
+	}
+	if got := auth.header("b.example").Get("X-Tenant"); got != "acme" {
+		t.Errorf("unexpected header: %q", got)
+	}
+	if got := auth.header("c.example"); len(got) != 0 {
+		t.Errorf("unexpected headers for other host: %v", got)
+	}
+}
+
+func TestAuthTransport(t *testing.T) {
+	var received *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+	}))
+	defer server.Close()
+
+	auth := UrlAuth{{Hosts: []string{"127.0.0.1"}, BearerToken: "token", Cookies: map[string]string{"sid": "1"}}}
+	client := &http.Client{Transport: authTransport{auth: auth, next: http.DefaultTransport}}
+
+	resp, err := client.Get(server.URL)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+
+	if received.Header.Get("Authorization") != "Bearer token" || received.Header.Get("Cookie") != "sid=1" {
+		t.Errorf("credentials are not sent: %v", received.Header)
+	}
+}
@@ -0,0 +1,75 @@
+package printing
+
+import (
+	"github.com/go-rod/rod/lib/proto"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// htmlDocumentOrigin is never resolved, browser requests to it are served from HtmlDocument
+const htmlDocumentOrigin = "http://print-server.invalid/"
+
+// HtmlDocument is HTML page along with files it references by relative path, e.g. CSS files and images
+type HtmlDocument struct {
+	Html   []byte
+	Assets map[string][]byte
+}
+
+// HtmlRenderer loads HTML document in browser and converts it to PDF
+func HtmlRenderer(document HtmlDocument, options *proto.PagePrintToPDF, wait PageWait, browser *BrowserPool) JobRenderer {
+	return func() ([]byte, error) {
+		return htmlToPdf(document, options, wait, browser)
+	}
+}
+
+// htmlToPdf serves document at fake URL instead of using SetDocumentContent,
+// so relative links to assets are resolved as usual
+func htmlToPdf(document HtmlDocument, options *proto.PagePrintToPDF, wait PageWait, browser *BrowserPool) ([]byte, error) {
+	page, release, err := browser.page()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	interceptor, err := interceptRequests(page, browser.policy, nil, &document)
+	if err != nil {
+		return nil, err
+	}
+	defer interceptor.stop()
+
+	return pageToPdf(page, htmlDocumentOrigin+"index.html", options, wait)
+}
+
+func serveHtmlDocument(e *proto.FetchRequestPaused, document HtmlDocument) proto.FetchFulfillRequest {
+	u, _ := url.Parse(e.Request.URL)
+	name := strings.TrimPrefix(u.Path, "/")
+
+	if name == "index.html" {
+		return htmlDocumentResponse(e, "text/html; charset=utf-8", document.Html)
+	}
+
+	asset, ok := document.Assets[name]
+
+	if !ok {
+		return proto.FetchFulfillRequest{RequestID: e.RequestID, ResponseCode: http.StatusNotFound}
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = http.DetectContentType(asset)
+	}
+
+	return htmlDocumentResponse(e, contentType, asset)
+}
+
+func htmlDocumentResponse(e *proto.FetchRequestPaused, contentType string, body []byte) proto.FetchFulfillRequest {
+	return proto.FetchFulfillRequest{
+		RequestID:       e.RequestID,
+		ResponseCode:    http.StatusOK,
+		ResponseHeaders: []*proto.FetchHeaderEntry{{Name: "Content-Type", Value: contentType}},
+		Body:            body,
+	}
+}
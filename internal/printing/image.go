@@ -0,0 +1,167 @@
+package printing
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/go-pdf/fpdf"
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+const (
+	ImageScaleFit        = "fit"
+	ImageScaleFill       = "fill"
+	ImageScaleActualSize = "actual-size"
+)
+
+// Larger images are most likely decompression bombs, decoded RGBA image of this size takes 400 MB
+const maxImagePixels = 100_000_000
+
+// ImageLayout describes how image is placed on the page
+type ImageLayout struct {
+	PageLayout
+	// fit shows the whole image, fill covers the whole printable area cropping the image,
+	// actual-size uses DPI. Image is centered in all cases
+	Scale string
+	Dpi   float64
+	// Clockwise, multiple of 90 degrees
+	Rotate int
+}
+
+// CheckImage reports unsupported image formats and too large images without decoding the whole image
+func CheckImage(data []byte) error {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+
+	if err != nil {
+		return fmt.Errorf("%w: unsupported image: %w", ErrRequestError, err)
+	}
+
+	// Sides are checked separately, so their product can't overflow
+	if config.Width <= 0 || config.Height <= 0 ||
+		config.Width > maxImagePixels || config.Height > maxImagePixels/config.Width {
+		return fmt.Errorf("%w: image size %dx%d is too large", ErrRequestError, config.Width, config.Height)
+	}
+
+	return nil
+}
+
+// decodeImage checks image size before decoding it
+func decodeImage(data []byte) (image.Image, string, error) {
+	if err := CheckImage(data); err != nil {
+		return nil, "", err
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: unsupported image: %w", ErrRequestError, err)
+	}
+
+	return img, format, nil
+}
+
+// ImageRenderer places image on a single page according to layout
+func ImageRenderer(data []byte, layout ImageLayout) JobRenderer {
+	return func() ([]byte, error) {
+		return imageToPdf(data, layout)
+	}
+}
+
+func imageToPdf(data []byte, layout ImageLayout) ([]byte, error) {
+	img, format, err := decodeImage(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	img = rotateImage(img, layout.Rotate)
+
+	page, area, err := layout.printableArea()
+
+	if err != nil {
+		return nil, err
+	}
+
+	imgWidth := float64(img.Bounds().Dx())
+	imgHeight := float64(img.Bounds().Dy())
+
+	var scale float64
+
+	switch layout.Scale {
+	case ImageScaleFill:
+		scale = max(area.W/imgWidth, area.H/imgHeight)
+	case ImageScaleActualSize:
+		scale = 72 / layout.Dpi
+	default:
+		scale = min(area.W/imgWidth, area.H/imgHeight)
+	}
+
+	width := imgWidth * scale
+	height := imgHeight * scale
+
+	doc := fpdf.New("P", "pt", "A4", "")
+	doc.AddPageFormat("P", page)
+
+	// JPEG is embedded as is, unless it has to be rotated
+	if format == "jpeg" && layout.Rotate%360 == 0 {
+		doc.RegisterImageOptionsReader("image", fpdf.ImageOptions{ImageType: "JPG"}, bytes.NewReader(data))
+	} else if err := registerImage(doc, "image", img); err != nil {
+		return nil, err
+	}
+
+	doc.ClipRect(area.X, area.Y, area.W, area.H, false)
+	doc.ImageOptions(
+		"image",
+		area.X+(area.W-width)/2,
+		area.Y+(area.H-height)/2,
+		width,
+		height,
+		false,
+		fpdf.ImageOptions{AllowNegativePosition: true},
+		0,
+		"",
+	)
+	doc.ClipEnd()
+
+	return outputPdf(doc)
+}
+
+// rotateImage rotates clockwise by multiple of 90 degrees
+func rotateImage(img image.Image, degrees int) image.Image {
+	turns := (degrees/90%4 + 4) % 4
+
+	if turns == 0 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	var rotated *image.RGBA
+	if turns == 2 {
+		rotated = image.NewRGBA(image.Rect(0, 0, width, height))
+	} else {
+		rotated = image.NewRGBA(image.Rect(0, 0, height, width))
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := img.At(bounds.Min.X+x, bounds.Min.Y+y)
+			switch turns {
+			case 1:
+				rotated.Set(height-1-y, x, c)
+			case 2:
+				rotated.Set(width-1-x, height-1-y, c)
+			case 3:
+				rotated.Set(y, width-1-x, c)
+			}
+		}
+	}
+
+	return rotated
+}
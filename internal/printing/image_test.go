@@ -0,0 +1,68 @@
+package printing
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/gif"
+	"testing"
+)
+
+// gifImage encodes 1x1 image, then sets the size in its header, so image looks large without taking memory
+func gifImage(t *testing.T, width, height uint16) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := gif.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+	binary.LittleEndian.PutUint16(data[6:], width)
+	binary.LittleEndian.PutUint16(data[8:], height)
+	return data
+}
+
+func TestCheckImage(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{name: "small", data: gifImage(t, 1, 1)},
+		{name: "large", data: gifImage(t, 10000, 10000)},
+		{name: "too large", data: gifImage(t, 65535, 65535), wantErr: true},
+		{name: "too wide", data: gifImage(t, 65535, 2000), wantErr: true},
+		{name: "not image", data: []byte("%PDF-1.4"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckImage(tt.data)
+
+			if tt.wantErr && !errors.Is(err, ErrRequestError) {
+				t.Errorf("expected request error, got %v", err)
+			} else if !tt.wantErr && err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestImageToPdfRejectsLargeImage(t *testing.T) {
+	layout := ImageLayout{PageLayout: PageLayout{Paper: PaperSizes["letter"]}}
+
+	if _, err := imageToPdf(gifImage(t, 65535, 65535), layout); !errors.Is(err, ErrRequestError) {
+		t.Errorf("expected request error, got %v", err)
+	}
+
+	pdf, err := imageToPdf(gifImage(t, 1, 1), layout)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if CountPdfPages(pdf) != 1 {
+		t.Error("expected single page")
+	}
+}
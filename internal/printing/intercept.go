@@ -0,0 +1,120 @@
+package printing
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// pageInterceptor handles all requests of a page: serves HTML document at its fake origin, blocks URLs
+// not allowed by policy and adds credentials to the rest. Addresses are checked by browserProxy
+type pageInterceptor struct {
+	page     *rod.Page
+	policy   *UrlPolicy
+	auth     UrlAuth
+	document *HtmlDocument
+	cancel   context.CancelFunc
+
+	mu sync.Mutex
+	// Number of redirects before each request
+	redirects map[proto.FetchRequestID]int
+	// Reason why the first page was blocked, since the browser reports just ERR_BLOCKED_BY_CLIENT
+	blocked error
+}
+
+// interceptRequests starts handling page requests, document is optional
+func interceptRequests(page *rod.Page, policy *UrlPolicy, auth UrlAuth, document *HtmlDocument) (*pageInterceptor, error) {
+	if err := setAuthCookies(page, auth); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(page.GetContext())
+	i := &pageInterceptor{
+		page:      page.Context(ctx),
+		policy:    policy,
+		auth:      auth,
+		document:  document,
+		cancel:    cancel,
+		redirects: map[proto.FetchRequestID]int{},
+	}
+
+	err := proto.FetchEnable{Patterns: []*proto.FetchRequestPattern{{URLPattern: "*"}}}.Call(i.page)
+
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	wait := i.page.EachEvent(func(e *proto.FetchRequestPaused) {
+		go i.handle(e)
+	})
+	go wait()
+
+	return i, nil
+}
+
+func (i *pageInterceptor) stop() {
+	i.cancel()
+}
+
+// blockedError returns reason why the page was blocked, if it was
+func (i *pageInterceptor) blockedError() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.blocked
+}
+
+func (i *pageInterceptor) handle(e *proto.FetchRequestPaused) {
+	if i.document != nil && strings.HasPrefix(e.Request.URL, htmlDocumentOrigin) {
+		_ = serveHtmlDocument(e, *i.document).Call(i.page)
+		return
+	}
+
+	u, err := url.Parse(e.Request.URL)
+
+	if err == nil {
+		err = i.check(e, u)
+	}
+
+	if err != nil {
+		i.mu.Lock()
+		if i.blocked == nil && e.ResourceType == proto.NetworkResourceTypeDocument {
+			i.blocked = err
+		}
+		i.mu.Unlock()
+
+		_ = proto.FetchFailRequest{RequestID: e.RequestID, ErrorReason: proto.NetworkErrorReasonBlockedByClient}.Call(i.page)
+		return
+	}
+
+	_ = authorizedRequest(e, u.Hostname(), i.auth).Call(i.page)
+}
+
+func (i *pageInterceptor) check(e *proto.FetchRequestPaused, u *url.URL) error {
+	if err := i.policy.checkUrl(u); err != nil {
+		return err
+	}
+
+	if e.RedirectedRequestID != "" {
+		i.mu.Lock()
+		redirects := i.redirects[e.RedirectedRequestID] + 1
+		i.redirects[e.RequestID] = redirects
+		i.mu.Unlock()
+
+		if redirects > i.policy.maxRedirects {
+			return fmt.Errorf("%w: stopped after %d redirects", ErrUrlNotAllowed, i.policy.maxRedirects)
+		}
+	}
+
+	// Proxy blocks the connection anyway, but browser would report just a network error.
+	// Documents are checked in advance, so the reason is known
+	if e.ResourceType == proto.NetworkResourceTypeDocument {
+		return i.policy.checkHost(i.page.GetContext(), u.Hostname())
+	}
+
+	return nil
+}
@@ -0,0 +1,384 @@
+package printing
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+type JobState string
+
+const (
+	JobStateQueued    JobState = "queued"
+	JobStateRendering JobState = "rendering"
+	JobStateSpooling  JobState = "spooling"
+	JobStateCompleted JobState = "completed"
+	JobStateFailed    JobState = "failed"
+	JobStateCancelled JobState = "cancelled"
+)
+
+// JobStates lists all job states in order of job lifecycle
+var JobStates = []JobState{
+	JobStateQueued,
+	JobStateRendering,
+	JobStateSpooling,
+	JobStateCompleted,
+	JobStateFailed,
+	JobStateCancelled,
+}
+
+// JobErrorCode is set for failures clients may want to handle, e.g. retry with a longer timeout
+type JobErrorCode string
+
+const (
+	JobErrorRenderTimeout JobErrorCode = "render_timeout"
+	JobErrorInternal      JobErrorCode = "internal_error"
+)
+
+type JobSource string
+
+const (
+	JobSourceUpload   JobSource = "upload"
+	JobSourcePdfUrl   JobSource = "pdf-url"
+	JobSourcePageUrl  JobSource = "page-url"
+	JobSourceIPP      JobSource = "ipp"
+	JobSourceSocket   JobSource = "socket"
+	JobSourceLPD      JobSource = "lpd"
+	JobSourceImage    JobSource = "image"
+	JobSourceText     JobSource = "text"
+	JobSourceHtml     JobSource = "html"
+	JobSourceDocument JobSource = "document"
+	JobSourceRaw      JobSource = "raw"
+	JobSourceReceipt  JobSource = "receipt"
+	JobSourceTemplate JobSource = "template"
+	JobSourceBatch    JobSource = "batch"
+)
+
+const (
+	defaultJobWorkers   = 2
+	defaultJobQueueSize = 100
+)
+
+var ErrQueueFull = errors.New("print queue is full")
+var ErrQueueClosed = errors.New("print queue is closed")
+var ErrJobNotFound = errors.New("job not found")
+var ErrJobNotCancellable = errors.New("job can't be cancelled")
+var ErrDocumentNotRetained = errors.New("job document is not retained anymore")
+
+type Job struct {
+	ID       string    `json:"id"`
+	Printer  string    `json:"printer"`
+	Source   JobSource `json:"source"`
+	Url      string    `json:"url,omitempty"`
+	ClientIP string    `json:"clientIp,omitempty"`
+	User     string    `json:"user,omitempty"`
+	RetryOf  string    `json:"retryOf,omitempty"`
+
+	Options PrintOptions `json:"options"`
+	// Document is sent to printer as is, see Backend.PrintRaw
+	Raw bool `json:"raw,omitempty"`
+
+	// Known after the document is rendered
+	Pages int `json:"pages,omitempty"`
+	Size  int `json:"size,omitempty"`
+	// Job ID assigned by the OS print spooler, if it reports one
+	SpoolID string `json:"spoolId,omitempty"`
+
+	State      JobState     `json:"state"`
+	Error      string       `json:"error,omitempty"`
+	ErrorCode  JobErrorCode `json:"errorCode,omitempty"`
+	CreatedAt  time.Time    `json:"createdAt"`
+	StartedAt  *time.Time   `json:"startedAt,omitempty"`
+	FinishedAt *time.Time   `json:"finishedAt,omitempty"`
+}
+
+func (j Job) Finished() bool {
+	return j.State == JobStateCompleted || j.State == JobStateFailed || j.State == JobStateCancelled
+}
+
+// JobRenderer produces PDF document to be printed. It is called from a queue worker,
+// so it may take as long as needed
+type JobRenderer func() ([]byte, error)
+
+// PdfRenderer is used when PDF document is already available
+func PdfRenderer(data []byte) JobRenderer {
+	return func() ([]byte, error) {
+		return data, nil
+	}
+}
+
+// JobRequest describes a job to be submitted. Render is required, the rest is recorded in job history
+type JobRequest struct {
+	Printer  string
+	Source   JobSource
+	Url      string
+	ClientIP string
+	User     string
+	RetryOf  string
+	Options  PrintOptions
+	// Render produces printer-specific data instead of PDF
+	Raw    bool
+	Render JobRenderer
+}
+
+type queuedJob struct {
+	job    Job
+	render JobRenderer
+}
+
+// JobQueue accepts print jobs and processes them in background using fixed number of workers
+type JobQueue struct {
+	mu      sync.Mutex
+	backend Backend
+	store   *JobStore
+	// IDs of jobs cancelled while queued or rendering, workers drop them
+	cancelled map[string]bool
+
+	queue  chan queuedJob
+	wg     sync.WaitGroup
+	closed bool
+}
+
+// NewJobQueue creates queue and starts its workers. Zero values mean defaults.
+// Queue takes ownership of the store and closes it on Close
+func NewJobQueue(backend Backend, store *JobStore, workers int, size int) *JobQueue {
+	if workers <= 0 {
+		workers = defaultJobWorkers
+	}
+	if size <= 0 {
+		size = defaultJobQueueSize
+	}
+
+	q := &JobQueue{
+		backend:   backend,
+		store:     store,
+		cancelled: make(map[string]bool),
+		queue:     make(chan queuedJob, size),
+	}
+
+	for range workers {
+		q.wg.Add(1)
+		go q.work()
+	}
+
+	return q
+}
+
+// Submit adds job to the queue and returns immediately
+func (q *JobQueue) Submit(request JobRequest) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return Job{}, ErrQueueClosed
+	}
+
+	if err := q.backend.CheckPrintOptions(request.Printer, request.Options); err != nil {
+		return Job{}, err
+	}
+
+	if len(q.queue) == cap(q.queue) {
+		return Job{}, ErrQueueFull
+	}
+
+	job := Job{
+		ID:        uuid.Must(uuid.NewV7()).String(),
+		Printer:   request.Printer,
+		Source:    request.Source,
+		Url:       request.Url,
+		ClientIP:  request.ClientIP,
+		User:      request.User,
+		RetryOf:   request.RetryOf,
+		Options:   request.Options,
+		Raw:       request.Raw,
+		State:     JobStateQueued,
+		CreatedAt: time.Now(),
+	}
+
+	if err := q.store.Put(job); err != nil {
+		return Job{}, err
+	}
+
+	// Only Submit sends to the channel and it holds the lock, so there is enough space
+	q.queue <- queuedJob{job: job, render: request.Render}
+
+	return job, nil
+}
+
+func (q *JobQueue) Get(id string) (Job, error) {
+	return q.store.Get(id)
+}
+
+// List returns jobs matching the filter, newest first
+func (q *JobQueue) List(filter JobFilter) ([]Job, error) {
+	return q.store.List(filter)
+}
+
+// Cancel drops job if it is not sent to printer yet, otherwise cancels it in the OS print spooler
+func (q *JobQueue) Cancel(id string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, err := q.store.Get(id)
+
+	if err != nil {
+		return Job{}, err
+	}
+
+	switch job.State {
+	case JobStateQueued, JobStateRendering:
+		q.cancelled[id] = true
+	case JobStateCompleted:
+		if job.SpoolID == "" {
+			return Job{}, fmt.Errorf("%w: job is already sent to printer", ErrJobNotCancellable)
+		}
+		if err = q.backend.CancelPrintJob(job.SpoolID); err != nil {
+			return Job{}, err
+		}
+	default:
+		return Job{}, fmt.Errorf("%w: job is %s", ErrJobNotCancellable, job.State)
+	}
+
+	now := time.Now()
+	job.State = JobStateCancelled
+	job.FinishedAt = &now
+
+	if err = q.store.Put(job); err != nil {
+		return Job{}, err
+	}
+
+	return job, nil
+}
+
+// Retry submits document of existing job again. Empty printer means the same printer
+func (q *JobQueue) Retry(id string, printer string) (Job, error) {
+	job, err := q.store.Get(id)
+
+	if err != nil {
+		return Job{}, err
+	}
+
+	data, err := q.store.GetDocument(id)
+
+	if err != nil {
+		return Job{}, err
+	}
+
+	if printer == "" {
+		printer = job.Printer
+	}
+
+	return q.Submit(JobRequest{
+		Printer:  printer,
+		Source:   job.Source,
+		Url:      job.Url,
+		ClientIP: job.ClientIP,
+		User:     job.User,
+		RetryOf:  job.ID,
+		Options:  job.Options,
+		Raw:      job.Raw,
+		Render:   PdfRenderer(data),
+	})
+}
+
+// Close stops accepting new jobs and waits until already queued jobs are processed
+func (q *JobQueue) Close() error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return nil
+	}
+	q.closed = true
+	close(q.queue)
+	q.mu.Unlock()
+
+	q.wg.Wait()
+
+	return q.store.Close()
+}
+
+func (q *JobQueue) work() {
+	defer q.wg.Done()
+
+	for item := range q.queue {
+		q.process(item)
+	}
+}
+
+func (q *JobQueue) process(item queuedJob) {
+	job := item.job
+
+	// Jobs run outside of HTTP handlers, so panic in renderer or backend would crash the server
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("job %s panicked: %v\n%s", job.ID, r, debug.Stack())
+			finishedAt := time.Now()
+			job.FinishedAt = &finishedAt
+			job.Error = fmt.Sprintf("internal error: %v", r)
+			job.ErrorCode = JobErrorInternal
+			q.transition(&job, JobStateFailed)
+		}
+	}()
+
+	startedAt := time.Now()
+	job.StartedAt = &startedAt
+	if !q.transition(&job, JobStateRendering) {
+		return
+	}
+
+	data, err := item.render()
+
+	if err == nil {
+		job.Size = len(data)
+		if !job.Raw {
+			job.Pages = CountPdfPages(data)
+		}
+		if storeErr := q.store.PutDocument(job.ID, data); storeErr != nil {
+			log.Printf("error saving document of job %s: %s", job.ID, storeErr)
+		}
+		if !q.transition(&job, JobStateSpooling) {
+			return
+		}
+
+		if job.Raw {
+			job.SpoolID, err = q.backend.PrintRaw(job.Printer, bytes.NewReader(data))
+		} else {
+			job.SpoolID, err = q.backend.PrintPDF(job.Printer, bytes.NewReader(data), job.Options)
+		}
+	}
+
+	finishedAt := time.Now()
+	job.FinishedAt = &finishedAt
+	if err != nil {
+		log.Printf("job %s failed: %s", job.ID, err)
+		job.Error = err.Error()
+		if errors.Is(err, ErrRenderTimeout) {
+			job.ErrorCode = JobErrorRenderTimeout
+		}
+		q.transition(&job, JobStateFailed)
+	} else {
+		q.transition(&job, JobStateCompleted)
+	}
+}
+
+// transition saves job with the new state. Returns false if job was cancelled meanwhile
+func (q *JobQueue) transition(job *Job, state JobState) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.cancelled[job.ID] {
+		delete(q.cancelled, job.ID)
+		return false
+	}
+
+	job.State = state
+	if err := q.store.Put(*job); err != nil {
+		log.Printf("error saving job %s: %s", job.ID, err)
+	}
+	return true
+}
@@ -0,0 +1,277 @@
+package printing_test
+
+import (
+	"errors"
+	"fmt"
+	"github.com/downace/print-server/internal/appconfig"
+	"github.com/downace/print-server/internal/printing"
+	"github.com/downace/print-server/internal/printing/printingtest"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeBackend records printed documents, printing fails for printers listed in failing
+type fakeBackend struct {
+	mu      sync.Mutex
+	printed []string
+	failing map[string]bool
+}
+
+func (b *fakeBackend) ListPrinters() ([]printing.Printer, error) {
+	return []printing.Printer{{Name: "Printer"}}, nil
+}
+
+func (b *fakeBackend) GetPrinter(name string) (printing.PrinterDetails, error) {
+	return printing.PrinterDetails{Printer: printing.Printer{Name: name}}, nil
+}
+
+func (b *fakeBackend) CheckPrintOptions(string, printing.PrintOptions) error {
+	return nil
+}
+
+func (b *fakeBackend) PrintPDF(printer string, file io.Reader, _ printing.PrintOptions) (string, error) {
+	return b.print(printer, file)
+}
+
+func (b *fakeBackend) PrintRaw(printer string, file io.Reader) (string, error) {
+	return b.print(printer, file)
+}
+
+func (b *fakeBackend) print(printer string, file io.Reader) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failing[printer] {
+		return "", errors.New("printer is offline")
+	}
+
+	data, err := io.ReadAll(file)
+	b.printed = append(b.printed, string(data))
+	return "", err
+}
+
+func (b *fakeBackend) CancelPrintJob(string) error {
+	return nil
+}
+
+func TestJobQueueRecoversRendererPanic(t *testing.T) {
+	q := printingtest.NewJobQueue(t, &fakeBackend{})
+
+	job, err := q.Submit(printing.JobRequest{
+		Printer: "Printer",
+		Source:  printing.JobSourceUpload,
+		Render: func() ([]byte, error) {
+			panic("renderer bug")
+		},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job = printingtest.WaitFinished(t, q, job.ID)
+
+	if job.State != printing.JobStateFailed || !strings.Contains(job.Error, "renderer bug") || job.ErrorCode != printing.JobErrorInternal {
+		t.Errorf("expected failed job with panic message, got %s: %s", job.State, job.Error)
+	}
+
+	// Worker is still running
+	next, err := q.Submit(printing.JobRequest{Printer: "Printer", Source: printing.JobSourceUpload, Render: printing.PdfRenderer([]byte("doc"))})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next = printingtest.WaitFinished(t, q, next.ID); next.State != printing.JobStateCompleted {
+		t.Errorf("expected completed job, got %s: %s", next.State, next.Error)
+	}
+}
+
+func TestJobQueueRenderTimeoutErrorCode(t *testing.T) {
+	q := printingtest.NewJobQueue(t, &fakeBackend{})
+
+	job, err := q.Submit(printing.JobRequest{
+		Printer: "Printer",
+		Source:  printing.JobSourcePageUrl,
+		Render: func() ([]byte, error) {
+			return nil, fmt.Errorf("%w after 1s", printing.ErrRenderTimeout)
+		},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if job = printingtest.WaitFinished(t, q, job.ID); job.ErrorCode != printing.JobErrorRenderTimeout {
+		t.Errorf("expected render timeout error code, got %q: %s", job.ErrorCode, job.Error)
+	}
+}
+
+func TestJobQueueOfficeTimeoutErrorCode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake converter is a shell script")
+	}
+
+	// Fake soffice never finishes conversion
+	command := filepath.Join(t.TempDir(), "soffice")
+
+	if err := os.WriteFile(command, []byte("#!/bin/sh\nexec sleep 10\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	converter := printing.NewOfficeConverter(appconfig.OfficeConfig{Command: command, TimeoutSeconds: 1})
+	t.Cleanup(func() { _ = converter.Close() })
+	q := printingtest.NewJobQueue(t, &fakeBackend{})
+
+	job, err := q.Submit(printing.JobRequest{
+		Printer: "Printer",
+		Source:  printing.JobSourceUpload,
+		Render:  printing.DocumentRenderer([]byte(`{\rtf1}`), converter),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if job = printingtest.WaitFinished(t, q, job.ID); job.ErrorCode != printing.JobErrorRenderTimeout {
+		t.Errorf("expected render timeout error code, got %q: %s", job.ErrorCode, job.Error)
+	}
+}
+
+func TestJobQueueStates(t *testing.T) {
+	backend := &fakeBackend{failing: map[string]bool{"Offline": true}}
+	q := printingtest.NewJobQueue(t, backend)
+
+	completed, err := q.Submit(printing.JobRequest{Printer: "Printer", Source: printing.JobSourceUpload, Render: printing.PdfRenderer([]byte("doc"))})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if completed.State != printing.JobStateQueued {
+		t.Errorf("submitted job is %s", completed.State)
+	}
+
+	failed, err := q.Submit(printing.JobRequest{Printer: "Offline", Source: printing.JobSourceUpload, Render: printing.PdfRenderer([]byte("doc"))})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if completed = printingtest.WaitFinished(t, q, completed.ID); completed.State != printing.JobStateCompleted || completed.Size != 3 {
+		t.Errorf("expected completed job, got %s: %s", completed.State, completed.Error)
+	}
+	if completed.StartedAt == nil || completed.FinishedAt == nil {
+		t.Error("job times are not set")
+	}
+	if failed = printingtest.WaitFinished(t, q, failed.ID); failed.State != printing.JobStateFailed || failed.Error != "printer is offline" {
+		t.Errorf("expected failed job, got %s: %s", failed.State, failed.Error)
+	}
+
+	// Documents are retained even if printing fails, so jobs can be retried
+	if _, err := q.Retry(failed.ID, "Printer"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestJobQueueCancel(t *testing.T) {
+	backend := &fakeBackend{}
+	q := printingtest.NewJobQueue(t, backend)
+
+	rendering := make(chan struct{})
+	release := make(chan struct{})
+
+	job, err := q.Submit(printing.JobRequest{
+		Printer: "Printer",
+		Source:  printing.JobSourcePageUrl,
+		Render: func() ([]byte, error) {
+			close(rendering)
+			<-release
+			return []byte("page"), nil
+		},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	<-rendering
+
+	cancelled, err := q.Cancel(job.ID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancelled.State != printing.JobStateCancelled {
+		t.Errorf("cancelled job is %s", cancelled.State)
+	}
+
+	close(release)
+
+	// Next job is processed after the cancelled one, so the cancelled one is not printed
+	next, err := q.Submit(printing.JobRequest{Printer: "Printer", Source: printing.JobSourceUpload, Render: printing.PdfRenderer([]byte("doc"))})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	printingtest.WaitFinished(t, q, next.ID)
+
+	if job, _ = q.Get(job.ID); job.State != printing.JobStateCancelled {
+		t.Errorf("cancelled job is %s after rendering", job.State)
+	}
+
+	backend.mu.Lock()
+	printed := backend.printed
+	backend.mu.Unlock()
+
+	if len(printed) != 1 || printed[0] != "doc" {
+		t.Errorf("unexpected printed documents: %q", printed)
+	}
+
+	// Finished jobs without spool ID can't be cancelled
+	if _, err := q.Cancel(next.ID); !errors.Is(err, printing.ErrJobNotCancellable) {
+		t.Errorf("expected printing.ErrJobNotCancellable, got %v", err)
+	}
+	if _, err := q.Cancel("unknown"); !errors.Is(err, printing.ErrJobNotFound) {
+		t.Errorf("expected printing.ErrJobNotFound, got %v", err)
+	}
+}
+
+func TestJobQueueRetry(t *testing.T) {
+	backend := &fakeBackend{failing: map[string]bool{"Offline": true}}
+	store := printingtest.OpenJobStore(t)
+	q := printingtest.NewJobQueueWithStore(t, backend, store)
+
+	failed, err := q.Submit(printing.JobRequest{Printer: "Offline", Source: printing.JobSourceRaw, Raw: true, Render: printing.PdfRenderer([]byte("^XA^XZ"))})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	printingtest.WaitFinished(t, q, failed.ID)
+
+	retried, err := q.Retry(failed.ID, "Printer")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retried.RetryOf != failed.ID || retried.Printer != "Printer" || !retried.Raw || retried.Source != printing.JobSourceRaw {
+		t.Errorf("unexpected retried job: %+v", retried)
+	}
+
+	if retried = printingtest.WaitFinished(t, q, retried.ID); retried.State != printing.JobStateCompleted {
+		t.Errorf("expected completed job, got %s: %s", retried.State, retried.Error)
+	}
+
+	// Document is removed, e.g. by retention
+	if err := store.Put(printing.Job{ID: "no-document", Printer: "Printer", State: printing.JobStateFailed}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Retry("no-document", ""); !errors.Is(err, printing.ErrDocumentNotRetained) {
+		t.Errorf("expected printing.ErrDocumentNotRetained, got %v", err)
+	}
+}
@@ -0,0 +1,288 @@
+package printing
+
+import (
+	"bytes"
+	"encoding/json"
+	"go.etcd.io/bbolt"
+	"log"
+	"sync"
+	"time"
+)
+
+var jobsBucket = []byte("jobs")
+var documentsBucket = []byte("documents")
+
+const jobsCleanupInterval = time.Hour
+
+type JobFilter struct {
+	Printer string
+	State   JobState
+	Since   time.Time
+	Limit   int
+}
+
+func (f JobFilter) matches(job Job) bool {
+	if f.Printer != "" && job.Printer != f.Printer {
+		return false
+	}
+	if f.State != "" && job.State != f.State {
+		return false
+	}
+	return true
+}
+
+// JobStore keeps job history and printed documents in a bbolt database file.
+// Job IDs are time-ordered, so keys are sorted by creation time
+type JobStore struct {
+	db                *bbolt.DB
+	retention         time.Duration
+	documentRetention time.Duration
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// OpenJobStore opens (or creates) database file. Jobs finished more than retention ago are
+// removed periodically, zero retention means jobs are kept forever. Documents are removed
+// after documentRetention, zero means they are kept as long as their jobs.
+// Jobs left unfinished by the previous run are marked as failed
+func OpenJobStore(path string, retention time.Duration, documentRetention time.Duration) (*JobStore, error) {
+	db, err := bbolt.Open(path, 0o664, &bbolt.Options{Timeout: 5 * time.Second})
+
+	if err != nil {
+		return nil, err
+	}
+
+	s := &JobStore{
+		db:                db,
+		retention:         retention,
+		documentRetention: documentRetention,
+		stop:              make(chan struct{}),
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(jobsBucket)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists(documentsBucket)
+		return err
+	})
+
+	if err == nil {
+		err = s.failInterruptedJobs()
+	}
+
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	if retention > 0 || documentRetention > 0 {
+		s.wg.Add(1)
+		go s.cleanupPeriodically()
+	}
+
+	return s, nil
+}
+
+func (s *JobStore) Put(job Job) error {
+	data, err := json.Marshal(job)
+
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(jobsBucket).Put([]byte(job.ID), data)
+	})
+}
+
+func (s *JobStore) Get(id string) (Job, error) {
+	var job Job
+
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		data := tx.Bucket(jobsBucket).Get([]byte(id))
+		if data == nil {
+			return ErrJobNotFound
+		}
+		return json.Unmarshal(data, &job)
+	})
+
+	return job, err
+}
+
+func (s *JobStore) PutDocument(id string, data []byte) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(documentsBucket).Put([]byte(id), data)
+	})
+}
+
+// GetDocument returns ErrDocumentNotRetained if document was already removed
+func (s *JobStore) GetDocument(id string) ([]byte, error) {
+	var data []byte
+
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		stored := tx.Bucket(documentsBucket).Get([]byte(id))
+		if stored == nil {
+			return ErrDocumentNotRetained
+		}
+		// Stored value is only valid during transaction
+		data = bytes.Clone(stored)
+		return nil
+	})
+
+	return data, err
+}
+
+// List returns jobs matching the filter, newest first
+func (s *JobStore) List(filter JobFilter) ([]Job, error) {
+	jobs := make([]Job, 0)
+
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(jobsBucket).Cursor()
+
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var job Job
+			if err := json.Unmarshal(v, &job); err != nil {
+				return err
+			}
+			if job.CreatedAt.Before(filter.Since) {
+				break
+			}
+			if !filter.matches(job) {
+				continue
+			}
+			jobs = append(jobs, job)
+			if filter.Limit > 0 && len(jobs) >= filter.Limit {
+				break
+			}
+		}
+		return nil
+	})
+
+	return jobs, err
+}
+
+func (s *JobStore) Close() error {
+	close(s.stop)
+	s.wg.Wait()
+
+	return s.db.Close()
+}
+
+func (s *JobStore) failInterruptedJobs() error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(jobsBucket)
+
+		return b.ForEach(func(k, v []byte) error {
+			var job Job
+			if err := json.Unmarshal(v, &job); err != nil {
+				return err
+			}
+			if job.Finished() {
+				return nil
+			}
+			now := time.Now()
+			job.State = JobStateFailed
+			job.Error = "interrupted by server shutdown"
+			job.FinishedAt = &now
+
+			data, err := json.Marshal(job)
+			if err != nil {
+				return err
+			}
+			return b.Put(k, data)
+		})
+	})
+}
+
+func (s *JobStore) cleanupPeriodically() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(jobsCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.removeExpired(); err != nil {
+			log.Printf("error removing expired jobs: %s", err)
+		}
+
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *JobStore) removeExpired() error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		if s.retention > 0 {
+			err := removeExpiredKeys(tx, jobsBucket, time.Now().Add(-s.retention))
+			if err != nil {
+				return err
+			}
+		}
+		// Documents must not outlive their jobs
+		if err := removeOrphanDocuments(tx); err != nil {
+			return err
+		}
+		if s.documentRetention > 0 {
+			return removeExpiredKeys(tx, documentsBucket, time.Now().Add(-s.documentRetention))
+		}
+		return nil
+	})
+}
+
+// removeExpiredKeys removes items of jobs finished before expireBefore.
+// Both buckets use job IDs as keys
+func removeExpiredKeys(tx *bbolt.Tx, bucket []byte, expireBefore time.Time) error {
+	b := tx.Bucket(bucket)
+	jobs := tx.Bucket(jobsBucket)
+	c := b.Cursor()
+
+	var expiredKeys [][]byte
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		var job Job
+		if err := json.Unmarshal(jobs.Get(k), &job); err != nil {
+			return err
+		}
+		if !job.CreatedAt.Before(expireBefore) {
+			break
+		}
+		if job.Finished() && job.FinishedAt.Before(expireBefore) {
+			expiredKeys = append(expiredKeys, k)
+		}
+	}
+
+	for _, k := range expiredKeys {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func removeOrphanDocuments(tx *bbolt.Tx) error {
+	documents := tx.Bucket(documentsBucket)
+	jobs := tx.Bucket(jobsBucket)
+
+	var orphanKeys [][]byte
+	err := documents.ForEach(func(k, _ []byte) error {
+		if jobs.Get(k) == nil {
+			orphanKeys = append(orphanKeys, k)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, k := range orphanKeys {
+		if err := documents.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
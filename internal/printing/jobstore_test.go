@@ -0,0 +1,166 @@
+package printing
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestJobStore(t *testing.T, path string, retention, documentRetention time.Duration) *JobStore {
+	t.Helper()
+
+	store, err := OpenJobStore(path, retention, documentRetention)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return store
+}
+
+func TestJobStoreRemovesExpired(t *testing.T) {
+	store := openTestJobStore(t, filepath.Join(t.TempDir(), "jobs.db"), 24*time.Hour, time.Hour)
+	defer store.Close()
+
+	now := time.Now()
+	ago := func(d time.Duration) *time.Time {
+		at := now.Add(-d)
+		return &at
+	}
+
+	// IDs are in order of creation, like time-ordered UUIDs
+	jobs := []Job{
+		{ID: "1", State: JobStateCompleted, CreatedAt: *ago(72 * time.Hour), FinishedAt: ago(72 * time.Hour)},
+		{ID: "2", State: JobStateFailed, CreatedAt: *ago(48 * time.Hour), FinishedAt: ago(48 * time.Hour)},
+		{ID: "3", State: JobStateQueued, CreatedAt: *ago(30 * time.Hour)},
+		{ID: "4", State: JobStateCompleted, CreatedAt: *ago(2 * time.Hour), FinishedAt: ago(2 * time.Hour)},
+		{ID: "5", State: JobStateCompleted, CreatedAt: *ago(time.Minute), FinishedAt: ago(time.Minute)},
+	}
+
+	for _, job := range jobs {
+		if err := store.Put(job); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.PutDocument(job.ID, []byte("doc")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := store.removeExpired(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		id           string
+		jobKept      bool
+		documentKept bool
+	}{
+		{id: "1", jobKept: false, documentKept: false},
+		{id: "2", jobKept: false, documentKept: false},
+		// Unfinished jobs are never removed
+		{id: "3", jobKept: true, documentKept: true},
+		{id: "4", jobKept: true, documentKept: false},
+		{id: "5", jobKept: true, documentKept: true},
+	}
+
+	for _, tt := range tests {
+		_, err := store.Get(tt.id)
+		if jobKept := err == nil; jobKept != tt.jobKept {
+			t.Errorf("job %s: kept %v, want %v (%v)", tt.id, jobKept, tt.jobKept, err)
+		}
+
+		_, err = store.GetDocument(tt.id)
+		if documentKept := err == nil; documentKept != tt.documentKept {
+			t.Errorf("document %s: kept %v, want %v (%v)", tt.id, documentKept, tt.documentKept, err)
+		}
+		if err != nil && !errors.Is(err, ErrDocumentNotRetained) {
+			t.Errorf("document %s: unexpected error %v", tt.id, err)
+		}
+	}
+}
+
+func TestJobStoreFailsInterruptedJobs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.db")
+
+	store := openTestJobStore(t, path, 0, 0)
+	for _, job := range []Job{
+		{ID: "1", State: JobStateSpooling, CreatedAt: time.Now()},
+		{ID: "2", State: JobStateCompleted, CreatedAt: time.Now()},
+	} {
+		if err := store.Put(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = store.Close()
+
+	store = openTestJobStore(t, path, 0, 0)
+	defer store.Close()
+
+	interrupted, err := store.Get("1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if interrupted.State != JobStateFailed || interrupted.FinishedAt == nil {
+		t.Errorf("interrupted job is %s", interrupted.State)
+	}
+
+	if completed, _ := store.Get("2"); completed.State != JobStateCompleted {
+		t.Errorf("completed job is %s", completed.State)
+	}
+}
+
+func TestJobStoreList(t *testing.T) {
+	store := openTestJobStore(t, filepath.Join(t.TempDir(), "jobs.db"), 0, 0)
+	defer store.Close()
+
+	start := time.Now()
+	for i, job := range []Job{
+		{ID: "1", Printer: "A", State: JobStateCompleted},
+		{ID: "2", Printer: "B", State: JobStateFailed},
+		{ID: "3", Printer: "A", State: JobStateFailed},
+		{ID: "4", Printer: "A", State: JobStateCancelled},
+	} {
+		job.CreatedAt = start.Add(time.Duration(i) * time.Minute)
+		if err := store.Put(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter JobFilter
+		want   []string
+	}{
+		{name: "all", filter: JobFilter{}, want: []string{"4", "3", "2", "1"}},
+		{name: "printer", filter: JobFilter{Printer: "A"}, want: []string{"4", "3", "1"}},
+		{name: "state", filter: JobFilter{State: JobStateFailed}, want: []string{"3", "2"}},
+		{name: "since", filter: JobFilter{Since: start.Add(90 * time.Second)}, want: []string{"4", "3"}},
+		{name: "limit", filter: JobFilter{Printer: "A", Limit: 2}, want: []string{"4", "3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs, err := store.List(tt.filter)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var ids []string
+			for _, job := range jobs {
+				ids = append(ids, job.ID)
+			}
+
+			if len(ids) != len(tt.want) {
+				t.Fatalf("got %v, want %v", ids, tt.want)
+			}
+			for i := range ids {
+				if ids[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", ids, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,273 @@
+package printing
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/downace/print-server/internal/appconfig"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultOfficeCommand       = "soffice"
+	defaultOfficeTimeout       = 2 * time.Minute
+	defaultOfficeMaxConcurrent = 2
+)
+
+var ErrUnsupportedDocument = fmt.Errorf("%w: unsupported document format", ErrRequestError)
+
+// OfficeConverter converts office documents to PDF using headless LibreOffice
+type OfficeConverter struct {
+	command string
+	timeout time.Duration
+	// Each running conversion takes a slot, slots have separate LibreOffice profiles,
+	// since one profile can't be used by several LibreOffice processes
+	slots chan int
+
+	mu sync.Mutex
+	// Private temporary directory with profiles, created on first use
+	profilesDir string
+	closed      bool
+}
+
+func NewOfficeConverter(config appconfig.OfficeConfig) *OfficeConverter {
+	command := config.Command
+	if command == "" {
+		command = defaultOfficeCommand
+	}
+	timeout := time.Duration(config.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = defaultOfficeTimeout
+	}
+	maxConcurrent := config.MaxConcurrent
+	if maxConcurrent <= 0 {
+		maxConcurrent = defaultOfficeMaxConcurrent
+	}
+
+	slots := make(chan int, maxConcurrent)
+	for i := range maxConcurrent {
+		slots <- i
+	}
+
+	return &OfficeConverter{command: command, timeout: timeout, slots: slots}
+}
+
+// DocumentRenderer prints PDF as is and converts office documents to PDF
+func DocumentRenderer(data []byte, converter *OfficeConverter) JobRenderer {
+	return func() ([]byte, error) {
+		return documentToPdf(data, converter)
+	}
+}
+
+func documentToPdf(data []byte, converter *OfficeConverter) ([]byte, error) {
+	if IsPdf(data) {
+		return data, nil
+	}
+
+	if ext := OfficeDocumentType(data); ext != "" {
+		return converter.convert(data, ext)
+	}
+
+	return nil, ErrUnsupportedDocument
+}
+
+// OfficeDocumentType detects office document by its content and returns its usual extension,
+// or empty string if data is not an office document
+func OfficeDocumentType(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		return zipDocumentType(data)
+	case bytes.HasPrefix(data, []byte("\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1")):
+		return compoundDocumentType(data)
+	case bytes.HasPrefix(data, []byte(`{\rtf`)):
+		return "rtf"
+	}
+	return ""
+}
+
+// zipDocumentType detects OpenDocument and Office Open XML formats
+func zipDocumentType(data []byte) string {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+
+	if err != nil {
+		return ""
+	}
+
+	odfTypes := map[string]string{
+		"application/vnd.oasis.opendocument.text":         "odt",
+		"application/vnd.oasis.opendocument.spreadsheet":  "ods",
+		"application/vnd.oasis.opendocument.presentation": "odp",
+		"application/vnd.oasis.opendocument.graphics":     "odg",
+	}
+	ooxmlTypes := map[string]string{
+		"word/document.xml":    "docx",
+		"xl/workbook.xml":      "xlsx",
+		"xl/workbook.bin":      "xlsb",
+		"ppt/presentation.xml": "pptx",
+	}
+
+	for _, file := range archive.File {
+		if file.Name == "mimetype" {
+			// It is stored uncompressed as the first file, see OpenDocument spec
+			f, err := file.Open()
+			if err != nil {
+				return ""
+			}
+			var mimetype bytes.Buffer
+			_, err = mimetype.ReadFrom(f)
+			_ = f.Close()
+			if err != nil {
+				return ""
+			}
+			return odfTypes[mimetype.String()]
+		}
+		if ext, ok := ooxmlTypes[file.Name]; ok {
+			return ext
+		}
+	}
+
+	return ""
+}
+
+// compoundDocumentType detects legacy binary formats by names of their streams, which are stored in UTF-16
+func compoundDocumentType(data []byte) string {
+	streams := []struct{ name, ext string }{
+		{"WordDocument", "doc"},
+		{"Workbook", "xls"},
+		{"Book", "xls"},
+		{"PowerPoint Document", "ppt"},
+	}
+
+	for _, stream := range streams {
+		var utf16 []byte
+		for _, c := range []byte(stream.name) {
+			utf16 = append(utf16, c, 0)
+		}
+		if bytes.Contains(data, utf16) {
+			return stream.ext
+		}
+	}
+
+	return ""
+}
+
+// profileDir returns directory of slot profile. Profiles are reused, since creating a profile takes time
+func (c *OfficeConverter) profileDir(slot int) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return "", ErrRendererClosed
+	}
+
+	if c.profilesDir == "" {
+		dir, err := os.MkdirTemp("", "print-server-office-profiles-*")
+		if err != nil {
+			return "", err
+		}
+		c.profilesDir = dir
+	}
+
+	return filepath.Join(c.profilesDir, strconv.Itoa(slot)), nil
+}
+
+// Close waits for running conversions and removes profiles. Converter can't be used after that
+func (c *OfficeConverter) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.mu.Unlock()
+
+	// Running conversions hold their slots. Slots are returned afterwards, so waiting conversions fail instead of blocking
+	for range cap(c.slots) {
+		slot := <-c.slots
+		defer func() { c.slots <- slot }()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.profilesDir == "" {
+		return nil
+	}
+
+	err := os.RemoveAll(c.profilesDir)
+	c.profilesDir = ""
+	return err
+}
+
+func (c *OfficeConverter) convert(data []byte, ext string) ([]byte, error) {
+	slot := <-c.slots
+	defer func() { c.slots <- slot }()
+
+	profileDir, err := c.profileDir(slot)
+
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp(os.TempDir(), "print-server-office-*")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "document."+ext)
+
+	if err := os.WriteFile(input, data, 0600); err != nil {
+		return nil, err
+	}
+
+	// Windows paths need leading slash, e.g. file:///C:/Users
+	profileUrl := url.URL{Scheme: "file", Path: "/" + strings.TrimPrefix(filepath.ToSlash(profileDir), "/")}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(
+		ctx,
+		c.command,
+		"-env:UserInstallation="+profileUrl.String(),
+		"--headless",
+		"--norestore",
+		"--convert-to",
+		"pdf",
+		"--outdir",
+		dir,
+		input,
+	)
+	// soffice may leave child process holding output pipes after being killed
+	cmd.WaitDelay = 5 * time.Second
+
+	_, err = execAndLogCommand(cmd)
+
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("%w: document conversion took more than %s", ErrRenderTimeout, c.timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// LibreOffice exits successfully even if document can't be loaded
+	pdf, err := os.ReadFile(filepath.Join(dir, "document.pdf"))
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: document could not be converted", ErrRequestError)
+	}
+
+	return pdf, err
+}
@@ -0,0 +1,154 @@
+package printing
+
+import (
+	"errors"
+	"github.com/downace/print-server/internal/appconfig"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestOfficeDocumentType(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{name: "rtf", data: []byte(`{\rtf1\ansi text}`), want: "rtf"},
+		{name: "doc", data: append([]byte("\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1"), "W\x00o\x00r\x00d\x00D\x00o\x00c\x00u\x00m\x00e\x00n\x00t\x00"...), want: "doc"},
+		{name: "pdf", data: []byte("%PDF-1.4"), want: ""},
+		{name: "invalid zip", data: []byte("PK\x03\x04"), want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := OfficeDocumentType(tt.data); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOfficeConverterProfiles(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake converter is a shell script")
+	}
+
+	// Fake soffice records profile URL and writes PDF to the output directory
+	dir := t.TempDir()
+	log := filepath.Join(dir, "profiles.log")
+	command := filepath.Join(dir, "soffice")
+	script := "#!/bin/sh\necho \"$1\" >> " + log + "\nprintf '%%PDF-1.4' > \"$7/document.pdf\"\n"
+
+	if err := os.WriteFile(command, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewOfficeConverter(appconfig.OfficeConfig{Command: command, MaxConcurrent: 1})
+
+	for range 2 {
+		pdf, err := c.convert([]byte(`{\rtf1}`), "rtf")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsPdf(pdf) {
+			t.Fatalf("unexpected output %q", pdf)
+		}
+	}
+
+	profilesDir := c.profilesDir
+	info, err := os.Stat(profilesDir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Errorf("profiles directory is accessible by other users: %s", info.Mode())
+	}
+
+	logged, err := os.ReadFile(log)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(logged)), "\n")
+	if len(lines) != 2 || lines[0] != lines[1] || !strings.Contains(lines[0], profilesDir) {
+		t.Errorf("profile is not reused in %s: %q", profilesDir, lines)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(profilesDir); !os.IsNotExist(err) {
+		t.Errorf("profiles directory is not removed: %v", err)
+	}
+}
+
+func TestOfficeConverterCloseWaitsForConversion(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake converter is a shell script")
+	}
+
+	// Fake soffice records its start and takes a while to convert
+	dir := t.TempDir()
+	log := filepath.Join(dir, "started.log")
+	command := filepath.Join(dir, "soffice")
+	script := "#!/bin/sh\necho $$ >> " + log + "\nsleep 1\nprintf '%%PDF-1.4' > \"$7/document.pdf\"\n"
+
+	if err := os.WriteFile(command, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewOfficeConverter(appconfig.OfficeConfig{Command: command, MaxConcurrent: 1})
+	done := make(chan error, 1)
+
+	go func() {
+		_, err := c.convert([]byte(`{\rtf1}`), "rtf")
+		done <- err
+	}()
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(log); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("conversion is not started")
+		}
+	}
+
+	c.mu.Lock()
+	profilesDir := c.profilesDir
+	c.mu.Unlock()
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Converter process has exited before Close returned
+	started, _ := os.ReadFile(log)
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(started)))
+	if process, err := os.FindProcess(pid); err == nil && process.Signal(syscall.Signal(0)) == nil {
+		t.Errorf("converter process %d is still running", pid)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("running conversion failed: %s", err)
+	}
+
+	if _, err := os.Stat(profilesDir); !os.IsNotExist(err) {
+		t.Errorf("profiles directory is not removed: %v", err)
+	}
+
+	if _, err := c.convert([]byte(`{\rtf1}`), "rtf"); !errors.Is(err, ErrRendererClosed) {
+		t.Errorf("expected ErrRendererClosed, got %v", err)
+	}
+
+	started, _ = os.ReadFile(log)
+	if lines := strings.Fields(string(started)); len(lines) != 1 {
+		t.Errorf("converter is started after Close: %q", lines)
+	}
+}
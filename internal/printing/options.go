@@ -0,0 +1,19 @@
+package printing
+
+// PrintOptions are passed to the OS print spooler. Zero values mean printer defaults
+type PrintOptions struct {
+	Copies int `json:"copies,omitempty"`
+	// one-sided, two-sided-long-edge or two-sided-short-edge
+	Sides string `json:"sides,omitempty"`
+	// color or monochrome
+	ColorMode string `json:"colorMode,omitempty"`
+	// Media size name, e.g. A4, Letter or 4x6
+	Media     string `json:"media,omitempty"`
+	InputTray string `json:"inputTray,omitempty"`
+	// Comma-separated pages and page ranges, e.g. 1-3,5
+	PageRanges string `json:"pageRanges,omitempty"`
+	FitToPage  bool   `json:"fitToPage,omitempty"`
+	// portrait or landscape
+	Orientation string `json:"orientation,omitempty"`
+	Collate     *bool  `json:"collate,omitempty"`
+}
@@ -0,0 +1,63 @@
+package printing
+
+import (
+	"fmt"
+	"github.com/go-pdf/fpdf"
+)
+
+// PaperSize is in inches, same as paper size in proto.PagePrintToPDF
+type PaperSize struct {
+	Width  float64
+	Height float64
+}
+
+// PaperSizes are paper sizes available by name when document is generated by print server
+var PaperSizes = map[string]PaperSize{
+	"a3":      {Width: 11.69, Height: 16.54},
+	"a4":      {Width: 8.27, Height: 11.69},
+	"a5":      {Width: 5.83, Height: 8.27},
+	"a6":      {Width: 4.13, Height: 5.83},
+	"letter":  {Width: 8.5, Height: 11},
+	"legal":   {Width: 8.5, Height: 14},
+	"tabloid": {Width: 11, Height: 17},
+	"4x6":     {Width: 4, Height: 6},
+}
+
+// Landscape swaps dimensions if needed, so width is greater than height
+func (s PaperSize) Landscape() PaperSize {
+	if s.Width < s.Height {
+		return PaperSize{Width: s.Height, Height: s.Width}
+	}
+	return s
+}
+
+// PageLayout describes pages of documents generated by print server. Sizes are in inches
+type PageLayout struct {
+	Paper        PaperSize
+	MarginTop    float64
+	MarginBottom float64
+	MarginLeft   float64
+	MarginRight  float64
+}
+
+// rect is position and size in points
+type rect struct {
+	X, Y, W, H float64
+}
+
+// printableArea returns page size and area inside margins in points
+func (l PageLayout) printableArea() (page fpdf.SizeType, area rect, err error) {
+	page = fpdf.SizeType{Wd: l.Paper.Width * 72, Ht: l.Paper.Height * 72}
+	area = rect{
+		X: l.MarginLeft * 72,
+		Y: l.MarginTop * 72,
+		W: page.Wd - (l.MarginLeft+l.MarginRight)*72,
+		H: page.Ht - (l.MarginTop+l.MarginBottom)*72,
+	}
+
+	if area.W <= 0 || area.H <= 0 {
+		return page, area, fmt.Errorf("%w: margins don't fit the paper", ErrRequestError)
+	}
+
+	return page, area, nil
+}
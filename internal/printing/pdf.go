@@ -0,0 +1,131 @@
+package printing
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/go-pdf/fpdf"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"image"
+	"image/png"
+	"io"
+)
+
+func init() {
+	// pdfcpu stores its config in user config dir by default, we don't need that
+	api.DisableConfigDir()
+}
+
+// CountPdfPages returns 0 if document can't be parsed
+func CountPdfPages(data []byte) int {
+	count, err := api.PageCount(bytes.NewReader(data), nil)
+	if err != nil {
+		return 0
+	}
+	return count
+}
+
+// MergeRenderer renders documents one by one and merges them into a single document, in the same order
+func MergeRenderer(renderers []JobRenderer) JobRenderer {
+	return func() ([]byte, error) {
+		documents := make([]io.ReadSeeker, 0, len(renderers))
+
+		for i, render := range renderers {
+			data, err := render()
+
+			if err != nil {
+				return nil, fmt.Errorf("document %d: %w", i+1, err)
+			}
+
+			documents = append(documents, bytes.NewReader(data))
+		}
+
+		if len(documents) == 1 {
+			return io.ReadAll(documents[0])
+		}
+
+		var result bytes.Buffer
+
+		if err := api.MergeRaw(documents, &result, false, nil); err != nil {
+			return nil, fmt.Errorf("%w: documents can't be merged: %w", ErrRequestError, err)
+		}
+
+		return result.Bytes(), nil
+	}
+}
+
+// imagePage is an image covering the whole page. Page size is in points
+type imagePage struct {
+	Image  image.Image
+	Width  float64
+	Height float64
+}
+
+// imagePdf adds images as pages one by one, so decoded images can be released right after
+type imagePdf struct {
+	doc   *fpdf.Fpdf
+	pages int
+}
+
+func newImagePdf() *imagePdf {
+	return &imagePdf{doc: fpdf.New("P", "pt", "A4", "")}
+}
+
+func (p *imagePdf) addPage(page imagePage) error {
+	name := fmt.Sprintf("page-%d", p.pages)
+	p.pages++
+
+	if err := registerImage(p.doc, name, page.Image); err != nil {
+		return err
+	}
+
+	p.doc.AddPageFormat("P", fpdf.SizeType{Wd: page.Width, Ht: page.Height})
+	p.doc.ImageOptions(name, 0, 0, page.Width, page.Height, false, fpdf.ImageOptions{}, 0, "")
+
+	return nil
+}
+
+func (p *imagePdf) output() ([]byte, error) {
+	return outputPdf(p.doc)
+}
+
+// imagesToPdf creates document with one page per image
+func imagesToPdf(pages []imagePage) ([]byte, error) {
+	doc := newImagePdf()
+
+	for _, page := range pages {
+		if err := doc.addPage(page); err != nil {
+			return nil, err
+		}
+	}
+
+	return doc.output()
+}
+
+func outputPdf(doc *fpdf.Fpdf) ([]byte, error) {
+	var result bytes.Buffer
+
+	if err := doc.Output(&result); err != nil {
+		return nil, err
+	}
+
+	return result.Bytes(), nil
+}
+
+// registerImage adds image to the document, so it can be placed using its name
+func registerImage(doc *fpdf.Fpdf, name string, img image.Image) error {
+	var encoded bytes.Buffer
+
+	// PNG is embedded into PDF almost as is and keeps the image lossless
+	if err := png.Encode(&encoded, img); err != nil {
+		return err
+	}
+
+	doc.RegisterImageOptionsReader(name, fpdf.ImageOptions{ImageType: "PNG"}, &encoded)
+
+	return doc.Error()
+}
+
+// IsPdf checks document signature
+func IsPdf(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("%PDF-"))
+}
@@ -1,102 +1,239 @@
 package printing
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/go-rod/rod"
 	"github.com/go-rod/rod/lib/proto"
+	"github.com/samber/lo"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/exec"
 	"runtime"
+	"time"
 )
 
 type Printer struct {
 	Name string `json:"name"`
 }
 
+type PrinterState string
+
+const (
+	PrinterStateIdle       PrinterState = "idle"
+	PrinterStateProcessing PrinterState = "processing"
+	PrinterStateStopped    PrinterState = "stopped"
+)
+
+type PrinterDetails struct {
+	Printer
+	State PrinterState `json:"state"`
+	// E.g. media-jam, toner-low, offline
+	StateReasons  []string `json:"stateReasons"`
+	AcceptingJobs bool     `json:"acceptingJobs"`
+	QueuedJobs    int      `json:"queuedJobs"`
+	IsDefault     bool     `json:"isDefault"`
+
+	// Values supported by PrintOptions
+	Media      []string `json:"media"`
+	InputTrays []string `json:"inputTrays"`
+	Duplex     bool     `json:"duplex"`
+	Color      bool     `json:"color"`
+}
+
 var ErrNotSupported = fmt.Errorf("method not supported on %s", runtime.GOOS)
 var ErrRequestError = fmt.Errorf("request error")
+var ErrPrinterNotFound = errors.New("printer not found")
+var ErrRenderTimeout = errors.New("render timed out")
+var ErrRendererClosed = errors.New("renderer is closed")
 
-var browserPage *rod.Page
-
-func PrintPDFFromUrl(printer string, url string) error {
-	resp, err := http.Get(url)
+// findPrinter returns ErrPrinterNotFound if there is no such printer
+func findPrinter(b Backend, name string) (Printer, error) {
+	printers, err := b.ListPrinters()
 
 	if err != nil {
-		return err
+		return Printer{}, err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("%w: response from URL was %s", ErrRequestError, resp.Status)
+	printer, ok := lo.Find(printers, func(p Printer) bool {
+		return p.Name == name
+	})
+
+	if !ok {
+		return Printer{}, fmt.Errorf("%w: %s", ErrPrinterNotFound, name)
 	}
 
-	contentType := resp.Header.Get("Content-Type")
-	if contentType != "application/pdf" {
-		return fmt.Errorf("%w: downloaded file is %s, expected %s", ErrRequestError, contentType, "application/pdf")
+	return printer, nil
+}
+
+// PdfUrlRenderer downloads PDF file from URL. Office documents are converted to PDF, if converter is set
+func PdfUrlRenderer(url string, auth UrlAuth, policy *UrlPolicy, converter *OfficeConverter) JobRenderer {
+	return func() ([]byte, error) {
+		return downloadPdf(url, auth, policy, converter)
 	}
+}
 
-	return PrintPDF(printer, resp.Body)
+const defaultRenderTimeout = time.Minute
+
+// PageWait sets when page is ready to be printed. Page is always printed after it is loaded
+type PageWait struct {
+	// Max time of loading and printing the page, 0 means default
+	Timeout time.Duration
+	// Wait until there are no network requests for a while, e.g. until page loads its data
+	NetworkIdle bool
+	// Wait until element matching CSS selector appears
+	Selector string
+	// Wait until JS expression is truthy
+	Expression string
+	// Extra delay after all other conditions are met
+	Delay time.Duration
 }
 
-func PrintFromUrl(printer string, url string, options *proto.PagePrintToPDF) error {
-	pdfFile, err := urlToPdf(url, options)
+// PageUrlRenderer loads URL in browser and converts the page to PDF
+func PageUrlRenderer(url string, options *proto.PagePrintToPDF, wait PageWait, auth UrlAuth, browser *BrowserPool) JobRenderer {
+	return func() ([]byte, error) {
+		return urlToPdf(url, options, wait, auth, browser)
+	}
+}
+
+func downloadPdf(url string, auth UrlAuth, policy *UrlPolicy, converter *OfficeConverter) ([]byte, error) {
+	if err := policy.Check(context.Background(), url); err != nil {
+		return nil, err
+	}
+
+	resp, err := policy.httpClient(auth).Get(url)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return PrintPDF(printer, pdfFile)
-}
+	defer resp.Body.Close()
 
-func initBrowserPage() (*rod.Page, error) {
-	if browserPage != nil {
-		return browserPage, nil
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: response from URL was %s", ErrRequestError, resp.Status)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "application/pdf" {
+		return io.ReadAll(resp.Body)
 	}
-	browser := rod.New()
 
-	err := browser.Connect()
+	if converter != nil {
+		data, err := io.ReadAll(resp.Body)
 
+		if err != nil {
+			return nil, err
+		}
+
+		if ext := OfficeDocumentType(data); ext != "" {
+			return converter.convert(data, ext)
+		}
+	}
+
+	return nil, fmt.Errorf("%w: downloaded file is %s, expected %s", ErrRequestError, contentType, "application/pdf")
+}
+
+func urlToPdf(url string, options *proto.PagePrintToPDF, wait PageWait, auth UrlAuth, browser *BrowserPool) ([]byte, error) {
+	page, release, err := browser.page()
 	if err != nil {
 		return nil, err
 	}
+	defer release()
+
+	if err := browser.policy.Check(page.GetContext(), url); err != nil {
+		return nil, err
+	}
 
-	page, err := browser.Page(proto.TargetCreateTarget{})
+	interceptor, err := interceptRequests(page, browser.policy, auth, nil)
 	if err != nil {
 		return nil, err
 	}
+	defer interceptor.stop()
+
+	pdf, err := pageToPdf(page, url, options, wait)
+
+	if blocked := interceptor.blockedError(); err != nil && blocked != nil {
+		return nil, blocked
+	}
 
-	browserPage = page
-	return page, nil
+	return pdf, err
 }
 
-func urlToPdf(url string, options *proto.PagePrintToPDF) (pdfFile io.Reader, err error) {
-	page, err := initBrowserPage()
-	if err != nil {
-		return
+// pageToPdf navigates page to URL and converts it to PDF, ErrRenderTimeout is returned if it takes too long
+func pageToPdf(page *rod.Page, url string, options *proto.PagePrintToPDF, wait PageWait) ([]byte, error) {
+	timeout := wait.Timeout
+	if timeout <= 0 {
+		timeout = defaultRenderTimeout
+	}
+
+	page = page.Timeout(timeout)
+	defer page.CancelTimeout()
+
+	pdf, err := loadAndPrintPage(page, url, options, wait)
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, fmt.Errorf("%w after %s", ErrRenderTimeout, timeout)
 	}
 
+	return pdf, err
+}
+
+// loadAndPrintPage reads PDF before returning, since it is streamed from the page
+func loadAndPrintPage(page *rod.Page, url string, options *proto.PagePrintToPDF, wait PageWait) ([]byte, error) {
 	responseReceivedEvent := proto.NetworkResponseReceived{}
 	waitResponse := page.WaitEvent(&responseReceivedEvent)
-	err = page.Navigate(url)
+	// Idle time is counted from the start, so it has to be set up before navigation
+	waitIdle := func() {}
+	if wait.NetworkIdle {
+		waitIdle = page.WaitRequestIdle(500*time.Millisecond, nil, nil, nil)
+	}
+
+	err := page.Navigate(url)
 	if err != nil {
-		return
+		return nil, err
 	}
 	waitResponse()
 
 	if resp := responseReceivedEvent.Response; resp.Status >= 300 {
-		err = fmt.Errorf("%w: response from URL was %d %s", ErrRequestError, resp.Status, resp.StatusText)
-		return
+		return nil, fmt.Errorf("%w: response from URL was %d %s", ErrRequestError, resp.Status, resp.StatusText)
 	}
 
 	err = page.WaitLoad()
 	if err != nil {
-		return
+		return nil, err
 	}
 
-	pdfFile, err = page.PDF(options)
-	return pdfFile, err
+	waitIdle()
+
+	if wait.Selector != "" {
+		if _, err := page.Element(wait.Selector); err != nil {
+			return nil, err
+		}
+	}
+
+	if wait.Expression != "" {
+		if err := page.Wait(rod.Eval("() => Boolean(" + wait.Expression + ")")); err != nil {
+			return nil, err
+		}
+	}
+
+	if wait.Delay > 0 {
+		select {
+		case <-time.After(wait.Delay):
+		case <-page.GetContext().Done():
+			return nil, page.GetContext().Err()
+		}
+	}
+
+	pdfFile, err := page.PDF(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(pdfFile)
 }
 
 func execAndLogCommand(cmd *exec.Cmd) (output []byte, err error) {
@@ -107,17 +244,25 @@ func execAndLogCommand(cmd *exec.Cmd) (output []byte, err error) {
 	log.Printf("result: %q", output)
 
 	if err != nil {
+		if len(output) == 0 {
+			return nil, err
+		}
 		return nil, fmt.Errorf("%s", output)
 	}
 
 	return output, nil
 }
 
-func printPdfUsingCommand(printer string, file io.Reader, commandFactory func(printer string, filename string) *exec.Cmd) error {
-	tmpFile, err := os.CreateTemp(os.TempDir(), "print-server-*.pdf")
+func printPdfUsingCommand(printer string, file io.Reader, commandFactory func(printer string, filename string) *exec.Cmd) (output []byte, err error) {
+	return printFileUsingCommand(printer, file, "pdf", commandFactory)
+}
+
+// printFileUsingCommand saves file to temporary file with given extension and passes it to command
+func printFileUsingCommand(printer string, file io.Reader, ext string, commandFactory func(printer string, filename string) *exec.Cmd) (output []byte, err error) {
+	tmpFile, err := os.CreateTemp(os.TempDir(), "print-server-*."+ext)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	defer tmpFile.Close()
@@ -126,12 +271,10 @@ func printPdfUsingCommand(printer string, file io.Reader, commandFactory func(pr
 	_, err = io.Copy(tmpFile, file)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	cmd := commandFactory(printer, tmpFile.Name())
 
-	_, err = execAndLogCommand(cmd)
-
-	return err
+	return execAndLogCommand(cmd)
 }
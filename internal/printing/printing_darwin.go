@@ -2,13 +2,29 @@ package printing
 
 import (
 	"fmt"
-	"os"
+	"io"
 )
 
-func ListPrinters() ([]Printer, error) {
+func (systemBackend) ListPrinters() ([]Printer, error) {
 	return nil, fmt.Errorf("ListPrinters: %w", ErrNotSupported)
 }
 
-func PrintPDF(file os.File) error {
-	return nil, fmt.Errorf("PrintPDF: %w", ErrNotSupported)
+func (systemBackend) GetPrinter(_ string) (PrinterDetails, error) {
+	return PrinterDetails{}, fmt.Errorf("GetPrinter: %w", ErrNotSupported)
+}
+
+func (systemBackend) PrintPDF(_ string, _ io.Reader, _ PrintOptions) (string, error) {
+	return "", fmt.Errorf("PrintPDF: %w", ErrNotSupported)
+}
+
+func (systemBackend) PrintRaw(_ string, _ io.Reader) (string, error) {
+	return "", fmt.Errorf("PrintRaw: %w", ErrNotSupported)
+}
+
+func (systemBackend) CheckPrintOptions(_ string, _ PrintOptions) error {
+	return nil
+}
+
+func (systemBackend) CancelPrintJob(_ string) error {
+	return fmt.Errorf("CancelPrintJob: %w", ErrNotSupported)
 }
@@ -3,12 +3,15 @@ package printing
 import (
 	"github.com/samber/lo"
 	"io"
+	"os"
 	"os/exec"
+	"regexp"
 	"slices"
+	"strconv"
 	"strings"
 )
 
-func ListPrinters() ([]Printer, error) {
+func (systemBackend) ListPrinters() ([]Printer, error) {
 	cmd := exec.Command("lpstat", "-e")
 
 	output, err := execAndLogCommand(cmd)
@@ -22,8 +25,209 @@ func ListPrinters() ([]Printer, error) {
 	}), nil
 }
 
-func PrintPDF(printer string, file io.Reader) error {
-	return printPdfUsingCommand(printer, file, func(printer string, filename string) *exec.Cmd {
-		return exec.Command("lp", "-d", printer, filename)
+// cupsCommand forces English output, which is parsed then
+func cupsCommand(name string, args ...string) *exec.Cmd {
+	cmd := exec.Command(name, args...)
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	return cmd
+}
+
+func (b systemBackend) GetPrinter(name string) (PrinterDetails, error) {
+	printer, err := findPrinter(b, name)
+
+	if err != nil {
+		return PrinterDetails{}, err
+	}
+
+	details := PrinterDetails{
+		Printer:      printer,
+		StateReasons: make([]string, 0),
+		Media:        make([]string, 0),
+		InputTrays:   make([]string, 0),
+	}
+
+	output, err := execAndLogCommand(cupsCommand("lpstat", "-l", "-p", name))
+
+	if err != nil {
+		return PrinterDetails{}, err
+	}
+
+	details.State, details.StateReasons = parseLpstatPrinterState(string(output))
+
+	output, err = execAndLogCommand(cupsCommand("lpstat", "-a", name))
+
+	if err != nil {
+		return PrinterDetails{}, err
+	}
+
+	details.AcceptingJobs = !strings.Contains(string(output), "not accepting")
+
+	output, err = execAndLogCommand(cupsCommand("lpstat", "-o", name))
+
+	if err != nil {
+		return PrinterDetails{}, err
+	}
+
+	details.QueuedJobs = len(slices.Collect(strings.Lines(string(output))))
+
+	// Fails if there is no default destination, that's fine
+	output, _ = execAndLogCommand(cupsCommand("lpstat", "-d"))
+
+	details.IsDefault = strings.TrimSpace(string(output)) == "system default destination: "+name
+
+	output, err = execAndLogCommand(cupsCommand("lpoptions", "-p", name, "-l"))
+
+	if err != nil {
+		return PrinterDetails{}, err
+	}
+
+	for option, values := range parseLpoptions(string(output)) {
+		switch option {
+		case "PageSize", "media":
+			details.Media = values
+		case "InputSlot", "media-source":
+			details.InputTrays = values
+		case "Duplex", "sides":
+			details.Duplex = slices.ContainsFunc(values, func(v string) bool {
+				return v != "None" && v != "one-sided"
+			})
+		case "ColorModel", "print-color-mode":
+			details.Color = slices.ContainsFunc(values, func(v string) bool {
+				return v != "Gray" && v != "monochrome"
+			})
+		}
+	}
+
+	return details, nil
+}
+
+// parseLpstatPrinterState parses output of `lpstat -l -p`, e.g.
+//
+//	printer HP is idle.  enabled since Mon Jan  1 00:00:00 2024
+//		Alerts: media-empty-error toner-low
+func parseLpstatPrinterState(output string) (PrinterState, []string) {
+	state := PrinterStateIdle
+	reasons := make([]string, 0)
+
+	for i, line := range slices.Collect(strings.Lines(output)) {
+		if i == 0 {
+			if strings.Contains(line, "disabled") {
+				state = PrinterStateStopped
+			} else if strings.Contains(line, "now printing") {
+				state = PrinterStateProcessing
+			}
+			continue
+		}
+		alerts, found := strings.CutPrefix(strings.TrimSpace(line), "Alerts:")
+		if found {
+			reasons = append(reasons, lo.Without(strings.Fields(alerts), "none")...)
+		}
+	}
+
+	return state, reasons
+}
+
+// parseLpoptions parses output of `lpoptions -l`, e.g.
+//
+//	PageSize/Media Size: *A4 Letter Legal
+func parseLpoptions(output string) map[string][]string {
+	options := make(map[string][]string)
+
+	for line := range strings.Lines(output) {
+		key, values, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		name, _, _ := strings.Cut(key, "/")
+		options[name] = lo.Map(strings.Fields(values), func(v string, _ int) string {
+			return strings.TrimPrefix(v, "*")
+		})
+	}
+
+	return options
+}
+
+var lpRequestIdRegexp = regexp.MustCompile(`request id is (\S+)`)
+
+// PrintPDF returns CUPS job ID, e.g. "Brother_MFC_L2700DN_series-42"
+func (systemBackend) PrintPDF(printer string, file io.Reader, options PrintOptions) (string, error) {
+	output, err := printPdfUsingCommand(printer, file, func(printer string, filename string) *exec.Cmd {
+		args := append([]string{"-d", printer}, lpOptionArgs(options)...)
+		return cupsCommand("lp", append(args, filename)...)
 	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if match := lpRequestIdRegexp.FindSubmatch(output); match != nil {
+		return string(match[1]), nil
+	}
+
+	return "", nil
+}
+
+// PrintRaw uses raw queue option, so CUPS doesn't apply any filters
+func (systemBackend) PrintRaw(printer string, file io.Reader) (string, error) {
+	output, err := printFileUsingCommand(printer, file, "bin", func(printer string, filename string) *exec.Cmd {
+		return cupsCommand("lp", "-d", printer, "-o", "raw", filename)
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if match := lpRequestIdRegexp.FindSubmatch(output); match != nil {
+		return string(match[1]), nil
+	}
+
+	return "", nil
+}
+
+// CheckPrintOptions reports options which can't be applied on current platform
+func (systemBackend) CheckPrintOptions(_ string, _ PrintOptions) error {
+	return nil
+}
+
+func lpOptionArgs(options PrintOptions) []string {
+	var args []string
+
+	if options.Copies > 0 {
+		args = append(args, "-n", strconv.Itoa(options.Copies))
+	}
+	if options.PageRanges != "" {
+		args = append(args, "-P", options.PageRanges)
+	}
+	if options.Sides != "" {
+		args = append(args, "-o", "sides="+options.Sides)
+	}
+	if options.ColorMode != "" {
+		args = append(args, "-o", "print-color-mode="+options.ColorMode)
+	}
+	if options.Media != "" {
+		args = append(args, "-o", "media="+options.Media)
+	}
+	if options.InputTray != "" {
+		args = append(args, "-o", "media-source="+options.InputTray)
+	}
+	if options.FitToPage {
+		args = append(args, "-o", "fit-to-page")
+	}
+	switch options.Orientation {
+	case "portrait":
+		args = append(args, "-o", "orientation-requested=3")
+	case "landscape":
+		args = append(args, "-o", "orientation-requested=4")
+	}
+	if options.Collate != nil {
+		args = append(args, "-o", "collate="+strconv.FormatBool(*options.Collate))
+	}
+
+	return args
+}
+
+func (systemBackend) CancelPrintJob(spoolId string) error {
+	_, err := execAndLogCommand(exec.Command("cancel", spoolId))
+
+	return err
 }
@@ -0,0 +1,139 @@
+package printing
+
+import (
+	"github.com/samber/lo"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fakeLp puts lp script into PATH, which prints request ID only in C locale, like localized CUPS does
+func fakeLp(t *testing.T) {
+	t.Helper()
+
+	dir := t.TempDir()
+	script := "#!/bin/sh\n" +
+		"if [ \"$LC_ALL\" = C ]; then echo 'request id is Office-7 (1 file(s))'; else echo 'Anfrage-ID ist Office-7'; fi\n"
+
+	if err := os.WriteFile(filepath.Join(dir, "lp"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("LC_ALL", "de_DE.UTF-8")
+}
+
+func TestLpSpoolId(t *testing.T) {
+	fakeLp(t)
+
+	spoolId, err := systemBackend{}.PrintPDF("Office", strings.NewReader("%PDF-1.4"), PrintOptions{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spoolId != "Office-7" {
+		t.Errorf("PrintPDF: got spool ID %q, want Office-7", spoolId)
+	}
+
+	spoolId, err = systemBackend{}.PrintRaw("Office", strings.NewReader("^XA^XZ"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spoolId != "Office-7" {
+		t.Errorf("PrintRaw: got spool ID %q, want Office-7", spoolId)
+	}
+}
+
+func TestLpOptionArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		options PrintOptions
+		want    []string
+	}{
+		{name: "defaults", options: PrintOptions{}, want: nil},
+		{name: "copies and pages", options: PrintOptions{Copies: 2, PageRanges: "1-3,5"}, want: []string{"-n", "2", "-P", "1-3,5"}},
+		{
+			name:    "media",
+			options: PrintOptions{Sides: "two-sided-long-edge", ColorMode: "monochrome", Media: "A4", InputTray: "tray-2"},
+			want:    []string{"-o", "sides=two-sided-long-edge", "-o", "print-color-mode=monochrome", "-o", "media=A4", "-o", "media-source=tray-2"},
+		},
+		{name: "fit to page", options: PrintOptions{FitToPage: true}, want: []string{"-o", "fit-to-page"}},
+		{name: "portrait", options: PrintOptions{Orientation: "portrait"}, want: []string{"-o", "orientation-requested=3"}},
+		{name: "landscape", options: PrintOptions{Orientation: "landscape"}, want: []string{"-o", "orientation-requested=4"}},
+		{name: "collate", options: PrintOptions{Collate: lo.ToPtr(true)}, want: []string{"-o", "collate=true"}},
+		{name: "uncollated", options: PrintOptions{Collate: lo.ToPtr(false)}, want: []string{"-o", "collate=false"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lpOptionArgs(tt.options); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLpstatPrinterState(t *testing.T) {
+	tests := []struct {
+		name        string
+		output      string
+		wantState   PrinterState
+		wantReasons []string
+	}{
+		{
+			name:        "idle",
+			output:      "printer HP is idle.  enabled since Mon Jan  1 00:00:00 2024\n\tAlerts: none\n",
+			wantState:   PrinterStateIdle,
+			wantReasons: []string{},
+		},
+		{
+			name:        "printing",
+			output:      "printer HP now printing HP-42.  enabled since Mon Jan  1 00:00:00 2024\n\tAlerts: toner-low\n",
+			wantState:   PrinterStateProcessing,
+			wantReasons: []string{"toner-low"},
+		},
+		{
+			name:        "disabled",
+			output:      "printer HP disabled since Mon Jan  1 00:00:00 2024 -\n\tPaused\n\tAlerts: media-empty-error media-jam-error\n",
+			wantState:   PrinterStateStopped,
+			wantReasons: []string{"media-empty-error", "media-jam-error"},
+		},
+		{name: "empty", output: "", wantState: PrinterStateIdle, wantReasons: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, reasons := parseLpstatPrinterState(tt.output)
+
+			if state != tt.wantState {
+				t.Errorf("got state %s, want %s", state, tt.wantState)
+			}
+			if !slices.Equal(reasons, tt.wantReasons) {
+				t.Errorf("got reasons %q, want %q", reasons, tt.wantReasons)
+			}
+		})
+	}
+}
+
+func TestParseLpoptions(t *testing.T) {
+	output := "PageSize/Media Size: *A4 Letter Legal\n" +
+		"InputSlot/Media Source: Auto *Tray1 Tray2\n" +
+		"Duplex/2-Sided Printing: *None DuplexNoTumble\n" +
+		"invalid line\n" +
+		"ColorModel: Gray\n"
+
+	want := map[string][]string{
+		"PageSize":   {"A4", "Letter", "Legal"},
+		"InputSlot":  {"Auto", "Tray1", "Tray2"},
+		"Duplex":     {"None", "DuplexNoTumble"},
+		"ColorModel": {"Gray"},
+	}
+
+	if got := parseLpoptions(output); !maps.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
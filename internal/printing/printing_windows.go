@@ -4,18 +4,110 @@ import (
 	"bytes"
 	"embed"
 	"encoding/csv"
+	"fmt"
 	"github.com/downace/print-server/internal/common"
+	"github.com/samber/lo"
 	"io"
 	"os/exec"
 	"slices"
+	"strconv"
+	"strings"
 	"syscall"
+	"unsafe"
 )
 
 //go:embed SumatraPDF.exe
 var embedFs embed.FS
 
-func ListPrinters() ([]Printer, error) {
-	cmd := exec.Command("wmic", "printer", "list", "brief", "/format:csv")
+func (systemBackend) ListPrinters() ([]Printer, error) {
+	records, err := wmicQuery("printer", "list", "brief")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return lo.Map(records, func(record map[string]string, _ int) Printer {
+		return Printer{Name: record["Name"]}
+	}), nil
+}
+
+// See Win32_Printer class docs
+var wmicPrinterStatuses = map[string]PrinterState{
+	"3": PrinterStateIdle,
+	"4": PrinterStateProcessing,
+	"5": PrinterStateProcessing,
+	"6": PrinterStateStopped,
+	"7": PrinterStateStopped,
+}
+
+var wmicErrorStates = map[string]string{
+	"3":  "media-low",
+	"4":  "media-empty",
+	"5":  "toner-low",
+	"6":  "toner-empty",
+	"7":  "door-open",
+	"8":  "media-jam",
+	"9":  "offline",
+	"10": "service-requested",
+	"11": "output-area-full",
+}
+
+const wmicCapabilityColor = "4"
+const wmicCapabilityDuplex = "5"
+
+func (systemBackend) GetPrinter(name string) (PrinterDetails, error) {
+	printers, err := wmicQuery("printer", "get", "Name,Default,PrinterStatus,WorkOffline,DetectedErrorState,Capabilities,PrinterPaperNames")
+
+	if err != nil {
+		return PrinterDetails{}, err
+	}
+
+	record, ok := lo.Find(printers, func(record map[string]string) bool {
+		return record["Name"] == name
+	})
+
+	if !ok {
+		return PrinterDetails{}, fmt.Errorf("%w: %s", ErrPrinterNotFound, name)
+	}
+
+	jobs, err := wmicQuery("printjob", "get", "Name")
+
+	if err != nil {
+		return PrinterDetails{}, err
+	}
+
+	capabilities := parseWmicArray(record["Capabilities"])
+
+	details := PrinterDetails{
+		Printer:       Printer{Name: name},
+		State:         lo.ValueOr(wmicPrinterStatuses, record["PrinterStatus"], PrinterStateIdle),
+		StateReasons:  make([]string, 0),
+		AcceptingJobs: true,
+		// Print job name is "<printer>, <job ID>"
+		QueuedJobs: lo.CountBy(jobs, func(job map[string]string) bool {
+			return strings.HasPrefix(job["Name"], name+",")
+		}),
+		IsDefault:  record["Default"] == "TRUE",
+		Media:      parseWmicArray(record["PrinterPaperNames"]),
+		InputTrays: make([]string, 0),
+		Duplex:     slices.Contains(capabilities, wmicCapabilityDuplex),
+		Color:      slices.Contains(capabilities, wmicCapabilityColor),
+	}
+
+	if reason, ok := wmicErrorStates[record["DetectedErrorState"]]; ok {
+		details.StateReasons = append(details.StateReasons, reason)
+	}
+	if record["WorkOffline"] == "TRUE" {
+		details.State = PrinterStateStopped
+		details.StateReasons = append(details.StateReasons, "offline")
+	}
+
+	return details, nil
+}
+
+// wmicQuery runs wmic with CSV output and returns records as column name to value maps
+func wmicQuery(args ...string) ([]map[string]string, error) {
+	cmd := exec.Command("wmic", append(args, "/format:csv")...)
 	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
 
 	output, err := execAndLogCommand(cmd)
@@ -25,11 +117,10 @@ func ListPrinters() ([]Printer, error) {
 	}
 
 	c := csv.NewReader(common.NewNormalizedLinesReader(bytes.NewReader(output)))
-	c.ReuseRecord = true
 	c.TrimLeadingSpace = true
 
 	var headers []string = nil
-	var printers []Printer
+	var records []map[string]string
 
 	for {
 		record, err := c.Read()
@@ -37,26 +128,171 @@ func ListPrinters() ([]Printer, error) {
 			break
 		}
 		if headers == nil {
-			headers = make([]string, len(record))
-			copy(headers, record)
+			headers = record
 		} else {
-			namePos := slices.Index(headers, "Name")
-			name := record[namePos]
-			printers = append(printers, Printer{Name: name})
+			records = append(records, lo.Associate(lo.Range(min(len(headers), len(record))), func(i int) (string, string) {
+				return headers[i], record[i]
+			}))
 		}
 	}
 
-	return printers, nil
+	return records, nil
+}
+
+// parseWmicArray parses array value in wmic CSV output, e.g. {A4;Letter}
+func parseWmicArray(value string) []string {
+	value = strings.Trim(value, "{}")
+	if value == "" {
+		return make([]string, 0)
+	}
+	return strings.Split(value, ";")
 }
 
-func PrintPDF(printer string, file io.Reader) error {
+// PrintPDF returns empty job ID since SumatraPDF doesn't report it
+func (systemBackend) PrintPDF(printer string, file io.Reader, options PrintOptions) (string, error) {
+	settings, err := sumatraPrintSettings(options)
+
+	if err != nil {
+		return "", err
+	}
+
 	sumatra, err := common.MaterializeEmbeddedFile(embedFs, "SumatraPDF.exe")
 
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	return printPdfUsingCommand(printer, file, func(printer string, filename string) *exec.Cmd {
-		return exec.Command(sumatra, "-print-to", printer, "-silent", filename)
+	_, err = printPdfUsingCommand(printer, file, func(printer string, filename string) *exec.Cmd {
+		args := []string{"-print-to", printer, "-silent"}
+		if settings != "" {
+			args = append(args, "-print-settings", settings)
+		}
+		return exec.Command(sumatra, append(args, filename)...)
 	})
+
+	return "", err
+}
+
+// CheckPrintOptions reports options which can't be applied on current platform
+func (systemBackend) CheckPrintOptions(_ string, options PrintOptions) error {
+	_, err := sumatraPrintSettings(options)
+	return err
+}
+
+// See https://www.sumatrapdfreader.org/docs/Command-line-arguments
+func sumatraPrintSettings(options PrintOptions) (string, error) {
+	var settings []string
+
+	if options.Orientation != "" {
+		return "", fmt.Errorf("orientation option: %w", ErrNotSupported)
+	}
+	if options.Collate != nil {
+		return "", fmt.Errorf("collate option: %w", ErrNotSupported)
+	}
+
+	if options.PageRanges != "" {
+		settings = append(settings, options.PageRanges)
+	}
+	if options.Copies > 0 {
+		settings = append(settings, fmt.Sprintf("%dx", options.Copies))
+	}
+	switch options.Sides {
+	case "one-sided":
+		settings = append(settings, "simplex")
+	case "two-sided-long-edge":
+		settings = append(settings, "duplexlong")
+	case "two-sided-short-edge":
+		settings = append(settings, "duplexshort")
+	}
+	if options.ColorMode != "" {
+		settings = append(settings, options.ColorMode)
+	}
+	if options.Media != "" {
+		settings = append(settings, "paper="+options.Media)
+	}
+	if options.InputTray != "" {
+		settings = append(settings, "bin="+options.InputTray)
+	}
+	if options.FitToPage {
+		settings = append(settings, "fit")
+	}
+
+	return strings.Join(settings, ","), nil
+}
+
+var (
+	winspool             = syscall.NewLazyDLL("winspool.drv")
+	procOpenPrinter      = winspool.NewProc("OpenPrinterW")
+	procClosePrinter     = winspool.NewProc("ClosePrinter")
+	procStartDocPrinter  = winspool.NewProc("StartDocPrinterW")
+	procEndDocPrinter    = winspool.NewProc("EndDocPrinter")
+	procStartPagePrinter = winspool.NewProc("StartPagePrinter")
+	procEndPagePrinter   = winspool.NewProc("EndPagePrinter")
+	procWritePrinter     = winspool.NewProc("WritePrinter")
+)
+
+// docInfo1 is DOC_INFO_1 structure of Windows API
+type docInfo1 struct {
+	DocName    *uint16
+	OutputFile *uint16
+	Datatype   *uint16
+}
+
+// PrintRaw writes data to the spooler with RAW datatype, so printer driver passes it to the printer as is
+func (systemBackend) PrintRaw(printer string, file io.Reader) (string, error) {
+	data, err := io.ReadAll(file)
+
+	if err != nil {
+		return "", err
+	}
+
+	printerName, err := syscall.UTF16PtrFromString(printer)
+
+	if err != nil {
+		return "", err
+	}
+
+	// Return value of Windows API functions is 0 on failure, error is set by GetLastError
+	var handle syscall.Handle
+	if r, _, err := procOpenPrinter.Call(uintptr(unsafe.Pointer(printerName)), uintptr(unsafe.Pointer(&handle)), 0); r == 0 {
+		return "", fmt.Errorf("OpenPrinter: %w", err)
+	}
+
+	defer procClosePrinter.Call(uintptr(handle))
+
+	info := docInfo1{
+		DocName:  lo.Must(syscall.UTF16PtrFromString("Raw document")),
+		Datatype: lo.Must(syscall.UTF16PtrFromString("RAW")),
+	}
+	jobId, _, err := procStartDocPrinter.Call(uintptr(handle), 1, uintptr(unsafe.Pointer(&info)))
+
+	if jobId == 0 {
+		return "", fmt.Errorf("StartDocPrinter: %w", err)
+	}
+
+	defer procEndDocPrinter.Call(uintptr(handle))
+
+	if r, _, err := procStartPagePrinter.Call(uintptr(handle)); r == 0 {
+		return "", fmt.Errorf("StartPagePrinter: %w", err)
+	}
+
+	defer procEndPagePrinter.Call(uintptr(handle))
+
+	if len(data) > 0 {
+		var written uint32
+		r, _, err := procWritePrinter.Call(uintptr(handle), uintptr(unsafe.Pointer(&data[0])), uintptr(len(data)), uintptr(unsafe.Pointer(&written)))
+
+		if r == 0 {
+			return "", fmt.Errorf("WritePrinter: %w", err)
+		}
+		if int(written) != len(data) {
+			return "", fmt.Errorf("WritePrinter: written %d of %d bytes", written, len(data))
+		}
+	}
+
+	return strconv.Itoa(int(jobId)), nil
+}
+
+func (systemBackend) CancelPrintJob(_ string) error {
+	return fmt.Errorf("CancelPrintJob: %w", ErrNotSupported)
 }
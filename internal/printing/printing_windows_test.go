@@ -0,0 +1,67 @@
+package printing
+
+import (
+	"errors"
+	"github.com/samber/lo"
+	"slices"
+	"testing"
+)
+
+func TestSumatraPrintSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		options PrintOptions
+		wantErr error
+		want    string
+	}{
+		{name: "defaults", options: PrintOptions{}, want: ""},
+		{name: "pages and copies", options: PrintOptions{PageRanges: "1-3,5", Copies: 2}, want: "1-3,5,2x"},
+		{name: "simplex", options: PrintOptions{Sides: "one-sided"}, want: "simplex"},
+		{name: "duplex long edge", options: PrintOptions{Sides: "two-sided-long-edge"}, want: "duplexlong"},
+		{name: "duplex short edge", options: PrintOptions{Sides: "two-sided-short-edge"}, want: "duplexshort"},
+		{
+			name:    "media",
+			options: PrintOptions{ColorMode: "monochrome", Media: "A4", InputTray: "Tray 2", FitToPage: true},
+			want:    "monochrome,paper=A4,bin=Tray 2,fit",
+		},
+		{name: "orientation", options: PrintOptions{Orientation: "landscape"}, wantErr: ErrNotSupported},
+		{name: "collate", options: PrintOptions{Collate: lo.ToPtr(true)}, wantErr: ErrNotSupported},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sumatraPrintSettings(tt.options)
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseWmicArray(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{value: "{A4;Letter;Legal}", want: []string{"A4", "Letter", "Legal"}},
+		{value: "{Tray 1}", want: []string{"Tray 1"}},
+		{value: "{}", want: []string{}},
+		{value: "", want: []string{}},
+	}
+
+	for _, tt := range tests {
+		if got := parseWmicArray(tt.value); !slices.Equal(got, tt.want) {
+			t.Errorf("parseWmicArray(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
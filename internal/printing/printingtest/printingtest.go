@@ -0,0 +1,63 @@
+// Package printingtest provides job queue helpers for tests of packages using printing
+package printingtest
+
+import (
+	"github.com/downace/print-server/internal/printing"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// OpenJobStore opens store in a temporary directory, keeping jobs and documents for an hour
+func OpenJobStore(t testing.TB) *printing.JobStore {
+	t.Helper()
+
+	store, err := printing.OpenJobStore(filepath.Join(t.TempDir(), "jobs.db"), time.Hour, time.Hour)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return store
+}
+
+// NewJobQueue returns queue with a single worker, so jobs are processed in order of submission.
+// Queue is closed along with its store when test finishes
+func NewJobQueue(t testing.TB, backend printing.Backend) *printing.JobQueue {
+	t.Helper()
+
+	return NewJobQueueWithStore(t, backend, OpenJobStore(t))
+}
+
+// NewJobQueueWithStore is the same as NewJobQueue, but store is accessible to the test
+func NewJobQueueWithStore(t testing.TB, backend printing.Backend, store *printing.JobStore) *printing.JobQueue {
+	t.Helper()
+
+	q := printing.NewJobQueue(backend, store, 1, 10)
+	t.Cleanup(func() { _ = q.Close() })
+
+	return q
+}
+
+// WaitFinished waits until job is completed, failed or cancelled
+func WaitFinished(t testing.TB, q *printing.JobQueue, id string) printing.Job {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for time.Now().Before(deadline) {
+		job, err := q.Get(id)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Finished() {
+			return job
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("job %s is not finished", id)
+	return printing.Job{}
+}
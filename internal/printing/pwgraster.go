@@ -0,0 +1,243 @@
+package printing
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+)
+
+// PWG raster format is described in PWG 5102.4
+const pwgRasterHeaderSize = 1796
+
+// Pages larger than that are most likely malformed, e.g. A4 at 1200 dpi is ~140M pixels
+const pwgRasterMaxPixels = 1 << 28
+
+const (
+	pwgColorSpaceRgb      = 1
+	pwgColorSpaceBlack    = 3
+	pwgColorSpaceSGray    = 18
+	pwgColorSpaceSRgb     = 19
+	pwgColorSpaceAdobeRgb = 20
+)
+
+var pwgRasterSyncWord = []byte("RaS2")
+
+var ErrInvalidPwgRaster = fmt.Errorf("%w: invalid PWG raster document", ErrRequestError)
+
+// PwgRasterRenderer converts PWG raster document, e.g. sent by IPP Everywhere client, to PDF
+func PwgRasterRenderer(data []byte) JobRenderer {
+	return func() ([]byte, error) {
+		// Pages are added as soon as they are decoded, so only one page is kept in memory
+		doc := newImagePdf()
+
+		if err := decodePwgRaster(data, doc.addPage); err != nil {
+			return nil, err
+		}
+
+		return doc.output()
+	}
+}
+
+// IsPwgRaster checks document signature
+func IsPwgRaster(data []byte) bool {
+	return bytes.HasPrefix(data, pwgRasterSyncWord)
+}
+
+// decodePwgRaster passes pages to addPage in document order
+func decodePwgRaster(data []byte, addPage func(page imagePage) error) error {
+	if !IsPwgRaster(data) {
+		return fmt.Errorf("%w: missing sync word", ErrInvalidPwgRaster)
+	}
+
+	r := bytes.NewReader(data[len(pwgRasterSyncWord):])
+	header := make([]byte, pwgRasterHeaderSize)
+	pages := 0
+
+	for {
+		_, err := io.ReadFull(r, header)
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%w: truncated page header", ErrInvalidPwgRaster)
+		}
+
+		page, err := decodePwgRasterPage(header, r)
+
+		if err != nil {
+			return err
+		}
+
+		if err := addPage(page); err != nil {
+			return err
+		}
+		pages++
+	}
+
+	if pages == 0 {
+		return fmt.Errorf("%w: no pages", ErrInvalidPwgRaster)
+	}
+
+	return nil
+}
+
+func decodePwgRasterPage(header []byte, r io.ByteReader) (imagePage, error) {
+	field := func(offset int) int {
+		return int(binary.BigEndian.Uint32(header[offset:]))
+	}
+
+	xDpi, yDpi := field(276), field(280)
+	width, height := field(372), field(376)
+	bitsPerPixel := field(388)
+	bytesPerLine := field(392)
+	colorSpace := field(400)
+
+	// Sides are checked separately, so their product can't overflow
+	if xDpi <= 0 || yDpi <= 0 || width <= 0 || height <= 0 ||
+		width > pwgRasterMaxPixels || height > pwgRasterMaxPixels || width > pwgRasterMaxPixels/height {
+		return imagePage{}, fmt.Errorf("%w: invalid page size %dx%d at %dx%d dpi", ErrInvalidPwgRaster, width, height, xDpi, yDpi)
+	}
+	if bitsPerPixel != 1 && bitsPerPixel != 8 && bitsPerPixel != 24 {
+		return imagePage{}, fmt.Errorf("%w: unsupported %d bits per pixel", ErrInvalidPwgRaster, bitsPerPixel)
+	}
+	if bytesPerLine != (width*bitsPerPixel+7)/8 {
+		return imagePage{}, fmt.Errorf("%w: invalid bytes per line", ErrInvalidPwgRaster)
+	}
+
+	var img image.Image
+	var setRow func(y int, line []byte)
+	// White is encoded as zeros only in black color space
+	white := byte(0xff)
+	if colorSpace == pwgColorSpaceBlack {
+		white = 0
+	}
+
+	switch {
+	case (colorSpace == pwgColorSpaceSGray || colorSpace == pwgColorSpaceBlack) && bitsPerPixel == 8:
+		gray := image.NewGray(image.Rect(0, 0, width, height))
+		setRow = func(y int, line []byte) {
+			row := gray.Pix[y*gray.Stride : y*gray.Stride+width]
+			copy(row, line)
+			if colorSpace == pwgColorSpaceBlack {
+				for i := range row {
+					row[i] = 0xff - row[i]
+				}
+			}
+		}
+		img = gray
+	case (colorSpace == pwgColorSpaceSGray || colorSpace == pwgColorSpaceBlack) && bitsPerPixel == 1:
+		gray := image.NewGray(image.Rect(0, 0, width, height))
+		setRow = func(y int, line []byte) {
+			row := gray.Pix[y*gray.Stride : y*gray.Stride+width]
+			for x := range row {
+				bit := line[x/8]>>(7-x%8)&1 == 1
+				// In sGray set bit is white, in black color space it's black
+				if bit == (colorSpace == pwgColorSpaceSGray) {
+					row[x] = 0xff
+				} else {
+					row[x] = 0
+				}
+			}
+		}
+		img = gray
+	case (colorSpace == pwgColorSpaceRgb || colorSpace == pwgColorSpaceSRgb || colorSpace == pwgColorSpaceAdobeRgb) && bitsPerPixel == 24:
+		rgba := image.NewRGBA(image.Rect(0, 0, width, height))
+		setRow = func(y int, line []byte) {
+			row := rgba.Pix[y*rgba.Stride : y*rgba.Stride+width*4]
+			for x := 0; x < width; x++ {
+				copy(row[x*4:x*4+3], line[x*3:x*3+3])
+				row[x*4+3] = 0xff
+			}
+		}
+		img = rgba
+	default:
+		return imagePage{}, fmt.Errorf("%w: unsupported color space %d with %d bits per pixel", ErrInvalidPwgRaster, colorSpace, bitsPerPixel)
+	}
+
+	if err := decodePwgRasterLines(r, height, bytesPerLine, max(1, bitsPerPixel/8), white, setRow); err != nil {
+		return imagePage{}, err
+	}
+
+	return imagePage{
+		Image:  img,
+		Width:  float64(width) / float64(xDpi) * 72,
+		Height: float64(height) / float64(yDpi) * 72,
+	}, nil
+}
+
+// decodePwgRasterLines decodes PackBits-like compressed bitmap. Each line starts with repeat count,
+// followed by runs of repeated pixels and sequences of literal pixels
+func decodePwgRasterLines(
+	r io.ByteReader,
+	height int,
+	bytesPerLine int,
+	bytesPerPixel int,
+	white byte,
+	setRow func(y int, line []byte),
+) error {
+	truncated := fmt.Errorf("%w: truncated page data", ErrInvalidPwgRaster)
+	overflow := fmt.Errorf("%w: line data overflow", ErrInvalidPwgRaster)
+	line := make([]byte, bytesPerLine)
+	pixel := make([]byte, bytesPerPixel)
+
+	for y := 0; y < height; {
+		repeat, err := r.ReadByte()
+
+		if err != nil {
+			return truncated
+		}
+
+		for x := 0; x < bytesPerLine; {
+			n, err := r.ReadByte()
+
+			if err != nil {
+				return truncated
+			}
+
+			switch {
+			case n < 128:
+				// Next pixel repeated n+1 times
+				count := (int(n) + 1) * bytesPerPixel
+				if x+count > bytesPerLine {
+					return overflow
+				}
+				for i := range pixel {
+					if pixel[i], err = r.ReadByte(); err != nil {
+						return truncated
+					}
+				}
+				for ; count > 0; count -= bytesPerPixel {
+					copy(line[x:], pixel)
+					x += bytesPerPixel
+				}
+			case n == 128:
+				// Rest of the line is blank
+				for ; x < bytesPerLine; x++ {
+					line[x] = white
+				}
+			default:
+				// 257-n literal pixels
+				count := (257 - int(n)) * bytesPerPixel
+				if x+count > bytesPerLine {
+					return overflow
+				}
+				for end := x + count; x < end; x++ {
+					if line[x], err = r.ReadByte(); err != nil {
+						return truncated
+					}
+				}
+			}
+		}
+
+		for i := 0; i <= int(repeat) && y < height; i++ {
+			setRow(y, line)
+			y++
+		}
+	}
+
+	return nil
+}
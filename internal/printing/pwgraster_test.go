@@ -0,0 +1,136 @@
+package printing
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"testing"
+)
+
+type pwgRasterHeader struct {
+	dpi          uint32
+	width        uint32
+	height       uint32
+	bitsPerPixel uint32
+	bytesPerLine uint32
+	colorSpace   uint32
+}
+
+func pwgRasterDocument(h pwgRasterHeader, pageData []byte) []byte {
+	header := make([]byte, pwgRasterHeaderSize)
+	binary.BigEndian.PutUint32(header[276:], h.dpi)
+	binary.BigEndian.PutUint32(header[280:], h.dpi)
+	binary.BigEndian.PutUint32(header[372:], h.width)
+	binary.BigEndian.PutUint32(header[376:], h.height)
+	binary.BigEndian.PutUint32(header[388:], h.bitsPerPixel)
+	binary.BigEndian.PutUint32(header[392:], h.bytesPerLine)
+	binary.BigEndian.PutUint32(header[400:], h.colorSpace)
+
+	data := append([]byte{}, pwgRasterSyncWord...)
+	data = append(data, header...)
+	return append(data, pageData...)
+}
+
+func decodePwgRasterPages(data []byte) ([]imagePage, error) {
+	var pages []imagePage
+	err := decodePwgRaster(data, func(page imagePage) error {
+		pages = append(pages, page)
+		return nil
+	})
+	return pages, err
+}
+
+func TestDecodePwgRaster(t *testing.T) {
+	// 2 lines: black pixel repeated twice, then blank line
+	data := pwgRasterDocument(
+		pwgRasterHeader{dpi: 72, width: 2, height: 2, bitsPerPixel: 8, bytesPerLine: 2, colorSpace: pwgColorSpaceSGray},
+		[]byte{0, 1, 0x00, 0, 128},
+	)
+
+	pages, err := decodePwgRasterPages(data)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 1 || pages[0].Width != 2 || pages[0].Height != 2 {
+		t.Fatalf("unexpected pages: %+v", pages)
+	}
+
+	gray := pages[0].Image.(*image.Gray)
+	want := []byte{0x00, 0x00, 0xff, 0xff}
+	for i, v := range want {
+		if gray.Pix[i] != v {
+			t.Errorf("pixel %d is %x, want %x", i, gray.Pix[i], v)
+		}
+	}
+}
+
+func TestDecodePwgRasterInvalidHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		header pwgRasterHeader
+	}{
+		{
+			name:   "zero size",
+			header: pwgRasterHeader{dpi: 72, width: 0, height: 2, bitsPerPixel: 8, bytesPerLine: 0, colorSpace: pwgColorSpaceSGray},
+		},
+		{
+			name:   "too large",
+			header: pwgRasterHeader{dpi: 72, width: 100000, height: 100000, bitsPerPixel: 8, bytesPerLine: 100000, colorSpace: pwgColorSpaceSGray},
+		},
+		{
+			// Product of sides overflows int
+			name:   "overflow",
+			header: pwgRasterHeader{dpi: 72, width: 0xffffffff, height: 0xffffffff, bitsPerPixel: 8, bytesPerLine: 0xffffffff, colorSpace: pwgColorSpaceSGray},
+		},
+		{
+			name:   "unsupported bits per pixel",
+			header: pwgRasterHeader{dpi: 72, width: 2, height: 2, bitsPerPixel: 0xffffffff, bytesPerLine: 2, colorSpace: pwgColorSpaceSGray},
+		},
+		{
+			name:   "bytes per line mismatch",
+			header: pwgRasterHeader{dpi: 72, width: 2, height: 2, bitsPerPixel: 24, bytesPerLine: 2, colorSpace: pwgColorSpaceSRgb},
+		},
+		{
+			name:   "color space mismatch",
+			header: pwgRasterHeader{dpi: 72, width: 2, height: 2, bitsPerPixel: 24, bytesPerLine: 6, colorSpace: pwgColorSpaceSGray},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodePwgRasterPages(pwgRasterDocument(tt.header, []byte{0, 128}))
+
+			if !errors.Is(err, ErrInvalidPwgRaster) {
+				t.Errorf("expected ErrInvalidPwgRaster, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDecodePwgRasterTruncated(t *testing.T) {
+	data := pwgRasterDocument(
+		pwgRasterHeader{dpi: 72, width: 2, height: 2, bitsPerPixel: 8, bytesPerLine: 2, colorSpace: pwgColorSpaceSGray},
+		[]byte{0, 1},
+	)
+
+	if _, err := decodePwgRasterPages(data); !errors.Is(err, ErrInvalidPwgRaster) {
+		t.Errorf("expected ErrInvalidPwgRaster, got %v", err)
+	}
+}
+
+func TestPwgRasterRenderer(t *testing.T) {
+	header := pwgRasterHeader{dpi: 72, width: 2, height: 2, bitsPerPixel: 8, bytesPerLine: 2, colorSpace: pwgColorSpaceSGray}
+	page := pwgRasterDocument(header, []byte{0, 1, 0x00, 0, 128})
+	// Second page is the same without sync word
+	data := append(page, page[len(pwgRasterSyncWord):]...)
+
+	pdf, err := PwgRasterRenderer(data)()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := CountPdfPages(pdf); count != 2 {
+		t.Errorf("got %d pages, want 2", count)
+	}
+}
@@ -0,0 +1,312 @@
+package printing
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/code128"
+	"github.com/boombuler/barcode/code39"
+	"github.com/boombuler/barcode/ean"
+	"github.com/boombuler/barcode/qr"
+	"image"
+	"image/color"
+	"strings"
+	"unicode/utf8"
+)
+
+// Receipt is a document for thermal receipt printers
+type Receipt struct {
+	Elements []ReceiptElement `json:"elements" validate:"dive"`
+}
+
+// ReceiptElement is a single block of receipt, fields used depend on type
+type ReceiptElement struct {
+	// text, separator, table, qr, barcode, image, feed, cut or drawer
+	Type      string `json:"type" validate:"required,oneof=text separator table qr barcode image feed cut drawer"`
+	Text      string `json:"text"`
+	Align     string `json:"align" validate:"omitempty,oneof=left center right"`
+	Bold      bool   `json:"bold"`
+	Underline bool   `json:"underline"`
+	// Character size multiplier for text, up to 8, or QR code module size in dots, up to 16
+	Size int `json:"size" validate:"gte=0,lte=16"`
+	// Separator character, "-" by default
+	Char    string          `json:"char" validate:"omitempty,len=1"`
+	Columns []ReceiptColumn `json:"columns" validate:"required_if=Type table,dive"`
+	Rows    [][]string      `json:"rows"`
+	// QR code or barcode content, or base64-encoded image
+	Data string `json:"data" validate:"required_if=Type qr,required_if=Type barcode,required_if=Type image"`
+	// Barcode type, code128 by default
+	Symbology string `json:"symbology" validate:"omitempty,oneof=code128 code39 ean13 ean8 upca"`
+	// Barcode height in dots, 80 by default
+	Height int `json:"height" validate:"gte=0,lte=255"`
+	// Hides barcode content, which is printed below barcode by default
+	HideText bool `json:"hideText"`
+	// Number of lines to feed
+	Lines int `json:"lines" validate:"gte=0,lte=255"`
+	// Partial cut leaves a small uncut part
+	Partial bool `json:"partial"`
+	// Cash drawer connector pin, 2 by default
+	Pin int `json:"pin" validate:"omitempty,oneof=2 5"`
+}
+
+type ReceiptColumn struct {
+	// In characters, columns with zero width share the rest of line
+	Width int    `json:"width" validate:"gte=0"`
+	Align string `json:"align" validate:"omitempty,oneof=left center right"`
+}
+
+// receiptPaper describes printable area of thermal printer paper with 203 DPI (8 dots per mm) printer
+type receiptPaper struct {
+	// Paper width in mm
+	Width float64
+	// Printable width in dots
+	Dots int
+	// Characters per line for standard 12x24 font
+	Chars int
+}
+
+// receiptPapers are supported papers by width in mm
+var receiptPapers = map[int]receiptPaper{
+	58: {Width: 58, Dots: 384, Chars: 32},
+	80: {Width: 80, Dots: 576, Chars: 48},
+}
+
+const (
+	receiptDotsPerMm     = 8
+	receiptMaxTextSize   = 8
+	receiptBarcodeModule = 2
+	defaultBarcodeHeight = 80
+	defaultSymbology     = "code128"
+	defaultQrModuleSize  = 6
+	defaultReceiptFeed   = 1
+	defaultSeparator     = "-"
+	defaultCashDrawerPin = 2
+)
+
+func getReceiptPaper(width int) (receiptPaper, error) {
+	paper, ok := receiptPapers[width]
+
+	if !ok {
+		return paper, fmt.Errorf("%w: unsupported receipt paper width %d", ErrRequestError, width)
+	}
+
+	return paper, nil
+}
+
+func (e ReceiptElement) textSize() (int, error) {
+	if e.Size > receiptMaxTextSize {
+		return 0, fmt.Errorf("%w: text size is up to %d", ErrRequestError, receiptMaxTextSize)
+	}
+	return max(e.Size, 1), nil
+}
+
+// textRows wraps text to the paper width, taking character size into account
+func (e ReceiptElement) textRows(paper receiptPaper) ([]string, error) {
+	size, err := e.textSize()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []string
+	for _, line := range strings.Split(normalizeText(e.Text, 4), "\n") {
+		for _, row := range wrapLine(line, float64(paper.Chars/size), func(rune) float64 { return 1 }) {
+			// Spaces at wrapping position would shift centered and right-aligned text
+			rows = append(rows, strings.TrimRight(row, " "))
+		}
+	}
+
+	return rows, nil
+}
+
+func (e ReceiptElement) separatorRow(paper receiptPaper) string {
+	char := e.Char
+	if char == "" {
+		char = defaultSeparator
+	}
+	return strings.Repeat(char, paper.Chars)
+}
+
+// tableRows lays out table cells in fixed-width columns separated by space
+func (e ReceiptElement) tableRows(paper receiptPaper) []string {
+	widths := make([]int, len(e.Columns))
+	rest := paper.Chars - (len(e.Columns) - 1)
+	flexible := 0
+
+	for i, column := range e.Columns {
+		widths[i] = column.Width
+		rest -= column.Width
+		if column.Width == 0 {
+			flexible++
+		}
+	}
+
+	for i := range widths {
+		if widths[i] == 0 && flexible > 0 {
+			widths[i] = max(rest/flexible, 0)
+			rest -= widths[i]
+			flexible--
+		}
+	}
+
+	var rows []string
+
+	for _, cells := range e.Rows {
+		var row strings.Builder
+		for i, width := range widths {
+			if i > 0 {
+				row.WriteString(" ")
+			}
+			cell := ""
+			if i < len(cells) {
+				cell = cells[i]
+			}
+			row.WriteString(alignCell(cell, width, e.Columns[i].Align))
+		}
+		// Line can't be longer than paper, if columns are too wide
+		rows = append(rows, alignCell(row.String(), min(utf8.RuneCountInString(row.String()), paper.Chars), ""))
+	}
+
+	return rows
+}
+
+// alignCell truncates or pads cell text to given width
+func alignCell(text string, width int, align string) string {
+	runes := []rune(strings.ReplaceAll(text, "\n", " "))
+
+	if len(runes) >= width {
+		return string(runes[:width])
+	}
+
+	padding := width - len(runes)
+
+	switch align {
+	case "right":
+		return strings.Repeat(" ", padding) + string(runes)
+	case "center":
+		return strings.Repeat(" ", padding/2) + string(runes) + strings.Repeat(" ", padding-padding/2)
+	default:
+		return string(runes) + strings.Repeat(" ", padding)
+	}
+}
+
+func (e ReceiptElement) qrCode() (barcode.Barcode, error) {
+	code, err := qr.Encode(e.Data, qr.M, qr.Auto)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: QR code: %w", ErrRequestError, err)
+	}
+
+	return code, nil
+}
+
+func (e ReceiptElement) qrModuleSize() int {
+	if e.Size == 0 {
+		return defaultQrModuleSize
+	}
+	return e.Size
+}
+
+func (e ReceiptElement) symbology() string {
+	if e.Symbology == "" {
+		return defaultSymbology
+	}
+	return e.Symbology
+}
+
+// barcode encodes barcode, which also checks whether data is valid for symbology
+func (e ReceiptElement) barcode() (barcode.Barcode, error) {
+	var code barcode.Barcode
+	var err error
+
+	// Length of barcode data is a single byte in ESC/POS
+	if len(e.Data) > 250 {
+		return nil, fmt.Errorf("%w: barcode is too long", ErrRequestError)
+	}
+
+	switch e.symbology() {
+	case "code39":
+		code, err = code39.Encode(e.Data, false, false)
+	case "ean13", "ean8":
+		code, err = ean.Encode(e.Data)
+		if err == nil && (len(e.Data) <= 8) != (e.symbology() == "ean8") {
+			err = fmt.Errorf("wrong number of digits")
+		}
+	case "upca":
+		// UPC-A is EAN-13 starting with 0
+		code, err = ean.Encode("0" + e.Data)
+		if err == nil && len(e.Data) < 11 {
+			err = fmt.Errorf("wrong number of digits")
+		}
+	default:
+		code, err = code128.Encode(e.Data)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: barcode: %w", ErrRequestError, err)
+	}
+
+	return code, nil
+}
+
+func (e ReceiptElement) barcodeHeight() int {
+	if e.Height == 0 {
+		return defaultBarcodeHeight
+	}
+	return e.Height
+}
+
+func (e ReceiptElement) image() (image.Image, error) {
+	data, err := base64.StdEncoding.DecodeString(e.Data)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: image: %w", ErrRequestError, err)
+	}
+
+	img, _, err := decodeImage(data)
+
+	return img, err
+}
+
+// bitmap scales image down to fit paper and converts it to black and white, as printer would print it
+func (e ReceiptElement) bitmap(paper receiptPaper) (*image.Gray, error) {
+	img, err := e.image()
+
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	if width > paper.Dots {
+		height = height * paper.Dots / width
+		width = paper.Dots
+	}
+
+	bitmap := image.NewGray(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.NRGBAModel.Convert(img.At(
+				bounds.Min.X+x*bounds.Dx()/width,
+				bounds.Min.Y+y*bounds.Dy()/height,
+			)).(color.NRGBA)
+			// Transparent pixels are white, like paper
+			luminance := (299*int(c.R) + 587*int(c.G) + 114*int(c.B)) / 1000
+			luminance = (luminance*int(c.A) + 255*(255-int(c.A))) / 255
+			if luminance >= 128 {
+				bitmap.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+	}
+
+	return bitmap, nil
+}
+
+func (e ReceiptElement) feedLines() int {
+	if e.Lines == 0 {
+		return defaultReceiptFeed
+	}
+	return e.Lines
+}
@@ -0,0 +1,188 @@
+package printing
+
+import (
+	"bytes"
+	"golang.org/x/text/encoding/charmap"
+	"image"
+)
+
+// ESC/POS commands, see Epson ESC/POS command reference
+var (
+	escPosInit          = []byte{0x1B, '@'}
+	escPosAlign         = []byte{0x1B, 'a'}
+	escPosBold          = []byte{0x1B, 'E'}
+	escPosUnderline     = []byte{0x1B, '-'}
+	escPosCharSize      = []byte{0x1D, '!'}
+	escPosFeed          = []byte{0x1B, 'd'}
+	escPosCut           = []byte{0x1D, 'V'}
+	escPosPulse         = []byte{0x1B, 'p'}
+	escPosQrCode        = []byte{0x1D, '(', 'k'}
+	escPosBarcodeHeight = []byte{0x1D, 'h'}
+	escPosBarcodeWidth  = []byte{0x1D, 'w'}
+	escPosBarcodeText   = []byte{0x1D, 'H'}
+	escPosBarcode       = []byte{0x1D, 'k'}
+	escPosRasterImage   = []byte{0x1D, 'v', '0', 0}
+)
+
+const escPosImageBand = 256
+
+var escPosAlignments = map[string]byte{"left": 0, "center": 1, "right": 2}
+
+// escPosSymbologies are barcode types of GS k command, function B
+var escPosSymbologies = map[string]byte{"upca": 65, "ean13": 67, "ean8": 68, "code39": 69, "code128": 73}
+
+// ReceiptToEscPos compiles receipt to ESC/POS commands for given paper width in mm.
+// Text is printed using default PC437 code page, unsupported characters are replaced with "?"
+func ReceiptToEscPos(receipt Receipt, paperWidth int) ([]byte, error) {
+	paper, err := getReceiptPaper(paperWidth)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	out.Write(escPosInit)
+
+	for _, e := range receipt.Elements {
+		if err := writeEscPosElement(&out, e, paper); err != nil {
+			return nil, err
+		}
+	}
+
+	return out.Bytes(), nil
+}
+
+func writeEscPosElement(out *bytes.Buffer, e ReceiptElement, paper receiptPaper) error {
+	switch e.Type {
+	case "text":
+		rows, err := e.textRows(paper)
+		if err != nil {
+			return err
+		}
+		size, _ := e.textSize()
+		writeEscPosCommand(out, escPosAlign, escPosAlignments[e.Align])
+		writeEscPosCommand(out, escPosBold, escPosBool(e.Bold))
+		writeEscPosCommand(out, escPosUnderline, escPosBool(e.Underline))
+		writeEscPosCommand(out, escPosCharSize, byte((size-1)<<4|(size-1)))
+		for _, row := range rows {
+			writeEscPosText(out, row)
+		}
+		writeEscPosCommand(out, escPosCharSize, 0)
+		writeEscPosCommand(out, escPosUnderline, 0)
+		writeEscPosCommand(out, escPosBold, 0)
+		writeEscPosCommand(out, escPosAlign, 0)
+	case "separator":
+		writeEscPosText(out, e.separatorRow(paper))
+	case "table":
+		writeEscPosCommand(out, escPosBold, escPosBool(e.Bold))
+		for _, row := range e.tableRows(paper) {
+			writeEscPosText(out, row)
+		}
+		writeEscPosCommand(out, escPosBold, 0)
+	case "qr":
+		if _, err := e.qrCode(); err != nil {
+			return err
+		}
+		data := []byte(e.Data)
+		writeEscPosCommand(out, escPosAlign, escPosAlignments[e.Align])
+		// Model 2, module size, error correction level M, store data, print
+		writeEscPosCommand(out, escPosQrCode, 4, 0, 49, 65, 50, 0)
+		writeEscPosCommand(out, escPosQrCode, 3, 0, 49, 67, byte(e.qrModuleSize()))
+		writeEscPosCommand(out, escPosQrCode, 3, 0, 49, 69, 49)
+		writeEscPosCommand(out, escPosQrCode, append([]byte{byte((len(data) + 3) % 256), byte((len(data) + 3) / 256), 49, 80, 48}, data...)...)
+		writeEscPosCommand(out, escPosQrCode, 3, 0, 49, 81, 48)
+		out.WriteByte('\n')
+		writeEscPosCommand(out, escPosAlign, 0)
+	case "barcode":
+		if _, err := e.barcode(); err != nil {
+			return err
+		}
+		data := []byte(e.Data)
+		if e.symbology() == "code128" {
+			// Code set B
+			data = append([]byte("{B"), data...)
+		}
+		writeEscPosCommand(out, escPosAlign, escPosAlignments[e.Align])
+		writeEscPosCommand(out, escPosBarcodeHeight, byte(e.barcodeHeight()))
+		writeEscPosCommand(out, escPosBarcodeWidth, receiptBarcodeModule)
+		writeEscPosCommand(out, escPosBarcodeText, escPosBool(!e.HideText)*2)
+		writeEscPosCommand(out, escPosBarcode, append([]byte{escPosSymbologies[e.symbology()], byte(len(data))}, data...)...)
+		out.WriteByte('\n')
+		writeEscPosCommand(out, escPosAlign, 0)
+	case "image":
+		bitmap, err := e.bitmap(paper)
+		if err != nil {
+			return err
+		}
+		writeEscPosCommand(out, escPosAlign, escPosAlignments[e.Align])
+		writeEscPosImage(out, bitmap)
+		writeEscPosCommand(out, escPosAlign, 0)
+	case "feed":
+		writeEscPosCommand(out, escPosFeed, byte(e.feedLines()))
+	case "cut":
+		// Function B feeds paper to cutting position first
+		mode := byte(65)
+		if e.Partial {
+			mode = 66
+		}
+		writeEscPosCommand(out, escPosCut, mode, 0)
+	case "drawer":
+		pin := byte(0)
+		if e.Pin == 5 {
+			pin = 1
+		}
+		// Pulse of 50 ms on, 500 ms off
+		writeEscPosCommand(out, escPosPulse, pin, 25, 250)
+	}
+
+	return nil
+}
+
+func writeEscPosCommand(out *bytes.Buffer, command []byte, args ...byte) {
+	out.Write(command)
+	out.Write(args)
+}
+
+func writeEscPosText(out *bytes.Buffer, text string) {
+	for _, r := range text {
+		if b, ok := charmap.CodePage437.EncodeRune(r); ok {
+			out.WriteByte(b)
+		} else {
+			out.WriteByte('?')
+		}
+	}
+	out.WriteByte('\n')
+}
+
+// writeEscPosImage prints bitmap using raster bit image command, 8 pixels per byte.
+// Image is printed in bands, since printers limit image height
+func writeEscPosImage(out *bytes.Buffer, bitmap *image.Gray) {
+	width, height := bitmap.Bounds().Dx(), bitmap.Bounds().Dy()
+	widthBytes := (width + 7) / 8
+
+	for top := 0; top < height; top += escPosImageBand {
+		band := min(escPosImageBand, height-top)
+
+		writeEscPosCommand(out, escPosRasterImage, byte(widthBytes%256), byte(widthBytes/256), byte(band%256), byte(band/256))
+
+		for y := top; y < top+band; y++ {
+			for xByte := 0; xByte < widthBytes; xByte++ {
+				var b byte
+				for bit := 0; bit < 8; bit++ {
+					x := xByte*8 + bit
+					if x < width && bitmap.GrayAt(x, y).Y == 0 {
+						b |= 0x80 >> bit
+					}
+				}
+				out.WriteByte(b)
+			}
+		}
+	}
+}
+
+func escPosBool(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,215 @@
+package printing
+
+import (
+	"fmt"
+	"github.com/go-pdf/fpdf"
+	"image"
+	"unicode/utf8"
+)
+
+const (
+	// Standard font is 12x24 dots, with 30 dots line spacing
+	receiptCharHeight = 24.0 / receiptDotsPerMm
+	receiptLineHeight = 30.0 / receiptDotsPerMm
+	// Courier characters are 0.6 of font size wide
+	receiptCourierWidth = 0.6
+	receiptPageMargin   = 4.0
+)
+
+// receiptBlock is laid out part of receipt, in mm
+type receiptBlock struct {
+	height float64
+	draw   func(y float64)
+}
+
+// ReceiptToPdf renders receipt to PDF the way thermal printer would print it, for printing on regular printers.
+// Each cut starts a new page, page height fits the content
+func ReceiptToPdf(receipt Receipt, paperWidth int) ([]byte, error) {
+	paper, err := getReceiptPaper(paperWidth)
+
+	if err != nil {
+		return nil, err
+	}
+
+	r := receiptPdf{
+		doc:       fpdf.New("P", "mm", "A4", ""),
+		paper:     paper,
+		margin:    (paper.Width - float64(paper.Dots)/receiptDotsPerMm) / 2,
+		charWidth: float64(paper.Dots) / receiptDotsPerMm / float64(paper.Chars),
+	}
+	r.doc.SetAutoPageBreak(false, 0)
+	r.translate = r.doc.UnicodeTranslatorFromDescriptor("")
+
+	pages := [][]receiptBlock{nil}
+
+	for _, e := range receipt.Elements {
+		if e.Type == "cut" {
+			pages = append(pages, nil)
+			continue
+		}
+
+		blocks, err := r.layout(e)
+
+		if err != nil {
+			return nil, err
+		}
+
+		pages[len(pages)-1] = append(pages[len(pages)-1], blocks...)
+	}
+
+	for i, blocks := range pages {
+		// Receipt usually ends with cut, which shouldn't produce empty page
+		if len(blocks) == 0 && i > 0 && i == len(pages)-1 {
+			break
+		}
+
+		height := receiptPageMargin * 2
+		for _, block := range blocks {
+			height += block.height
+		}
+
+		r.doc.AddPageFormat("P", fpdf.SizeType{Wd: paper.Width, Ht: height})
+
+		y := receiptPageMargin
+		for _, block := range blocks {
+			block.draw(y)
+			y += block.height
+		}
+	}
+
+	return outputPdf(r.doc)
+}
+
+type receiptPdf struct {
+	doc       *fpdf.Fpdf
+	translate func(string) string
+	paper     receiptPaper
+	// Left and right margin of printable area
+	margin    float64
+	charWidth float64
+	images    int
+}
+
+func (r *receiptPdf) layout(e ReceiptElement) ([]receiptBlock, error) {
+	switch e.Type {
+	case "text":
+		rows, err := e.textRows(r.paper)
+		if err != nil {
+			return nil, err
+		}
+		size, _ := e.textSize()
+		return r.textBlocks(rows, e.Align, e.Bold, e.Underline, size), nil
+	case "separator":
+		return r.textBlocks([]string{e.separatorRow(r.paper)}, "", false, false, 1), nil
+	case "table":
+		return r.textBlocks(e.tableRows(r.paper), "", e.Bold, false, 1), nil
+	case "qr":
+		code, err := e.qrCode()
+		if err != nil {
+			return nil, err
+		}
+		return r.imageBlocks(code, float64(e.qrModuleSize()), 1, e.Align)
+	case "barcode":
+		code, err := e.barcode()
+		if err != nil {
+			return nil, err
+		}
+		height := float64(e.barcodeHeight())
+		blocks, err := r.imageBlocks(code, receiptBarcodeModule, height/float64(code.Bounds().Dy()), e.Align)
+		if err != nil {
+			return nil, err
+		}
+		if !e.HideText {
+			// Barcode text is centered under barcode
+			width := float64(code.Bounds().Dx()*receiptBarcodeModule) / receiptDotsPerMm
+			textWidth := float64(utf8.RuneCountInString(e.Data)) * r.charWidth
+			offset := r.alignOffset(width, e.Align) + (width-textWidth)/2
+			blocks = append(blocks, receiptBlock{
+				height: receiptLineHeight,
+				draw: func(y float64) {
+					r.doc.SetFont("Courier", "", r.fontSize(1))
+					r.doc.Text(r.margin+offset, y+receiptCharHeight*0.8, r.translate(e.Data))
+				},
+			})
+		}
+		return blocks, nil
+	case "image":
+		bitmap, err := e.bitmap(r.paper)
+		if err != nil {
+			return nil, err
+		}
+		return r.imageBlocks(bitmap, 1, 1, e.Align)
+	case "feed":
+		return []receiptBlock{{height: receiptLineHeight * float64(e.feedLines()), draw: func(float64) {}}}, nil
+	}
+
+	// Cash drawer kick has nothing to print
+	return nil, nil
+}
+
+// fontSize in points, so that character width matches the printer font
+func (r *receiptPdf) fontSize(size int) float64 {
+	return r.charWidth / receiptCourierWidth * float64(size) * 72 / 25.4
+}
+
+// alignOffset is position of block of given width relative to printable area
+func (r *receiptPdf) alignOffset(width float64, align string) float64 {
+	area := float64(r.paper.Dots) / receiptDotsPerMm
+
+	switch align {
+	case "center":
+		return (area - width) / 2
+	case "right":
+		return area - width
+	}
+	return 0
+}
+
+func (r *receiptPdf) textBlocks(rows []string, align string, bold bool, underline bool, size int) []receiptBlock {
+	style := ""
+	if bold {
+		style += "B"
+	}
+	if underline {
+		style += "U"
+	}
+
+	blocks := make([]receiptBlock, 0, len(rows))
+
+	for _, row := range rows {
+		width := float64(utf8.RuneCountInString(row)*size) * r.charWidth
+		x := r.margin + r.alignOffset(width, align)
+
+		blocks = append(blocks, receiptBlock{
+			height: receiptLineHeight * float64(size),
+			draw: func(y float64) {
+				r.doc.SetFont("Courier", style, r.fontSize(size))
+				// Text is placed by baseline
+				r.doc.Text(x, y+receiptCharHeight*float64(size)*0.8, r.translate(row))
+			},
+		})
+	}
+
+	return blocks
+}
+
+// imageBlocks places image scaled by given number of dots per pixel
+func (r *receiptPdf) imageBlocks(img image.Image, scaleX float64, scaleY float64, align string) ([]receiptBlock, error) {
+	name := fmt.Sprintf("receipt-%d", r.images)
+	r.images++
+
+	if err := registerImage(r.doc, name, img); err != nil {
+		return nil, err
+	}
+
+	width := float64(img.Bounds().Dx()) * scaleX / receiptDotsPerMm
+	height := float64(img.Bounds().Dy()) * scaleY / receiptDotsPerMm
+	x := r.margin + r.alignOffset(width, align)
+
+	return []receiptBlock{{
+		height: height,
+		draw: func(y float64) {
+			r.doc.ImageOptions(name, x, y, width, height, false, fpdf.ImageOptions{}, 0, "")
+		},
+	}}, nil
+}
@@ -0,0 +1,69 @@
+package printing
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestReceiptToEscPos(t *testing.T) {
+	receipt := Receipt{Elements: []ReceiptElement{
+		{Type: "text", Text: "Coffee shop", Align: "center", Bold: true},
+		{Type: "separator"},
+		{Type: "table", Columns: []ReceiptColumn{{}, {Width: 6, Align: "right"}}, Rows: [][]string{{"Latte", "3.50"}}},
+		{Type: "barcode", Data: "12345"},
+		{Type: "cut", Partial: true},
+	}}
+
+	data, err := ReceiptToEscPos(receipt, 58)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.HasPrefix(data, escPosInit) {
+		t.Error("receipt doesn't start with init command")
+	}
+
+	expected := [][]byte{
+		// Centered bold text
+		{0x1B, 'a', 1, 0x1B, 'E', 1},
+		[]byte("Coffee shop\n"),
+		[]byte(strings.Repeat("-", 32) + "\n"),
+		[]byte("Latte" + strings.Repeat(" ", 23) + "3.50\n"),
+		// Code set B prefix and barcode data
+		{0x1D, 'k', 73, 7, '{', 'B', '1', '2', '3', '4', '5'},
+		{0x1D, 'V', 66, 0},
+	}
+
+	for _, e := range expected {
+		if !bytes.Contains(data, e) {
+			t.Errorf("receipt doesn't contain %q", e)
+		}
+	}
+}
+
+func TestReceiptToEscPosErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		width    int
+		elements []ReceiptElement
+	}{
+		{name: "paper width", width: 100},
+		{name: "text size", width: 80, elements: []ReceiptElement{{Type: "text", Text: "x", Size: 9}}},
+		{name: "long barcode", width: 80, elements: []ReceiptElement{{Type: "barcode", Data: strings.Repeat("1", 251)}}},
+		{name: "ean digits", width: 80, elements: []ReceiptElement{{Type: "barcode", Symbology: "ean8", Data: "123456789012"}}},
+		{name: "image", width: 80, elements: []ReceiptElement{{Type: "image", Data: "not base64"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReceiptToEscPos(Receipt{Elements: tt.elements}, tt.width)
+
+			if !errors.Is(err, ErrRequestError) {
+				t.Errorf("expected request error, got %v", err)
+			}
+		})
+	}
+}
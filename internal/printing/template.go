@@ -0,0 +1,296 @@
+package printing
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/go-rod/rod/lib/proto"
+	"gopkg.in/yaml.v3"
+	"html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"text/template/parse"
+)
+
+const (
+	defaultTemplatesDirectory = "templates"
+	templateFile              = "template.html"
+	templateMetaFile          = "template.yaml"
+)
+
+var ErrTemplateNotFound = errors.New("template not found")
+
+var templateNameRegexp = regexp.MustCompile(`^[\w-]+$`)
+
+// TemplateRegistry provides templates stored in directory. Each template is a subdirectory with
+// template.html (Go html/template), optional template.yaml and files referenced by the template, e.g. CSS files.
+// Templates are loaded on each use, so they can be changed without restarting the server
+type TemplateRegistry struct {
+	dir string
+}
+
+func NewTemplateRegistry(dir string) *TemplateRegistry {
+	if dir == "" {
+		dir = defaultTemplatesDirectory
+	}
+	return &TemplateRegistry{dir: dir}
+}
+
+// TemplateField describes data expected by template
+type TemplateField struct {
+	Name        string `yaml:"name" json:"name"`
+	Type        string `yaml:"type" json:"type,omitempty"`
+	Required    bool   `yaml:"required" json:"required"`
+	Description string `yaml:"description" json:"description,omitempty"`
+}
+
+// TemplatePrintSettings are default settings of conversion to PDF, sizes are in inches
+type TemplatePrintSettings struct {
+	Landscape       bool     `yaml:"landscape"`
+	PaperWidth      *float64 `yaml:"paperWidth"`
+	PaperHeight     *float64 `yaml:"paperHeight"`
+	MarginTop       *float64 `yaml:"marginTop"`
+	MarginBottom    *float64 `yaml:"marginBottom"`
+	MarginLeft      *float64 `yaml:"marginLeft"`
+	MarginRight     *float64 `yaml:"marginRight"`
+	PrintBackground bool     `yaml:"printBackground"`
+	Scale           *float64 `yaml:"scale"`
+	// Use page size defined in CSS @page rule
+	PreferCssPageSize bool `yaml:"preferCssPageSize"`
+	// Name of header and footer preset from config
+	HeaderFooter   string `yaml:"headerFooter"`
+	HeaderTemplate string `yaml:"headerTemplate"`
+	FooterTemplate string `yaml:"footerTemplate"`
+}
+
+func (s TemplatePrintSettings) ToPrintParams() *proto.PagePrintToPDF {
+	return &proto.PagePrintToPDF{
+		Landscape:         s.Landscape,
+		PaperWidth:        s.PaperWidth,
+		PaperHeight:       s.PaperHeight,
+		MarginTop:         s.MarginTop,
+		MarginBottom:      s.MarginBottom,
+		MarginLeft:        s.MarginLeft,
+		MarginRight:       s.MarginRight,
+		PrintBackground:   s.PrintBackground,
+		Scale:             s.Scale,
+		PreferCSSPageSize: s.PreferCssPageSize,
+		HeaderTemplate:    s.HeaderTemplate,
+		FooterTemplate:    s.FooterTemplate,
+	}
+}
+
+type templateMeta struct {
+	Description string                `yaml:"description"`
+	Fields      []TemplateField       `yaml:"fields"`
+	Print       TemplatePrintSettings `yaml:"print"`
+}
+
+type TemplateInfo struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Fields      []TemplateField `json:"fields"`
+}
+
+// List returns templates sorted by name, directories without template.html are skipped
+func (r *TemplateRegistry) List() ([]TemplateInfo, error) {
+	entries, err := os.ReadDir(r.dir)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return []TemplateInfo{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	templates := make([]TemplateInfo, 0, len(entries))
+
+	for _, entry := range entries {
+		if !entry.IsDir() || !templateNameRegexp.MatchString(entry.Name()) {
+			continue
+		}
+
+		tmpl, meta, err := r.load(entry.Name())
+
+		if errors.Is(err, ErrTemplateNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		templates = append(templates, TemplateInfo{
+			Name:        entry.Name(),
+			Description: meta.Description,
+			Fields:      templateFields(tmpl, meta),
+		})
+	}
+
+	return templates, nil
+}
+
+func (r *TemplateRegistry) load(name string) (*template.Template, templateMeta, error) {
+	var meta templateMeta
+
+	if !templateNameRegexp.MatchString(name) {
+		return nil, meta, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+
+	dir := filepath.Join(r.dir, name)
+	source, err := os.ReadFile(filepath.Join(dir, templateFile))
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, meta, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+	if err != nil {
+		return nil, meta, err
+	}
+
+	metaData, err := os.ReadFile(filepath.Join(dir, templateMetaFile))
+
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, meta, err
+	}
+	if err = yaml.Unmarshal(metaData, &meta); err != nil {
+		return nil, meta, fmt.Errorf("template %s: %w", name, err)
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(string(source))
+
+	if err != nil {
+		return nil, meta, fmt.Errorf("template %s: %w", name, err)
+	}
+
+	return tmpl, meta, nil
+}
+
+// Render executes template with data and collects template files, so the document can be printed as HTML
+func (r *TemplateRegistry) Render(name string, data map[string]any) (HtmlDocument, TemplatePrintSettings, error) {
+	var document HtmlDocument
+
+	tmpl, meta, err := r.load(name)
+
+	if err != nil {
+		return document, meta.Print, err
+	}
+
+	for _, field := range meta.Fields {
+		if field.Required && data[field.Name] == nil {
+			return document, meta.Print, fmt.Errorf("%w: field %s is required", ErrRequestError, field.Name)
+		}
+	}
+
+	var html bytes.Buffer
+
+	if err := tmpl.Execute(&html, data); err != nil {
+		return document, meta.Print, fmt.Errorf("%w: %w", ErrRequestError, err)
+	}
+
+	document.Html = html.Bytes()
+	document.Assets, err = readTemplateAssets(filepath.Join(r.dir, name))
+
+	return document, meta.Print, err
+}
+
+// readTemplateAssets reads all files in template directory, except template itself
+func readTemplateAssets(dir string) (map[string][]byte, error) {
+	assets := map[string][]byte{}
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		name, err := filepath.Rel(dir, path)
+
+		if err != nil {
+			return err
+		}
+
+		name = filepath.ToSlash(name)
+
+		if name == templateFile || name == templateMetaFile {
+			return nil
+		}
+
+		assets[name], err = os.ReadFile(path)
+		return err
+	})
+
+	return assets, err
+}
+
+// templateFields returns fields declared in template.yaml, or guesses them from the template:
+// top-level fields used outside of range and with blocks and fields referenced as $.Name
+func templateFields(tmpl *template.Template, meta templateMeta) []TemplateField {
+	if len(meta.Fields) > 0 {
+		return meta.Fields
+	}
+
+	var names []string
+	if tmpl.Tree != nil {
+		collectTemplateFields(tmpl.Tree.Root, true, &names)
+	}
+
+	fields := make([]TemplateField, 0, len(names))
+	for _, name := range names {
+		fields = append(fields, TemplateField{Name: name})
+	}
+
+	return fields
+}
+
+func collectTemplateFields(node parse.Node, topLevel bool, names *[]string) {
+	add := func(name string) {
+		if !slices.Contains(*names, name) {
+			*names = append(*names, name)
+		}
+	}
+
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectTemplateFields(child, topLevel, names)
+		}
+	case *parse.ActionNode:
+		collectTemplateFields(n.Pipe, topLevel, names)
+	case *parse.TemplateNode:
+		collectTemplateFields(n.Pipe, topLevel, names)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			for _, arg := range cmd.Args {
+				collectTemplateFields(arg, topLevel, names)
+			}
+		}
+	case *parse.FieldNode:
+		if topLevel {
+			add(n.Ident[0])
+		}
+	case *parse.VariableNode:
+		if len(n.Ident) > 1 && n.Ident[0] == "$" {
+			add(n.Ident[1])
+		}
+	case *parse.IfNode:
+		collectTemplateFields(n.Pipe, topLevel, names)
+		collectTemplateFields(n.List, topLevel, names)
+		collectTemplateFields(n.ElseList, topLevel, names)
+	case *parse.RangeNode:
+		// Dot is changed inside range and with blocks
+		collectTemplateFields(n.Pipe, topLevel, names)
+		collectTemplateFields(n.List, false, names)
+		collectTemplateFields(n.ElseList, topLevel, names)
+	case *parse.WithNode:
+		collectTemplateFields(n.Pipe, topLevel, names)
+		collectTemplateFields(n.List, false, names)
+		collectTemplateFields(n.ElseList, topLevel, names)
+	}
+}
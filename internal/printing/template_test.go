@@ -0,0 +1,138 @@
+package printing
+
+import (
+	"errors"
+	"html/template"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestTemplateFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		meta   templateMeta
+		want   []string
+	}{
+		{name: "fields", source: `{{.Number}} {{.Customer.Name}} {{.Number}}`, want: []string{"Number", "Customer"}},
+		{name: "if", source: `{{if .Paid}}{{.PaidAt}}{{else}}{{.DueAt}}{{end}}`, want: []string{"Paid", "PaidAt", "DueAt"}},
+		{name: "range", source: `{{range .Items}}{{.Name}} {{$.Currency}}{{else}}{{.Empty}}{{end}}`, want: []string{"Items", "Currency", "Empty"}},
+		{name: "with", source: `{{with .Customer}}{{.Name}}{{end}}`, want: []string{"Customer"}},
+		{name: "pipeline", source: `{{.Total | printf "%.2f"}} {{len .Items}}`, want: []string{"Total", "Items"}},
+		{name: "no fields", source: `<p>static</p>`, want: []string{}},
+		{
+			name:   "declared in meta",
+			source: `{{.Number}}`,
+			meta:   templateMeta{Fields: []TemplateField{{Name: "Number", Required: true}, {Name: "Notes"}}},
+			want:   []string{"Number", "Notes"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl := template.Must(template.New(tt.name).Parse(tt.source))
+
+			var got []string
+			for _, field := range templateFields(tmpl, tt.meta) {
+				got = append(got, field.Name)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// writeTemplate creates template directory with given files
+func writeTemplate(t *testing.T, dir string, name string, files map[string]string) {
+	t.Helper()
+
+	for file, content := range files {
+		path := filepath.Join(dir, name, file)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTemplateRegistryRender(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "invoice", map[string]string{
+		templateFile:     `<link rel="stylesheet" href="css/style.css"><h1>{{.Number}}</h1>{{range .Items}}<p>{{.}}</p>{{end}}`,
+		templateMetaFile: "fields:\n  - name: Number\n    required: true\nprint:\n  landscape: true\n",
+		"css/style.css":  "h1 { color: red }",
+	})
+	writeTemplate(t, dir, "broken", map[string]string{templateFile: `{{.Number.Missing}}`})
+	r := NewTemplateRegistry(dir)
+
+	document, settings, err := r.Render("invoice", map[string]any{"Number": "A-1", "Items": []any{"<b>Coffee</b>"}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `<link rel="stylesheet" href="css/style.css"><h1>A-1</h1><p>&lt;b&gt;Coffee&lt;/b&gt;</p>`
+	if string(document.Html) != want {
+		t.Errorf("got HTML %q, want %q", document.Html, want)
+	}
+	if len(document.Assets) != 1 || string(document.Assets["css/style.css"]) != "h1 { color: red }" {
+		t.Errorf("unexpected assets %v", document.Assets)
+	}
+	if !settings.Landscape {
+		t.Error("print settings are not loaded")
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		data     map[string]any
+		wantErr  error
+	}{
+		{name: "missing required field", template: "invoice", data: map[string]any{"Items": []any{}}, wantErr: ErrRequestError},
+		{name: "execution error", template: "broken", data: map[string]any{"Number": 1}, wantErr: ErrRequestError},
+		{name: "unknown template", template: "receipt", wantErr: ErrTemplateNotFound},
+		{name: "path traversal", template: "../invoice", wantErr: ErrTemplateNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := r.Render(tt.template, tt.data); !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestTemplateRegistryList(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "receipt", map[string]string{templateFile: `{{.Total}}`})
+	writeTemplate(t, dir, "invoice", map[string]string{
+		templateFile:     `{{.Number}}`,
+		templateMetaFile: "description: Customer invoice\n",
+	})
+	writeTemplate(t, dir, "assets", map[string]string{"style.css": ""})
+
+	templates, err := NewTemplateRegistry(dir).List()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(templates) != 2 || templates[0].Name != "invoice" || templates[1].Name != "receipt" {
+		t.Fatalf("unexpected templates %+v", templates)
+	}
+	if templates[0].Description != "Customer invoice" || len(templates[0].Fields) != 1 || templates[0].Fields[0].Name != "Number" {
+		t.Errorf("unexpected invoice %+v", templates[0])
+	}
+
+	if templates, err := NewTemplateRegistry(filepath.Join(dir, "missing")).List(); err != nil || len(templates) != 0 {
+		t.Errorf("missing directory: got %v, %v", templates, err)
+	}
+}
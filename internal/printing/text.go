@@ -0,0 +1,282 @@
+package printing
+
+import (
+	"fmt"
+	"github.com/go-pdf/fpdf"
+	"golang.org/x/text/encoding/htmlindex"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// textCoreFonts are built into PDF viewers, so they need no font files,
+// but support only Western European characters (Windows-1252)
+var textCoreFonts = map[string]string{
+	"monospace":  "Courier",
+	"sans-serif": "Helvetica",
+	"serif":      "Times",
+}
+
+// IsCoreFont checks whether font can be used without font file
+func IsCoreFont(name string) bool {
+	_, ok := textCoreFonts[name]
+	return ok
+}
+
+// TextLayout describes how plain text is laid out on pages
+type TextLayout struct {
+	PageLayout
+	// Core font name, or any name if FontFile is set
+	Font string
+	// TrueType font file, unlike core fonts it supports any characters
+	FontFile string
+	// In points
+	FontSize float64
+	// Long lines are cut off at the right margin when wrapping is disabled
+	Wrap     bool
+	TabWidth int
+	// Printed on each page, "{page}" and "{pages}" are replaced with page number and page count
+	Header string
+	Footer string
+}
+
+// DecodeText converts text in given charset (UTF-8 if empty) to valid UTF-8 string
+func DecodeText(data []byte, charset string) (string, error) {
+	if charset != "" {
+		encoding, err := htmlindex.Get(charset)
+
+		if err != nil {
+			return "", fmt.Errorf("%w: unsupported charset %q", ErrRequestError, charset)
+		}
+
+		data, err = encoding.NewDecoder().Bytes(data)
+
+		if err != nil {
+			return "", fmt.Errorf("%w: %w", ErrRequestError, err)
+		}
+	}
+
+	return strings.TrimPrefix(strings.ToValidUTF8(string(data), "\uFFFD"), "\uFEFF"), nil
+}
+
+// TextRenderer lays out text on as many pages as needed. Form feed characters start new pages
+func TextRenderer(text string, layout TextLayout) JobRenderer {
+	return func() ([]byte, error) {
+		return textToPdf(text, layout)
+	}
+}
+
+func textToPdf(text string, layout TextLayout) ([]byte, error) {
+	page, area, err := layout.printableArea()
+
+	if err != nil {
+		return nil, err
+	}
+
+	doc := fpdf.New("P", "pt", "A4", "")
+	doc.SetAutoPageBreak(false, 0)
+
+	family := layout.Font
+	translate := func(s string) string { return s }
+
+	if layout.FontFile != "" {
+		font, err := os.ReadFile(layout.FontFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		doc.AddUTF8FontFromBytes(family, "", font)
+	} else if coreFamily, ok := textCoreFonts[layout.Font]; ok {
+		family = coreFamily
+		translate = doc.UnicodeTranslatorFromDescriptor("")
+	} else {
+		return nil, fmt.Errorf("%w: unknown font %q", ErrRequestError, layout.Font)
+	}
+
+	doc.SetFont(family, "", layout.FontSize)
+
+	if err := doc.Error(); err != nil {
+		return nil, err
+	}
+
+	widths := map[rune]float64{}
+	runeWidth := func(r rune) float64 {
+		if w, ok := widths[r]; ok {
+			return w
+		}
+		widths[r] = doc.GetStringWidth(translate(string(r)))
+		return widths[r]
+	}
+
+	lineHeight := layout.FontSize * 1.2
+	headerY := area.Y
+	footerY := area.Y + area.H - lineHeight
+
+	// Header and footer are separated from text by an empty line
+	if layout.Header != "" {
+		area.Y += lineHeight * 2
+		area.H -= lineHeight * 2
+	}
+	if layout.Footer != "" {
+		area.H -= lineHeight * 2
+	}
+
+	linesPerPage := int(area.H / lineHeight)
+
+	if linesPerPage < 1 {
+		return nil, fmt.Errorf("%w: font size doesn't fit the page", ErrRequestError)
+	}
+
+	pages := paginateText(normalizeText(text, layout.TabWidth), linesPerPage, func(line string) []string {
+		if layout.Wrap {
+			return wrapLine(line, area.W, runeWidth)
+		}
+		return []string{truncateLine(line, area.W, runeWidth)}
+	})
+
+	pageCount := strconv.Itoa(len(pages))
+
+	// Text is placed by baseline, font size is a bit greater than ascent
+	drawLine := func(line string, y float64, centered bool) {
+		x := area.X
+		if centered {
+			x += (area.W - doc.GetStringWidth(translate(line))) / 2
+		}
+		doc.Text(x, y+layout.FontSize, translate(line))
+	}
+
+	for i, lines := range pages {
+		doc.AddPageFormat("P", page)
+
+		replacer := strings.NewReplacer("{page}", strconv.Itoa(i+1), "{pages}", pageCount)
+
+		if layout.Header != "" {
+			drawLine(truncateLine(replacer.Replace(layout.Header), area.W, runeWidth), headerY, true)
+		}
+		if layout.Footer != "" {
+			drawLine(truncateLine(replacer.Replace(layout.Footer), area.W, runeWidth), footerY, true)
+		}
+
+		for j, line := range lines {
+			drawLine(line, area.Y+float64(j)*lineHeight, false)
+		}
+	}
+
+	return outputPdf(doc)
+}
+
+// normalizeText unifies line endings, expands tabs and removes control characters
+func normalizeText(text string, tabWidth int) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	text = strings.TrimSuffix(text, "\n")
+
+	var result strings.Builder
+	column := 0
+
+	for _, r := range text {
+		switch {
+		case r == '\t':
+			if tabWidth > 0 {
+				spaces := tabWidth - column%tabWidth
+				result.WriteString(strings.Repeat(" ", spaces))
+				column += spaces
+			}
+		case r == '\n' || r == '\f':
+			result.WriteRune(r)
+			column = 0
+		case unicode.IsControl(r):
+		default:
+			result.WriteRune(r)
+			column++
+		}
+	}
+
+	return result.String()
+}
+
+// paginateText splits text into pages, each line may take several rows
+func paginateText(text string, linesPerPage int, rows func(line string) []string) [][]string {
+	var pages [][]string
+	var current []string
+
+	for _, line := range strings.Split(text, "\n") {
+		parts := strings.Split(line, "\f")
+
+		for i, part := range parts {
+			if i > 0 {
+				pages = append(pages, current)
+				current = nil
+			}
+			// Form feed on its own line shouldn't produce empty lines
+			if part == "" && len(parts) > 1 {
+				continue
+			}
+			for _, row := range rows(part) {
+				if len(current) == linesPerPage {
+					pages = append(pages, current)
+					current = nil
+				}
+				current = append(current, row)
+			}
+		}
+	}
+
+	if len(current) > 0 || len(pages) == 0 {
+		pages = append(pages, current)
+	}
+
+	return pages
+}
+
+// wrapLine splits line into rows fitting width, breaking after spaces when possible
+func wrapLine(line string, width float64, runeWidth func(rune) float64) []string {
+	runes := []rune(line)
+
+	var rows []string
+	start := 0
+	lastSpace := -1
+	rowWidth := 0.0
+
+	for i, r := range runes {
+		w := runeWidth(r)
+
+		if rowWidth+w > width && i > start {
+			end := i
+			if lastSpace >= start {
+				end = lastSpace + 1
+			}
+
+			rows = append(rows, string(runes[start:end]))
+			start = end
+			lastSpace = -1
+			rowWidth = 0
+			for _, r := range runes[start:i] {
+				rowWidth += runeWidth(r)
+			}
+		}
+
+		if r == ' ' {
+			lastSpace = i
+		}
+		rowWidth += w
+	}
+
+	return append(rows, string(runes[start:]))
+}
+
+// truncateLine cuts off the part of line which doesn't fit width
+func truncateLine(line string, width float64, runeWidth func(rune) float64) string {
+	lineWidth := 0.0
+
+	for i, r := range line {
+		lineWidth += runeWidth(r)
+		if lineWidth > width {
+			return line[:i]
+		}
+	}
+
+	return line
+}
@@ -0,0 +1,181 @@
+package printing
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Every character is 1 point wide
+func unitWidth(rune) float64 {
+	return 1
+}
+
+func TestWrapLine(t *testing.T) {
+	tests := []struct {
+		line  string
+		width float64
+		want  []string
+	}{
+		{line: "", width: 10, want: []string{""}},
+		{line: "short", width: 10, want: []string{"short"}},
+		{line: "hello world again", width: 11, want: []string{"hello ", "world again"}},
+		{line: "hello world again", width: 8, want: []string{"hello ", "world ", "again"}},
+		{line: "abcdefghij", width: 4, want: []string{"abcd", "efgh", "ij"}},
+		{line: "ab abcdefgh", width: 4, want: []string{"ab ", "abcd", "efgh"}},
+		{line: "привет мир", width: 7, want: []string{"привет ", "мир"}},
+		// At least one character per row, even if it doesn't fit
+		{line: "abc", width: 0.5, want: []string{"a", "b", "c"}},
+	}
+
+	for _, tt := range tests {
+		if got := wrapLine(tt.line, tt.width, unitWidth); !slices.Equal(got, tt.want) {
+			t.Errorf("wrapLine(%q, %v) = %q, want %q", tt.line, tt.width, got, tt.want)
+		}
+	}
+}
+
+func TestTruncateLine(t *testing.T) {
+	tests := []struct {
+		line  string
+		width float64
+		want  string
+	}{
+		{line: "short", width: 10, want: "short"},
+		{line: "long line", width: 4, want: "long"},
+		{line: "привет", width: 3, want: "при"},
+		{line: "", width: 3, want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := truncateLine(tt.line, tt.width, unitWidth); got != tt.want {
+			t.Errorf("truncateLine(%q, %v) = %q, want %q", tt.line, tt.width, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeText(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		tabWidth int
+		want     string
+	}{
+		{name: "line endings", text: "a\r\nb\rc\n", tabWidth: 8, want: "a\nb\nc"},
+		{name: "tabs", text: "a\tb\n\tc", tabWidth: 4, want: "a   b\n    c"},
+		{name: "tabs removed", text: "a\tb", tabWidth: 0, want: "ab"},
+		{name: "control characters", text: "a\x00b\x1bc\fd", tabWidth: 8, want: "abc\fd"},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeText(tt.text, tt.tabWidth); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPaginateText(t *testing.T) {
+	rows := func(line string) []string {
+		return []string{line}
+	}
+
+	tests := []struct {
+		name string
+		text string
+		want [][]string
+	}{
+		{name: "empty", text: "", want: [][]string{{""}}},
+		{name: "single page", text: "a\nb", want: [][]string{{"a", "b"}}},
+		{name: "page overflow", text: "a\nb\nc\nd\ne", want: [][]string{{"a", "b"}, {"c", "d"}, {"e"}}},
+		{name: "form feed", text: "a\fb", want: [][]string{{"a"}, {"b"}}},
+		// Line with form feed only doesn't produce empty rows
+		{name: "form feed line", text: "a\n\f\nb", want: [][]string{{"a"}, {"b"}}},
+	}
+
+	for _, tt := range tests {
+		got := paginateText(tt.text, 2, rows)
+
+		if !slices.EqualFunc(got, tt.want, slices.Equal[[]string]) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeText(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		charset string
+		want    string
+		wantErr bool
+	}{
+		{name: "utf-8", data: []byte("\uFEFFпривет"), want: "привет"},
+		{name: "invalid utf-8", data: []byte("a\xffb"), want: "a\uFFFDb"},
+		{name: "windows-1251", data: []byte{0xEF, 0xF0, 0xE8}, charset: "windows-1251", want: "при"},
+		{name: "unknown charset", data: []byte("a"), charset: "unknown", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := DecodeText(tt.data, tt.charset)
+
+		if tt.wantErr {
+			if !errors.Is(err, ErrRequestError) {
+				t.Errorf("%s: expected request error, got %v", tt.name, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got %q (%v), want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestTextToPdf(t *testing.T) {
+	// A4 with half inch margins fits 64 lines of 87 monospace characters at 10pt
+	page := PageLayout{Paper: PaperSizes["a4"], MarginTop: 0.5, MarginBottom: 0.5, MarginLeft: 0.5, MarginRight: 0.5}
+
+	tests := []struct {
+		name    string
+		text    string
+		layout  TextLayout
+		want    int
+		wantErr error
+	}{
+		{name: "single page", text: "hello", layout: TextLayout{PageLayout: page, Font: "monospace", FontSize: 10}, want: 1},
+		{name: "form feeds", text: "a\fb\fc", layout: TextLayout{PageLayout: page, Font: "serif", FontSize: 10}, want: 3},
+		{name: "many lines", text: strings.Repeat("line\n", 200), layout: TextLayout{PageLayout: page, Font: "monospace", FontSize: 10}, want: 4},
+		// Each line takes 11 rows when wrapped
+		{name: "wrapped", text: strings.Repeat(strings.Repeat("x", 900)+"\n", 10), layout: TextLayout{PageLayout: page, Font: "monospace", FontSize: 10, Wrap: true}, want: 2},
+		{name: "truncated", text: strings.Repeat(strings.Repeat("x", 900)+"\n", 10), layout: TextLayout{PageLayout: page, Font: "monospace", FontSize: 10}, want: 1},
+		{name: "without header", text: strings.Repeat("line\n", 62), layout: TextLayout{PageLayout: page, Font: "monospace", FontSize: 10}, want: 1},
+		// Header and footer take 2 lines each
+		{
+			name:   "with header",
+			text:   strings.Repeat("line\n", 62),
+			layout: TextLayout{PageLayout: page, Font: "monospace", FontSize: 10, Header: "{page} of {pages}", Footer: "footer"},
+			want:   2,
+		},
+		{name: "unknown font", text: "a", layout: TextLayout{PageLayout: page, Font: "fantasy", FontSize: 10}, wantErr: ErrRequestError},
+		{name: "font too large", text: "a", layout: TextLayout{PageLayout: page, Font: "monospace", FontSize: 1000}, wantErr: ErrRequestError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pdf, err := textToPdf(tt.text, tt.layout)
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count := CountPdfPages(pdf); count != tt.want {
+				t.Errorf("got %d pages, want %d", count, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package printing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/downace/print-server/internal/appconfig"
+	"github.com/samber/lo"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const defaultMaxRedirects = 10
+
+var ErrUrlNotAllowed = errors.New("URL is not allowed")
+
+// nonPublicNetworks are special-purpose networks, which are not covered by netip.Addr methods
+var nonPublicNetworks = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+}
+
+// UrlPolicy restricts URLs fetched when printing, including redirects and resources loaded by pages.
+// Hosts resolving to non-public addresses are not allowed, so print requests can't reach internal services
+type UrlPolicy struct {
+	schemes         []string
+	allowedHosts    []string
+	deniedHosts     []string
+	allowedNetworks []netip.Prefix
+	maxRedirects    int
+	// Checks addresses when connecting, see NewUrlPolicy
+	dialer    *net.Dialer
+	transport *http.Transport
+}
+
+func NewUrlPolicy(config appconfig.UrlPolicyConfig) *UrlPolicy {
+	p := &UrlPolicy{
+		schemes:      lo.CoalesceSliceOrEmpty(config.AllowedSchemes, []string{"http", "https"}),
+		allowedHosts: config.AllowedHosts,
+		deniedHosts:  config.DeniedHosts,
+		maxRedirects: config.MaxRedirects,
+	}
+
+	if p.maxRedirects <= 0 {
+		p.maxRedirects = defaultMaxRedirects
+	}
+
+	for _, network := range config.AllowedNetworks {
+		prefix, err := netip.ParsePrefix(network)
+		if err != nil {
+			log.Printf("invalid allowed network %q: %s", network, err)
+			continue
+		}
+		p.allowedNetworks = append(p.allowedNetworks, prefix)
+	}
+
+	p.dialer = &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		// Address is checked when connecting, after host is resolved, so host can't resolve to another address later
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addr, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			return p.checkAddr(addr.Addr())
+		},
+	}
+
+	p.transport = http.DefaultTransport.(*http.Transport).Clone()
+	// Proxy would be connected instead of the host, so the host address couldn't be checked
+	p.transport.Proxy = nil
+	p.transport.DialContext = p.dialer.DialContext
+
+	return p
+}
+
+// matchHost reports whether host is one of patterns, "*.example.com" matches subdomains of example.com
+func matchHost(host string, patterns []string) bool {
+	host = strings.ToLower(host)
+
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if domain, ok := strings.CutPrefix(pattern, "*."); ok {
+			if strings.HasSuffix(host, "."+domain) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Check checks URL and addresses of its host, so print request can be rejected before it is queued.
+// URLs are checked again when they are fetched
+func (p *UrlPolicy) Check(ctx context.Context, rawUrl string) error {
+	u, err := url.Parse(rawUrl)
+
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRequestError, err)
+	}
+
+	if err := p.checkUrl(u); err != nil {
+		return err
+	}
+
+	return p.checkHost(ctx, u.Hostname())
+}
+
+// checkUrl checks scheme and host name
+func (p *UrlPolicy) checkUrl(u *url.URL) error {
+	if !slices.Contains(p.schemes, u.Scheme) {
+		return fmt.Errorf("%w: scheme %s is not allowed", ErrUrlNotAllowed, u.Scheme)
+	}
+
+	host := u.Hostname()
+
+	if matchHost(host, p.deniedHosts) || len(p.allowedHosts) > 0 && !matchHost(host, p.allowedHosts) {
+		return fmt.Errorf("%w: host %s is not allowed", ErrUrlNotAllowed, host)
+	}
+
+	return nil
+}
+
+// checkHost resolves host and checks all its addresses
+func (p *UrlPolicy) checkHost(ctx context.Context, host string) error {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return p.checkAddr(addr)
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRequestError, err)
+	}
+
+	for _, addr := range addrs {
+		if err := p.checkAddr(addr); err != nil {
+			return fmt.Errorf("%w (%s)", err, host)
+		}
+	}
+
+	return nil
+}
+
+func (p *UrlPolicy) checkAddr(addr netip.Addr) error {
+	addr = addr.Unmap()
+
+	for _, network := range p.allowedNetworks {
+		if network.Contains(addr) {
+			return nil
+		}
+	}
+
+	isPublic := addr.IsGlobalUnicast() && !addr.IsPrivate() &&
+		!slices.ContainsFunc(nonPublicNetworks, func(network netip.Prefix) bool { return network.Contains(addr) })
+
+	if !isPublic {
+		return fmt.Errorf("%w: address %s is not public", ErrUrlNotAllowed, addr)
+	}
+
+	return nil
+}
+
+// httpClient checks redirects and addresses of connected hosts, credentials are added to requests to their hosts
+func (p *UrlPolicy) httpClient(auth UrlAuth) *http.Client {
+	var transport http.RoundTripper = p.transport
+
+	if len(auth) > 0 {
+		transport = authTransport{auth: auth, next: transport}
+	}
+
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > p.maxRedirects {
+				return fmt.Errorf("%w: stopped after %d redirects", ErrUrlNotAllowed, p.maxRedirects)
+			}
+			return p.checkUrl(req.URL)
+		},
+	}
+}
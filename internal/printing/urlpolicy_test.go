@@ -0,0 +1,114 @@
+package printing
+
+import (
+	"context"
+	"errors"
+	"github.com/downace/print-server/internal/appconfig"
+	"github.com/samber/lo"
+	"net/netip"
+	"net/url"
+	"testing"
+)
+
+func TestMatchHost(t *testing.T) {
+	patterns := []string{"example.com", "*.Example.org"}
+
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{host: "example.com", want: true},
+		{host: "EXAMPLE.com", want: true},
+		{host: "www.example.com", want: false},
+		{host: "www.example.org", want: true},
+		{host: "a.b.example.org", want: true},
+		{host: "example.org", want: false},
+		{host: "badexample.org", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := matchHost(tt.host, patterns); got != tt.want {
+			t.Errorf("matchHost(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestUrlPolicyCheckAddr(t *testing.T) {
+	p := NewUrlPolicy(appconfig.UrlPolicyConfig{AllowedNetworks: []string{"10.1.0.0/16", "invalid"}})
+
+	tests := []struct {
+		addr    string
+		allowed bool
+	}{
+		{addr: "93.184.215.14", allowed: true},
+		{addr: "2606:2800:21f:cb07:6820:80da:af6b:8b2c", allowed: true},
+		{addr: "127.0.0.1", allowed: false},
+		{addr: "::1", allowed: false},
+		{addr: "::ffff:127.0.0.1", allowed: false},
+		{addr: "10.0.0.1", allowed: false},
+		{addr: "10.1.2.3", allowed: true},
+		{addr: "::ffff:10.1.2.3", allowed: true},
+		{addr: "172.16.0.1", allowed: false},
+		{addr: "192.168.1.1", allowed: false},
+		{addr: "169.254.169.254", allowed: false},
+		{addr: "100.64.0.1", allowed: false},
+		{addr: "0.0.0.0", allowed: false},
+		{addr: "fc00::1", allowed: false},
+		{addr: "fe80::1", allowed: false},
+		{addr: "224.0.0.1", allowed: false},
+		{addr: "255.255.255.255", allowed: false},
+	}
+
+	for _, tt := range tests {
+		err := p.checkAddr(netip.MustParseAddr(tt.addr))
+
+		if tt.allowed && err != nil {
+			t.Errorf("%s is not allowed: %s", tt.addr, err)
+		} else if !tt.allowed && !errors.Is(err, ErrUrlNotAllowed) {
+			t.Errorf("%s is allowed", tt.addr)
+		}
+	}
+}
+
+func TestUrlPolicyCheckUrl(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  appconfig.UrlPolicyConfig
+		url     string
+		allowed bool
+	}{
+		{name: "https", url: "https://example.com/", allowed: true},
+		{name: "file", url: "file:///etc/passwd", allowed: false},
+		{name: "websocket", url: "wss://example.com/", allowed: false},
+		{name: "allowed scheme", config: appconfig.UrlPolicyConfig{AllowedSchemes: []string{"https"}}, url: "http://example.com/", allowed: false},
+		{name: "denied host", config: appconfig.UrlPolicyConfig{DeniedHosts: []string{"*.example.com"}}, url: "https://www.example.com/", allowed: false},
+		{name: "allowed hosts", config: appconfig.UrlPolicyConfig{AllowedHosts: []string{"example.com"}}, url: "https://example.com/", allowed: true},
+		{name: "not allowed host", config: appconfig.UrlPolicyConfig{AllowedHosts: []string{"example.com"}}, url: "https://example.org/", allowed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewUrlPolicy(tt.config).checkUrl(lo.Must(url.Parse(tt.url)))
+
+			if tt.allowed && err != nil {
+				t.Errorf("URL is not allowed: %s", err)
+			} else if !tt.allowed && !errors.Is(err, ErrUrlNotAllowed) {
+				t.Error("URL is allowed")
+			}
+		})
+	}
+}
+
+func TestUrlPolicyCheck(t *testing.T) {
+	p := NewUrlPolicy(appconfig.UrlPolicyConfig{})
+
+	if err := p.Check(context.Background(), "http://127.0.0.1:8888/printers"); !errors.Is(err, ErrUrlNotAllowed) {
+		t.Errorf("loopback URL is allowed: %v", err)
+	}
+	if err := p.Check(context.Background(), "http://[::1]/"); !errors.Is(err, ErrUrlNotAllowed) {
+		t.Errorf("loopback URL is allowed: %v", err)
+	}
+	if err := p.Check(context.Background(), "://"); !errors.Is(err, ErrRequestError) {
+		t.Errorf("expected request error, got %v", err)
+	}
+}
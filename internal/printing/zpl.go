@@ -0,0 +1,135 @@
+package printing
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/downace/print-server/internal/zpl"
+	"image/png"
+	"io"
+	"slices"
+)
+
+const (
+	defaultZplDpi         = 203
+	defaultZplLabelWidth  = 4
+	defaultZplLabelHeight = 6
+)
+
+// ZplLabel is label size in inches and resolution of the printer it was designed for
+type ZplLabel struct {
+	Dpi    int
+	Width  float64
+	Height float64
+}
+
+func (l ZplLabel) withDefaults() ZplLabel {
+	if l.Dpi <= 0 {
+		l.Dpi = defaultZplDpi
+	}
+	if l.Width <= 0 {
+		l.Width = defaultZplLabelWidth
+	}
+	if l.Height <= 0 {
+		l.Height = defaultZplLabelHeight
+	}
+	return l
+}
+
+func renderZpl(data []byte, label ZplLabel) ([]imagePage, error) {
+	label = label.withDefaults()
+	images, err := zpl.Render(data, label.Dpi, label.Width, label.Height)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrRequestError, err)
+	}
+
+	pages := make([]imagePage, 0, len(images))
+
+	for _, img := range images {
+		// Label size may be set in ZPL, so page size is taken from image
+		pages = append(pages, imagePage{
+			Image:  img,
+			Width:  float64(img.Bounds().Dx()) / float64(label.Dpi) * 72,
+			Height: float64(img.Bounds().Dy()) / float64(label.Dpi) * 72,
+		})
+	}
+
+	return pages, nil
+}
+
+// ZplToPdf renders each label on a separate page of label size
+func ZplToPdf(data []byte, label ZplLabel) ([]byte, error) {
+	pages, err := renderZpl(data, label)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return imagesToPdf(pages)
+}
+
+// ZplToPng renders a single label, index starts with 0
+func ZplToPng(data []byte, label ZplLabel, index int) ([]byte, error) {
+	pages, err := renderZpl(data, label)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if index < 0 || index >= len(pages) {
+		return nil, fmt.Errorf("%w: there are only %d labels", ErrRequestError, len(pages))
+	}
+
+	var result bytes.Buffer
+
+	if err := png.Encode(&result, pages[index].Image); err != nil {
+		return nil, err
+	}
+
+	return result.Bytes(), nil
+}
+
+// ZplFallbackPrinter is a regular printer, which receives ZPL labels as PDF
+type ZplFallbackPrinter struct {
+	Name string
+	ZplLabel
+}
+
+// zplFallbackBackend renders ZPL sent to fallback printers and passes everything else to the next backend
+type zplFallbackBackend struct {
+	Backend
+	printers []ZplFallbackPrinter
+}
+
+func NewZplFallbackBackend(printers []ZplFallbackPrinter, next Backend) Backend {
+	return &zplFallbackBackend{Backend: next, printers: printers}
+}
+
+// PrintRaw prints data as is, unless it is ZPL sent to fallback printer
+func (b *zplFallbackBackend) PrintRaw(printer string, file io.Reader) (string, error) {
+	i := slices.IndexFunc(b.printers, func(p ZplFallbackPrinter) bool {
+		return p.Name == printer
+	})
+
+	if i < 0 {
+		return b.Backend.PrintRaw(printer, file)
+	}
+
+	data, err := io.ReadAll(file)
+
+	if err != nil {
+		return "", err
+	}
+
+	if !zpl.IsZpl(data) {
+		return b.Backend.PrintRaw(printer, bytes.NewReader(data))
+	}
+
+	pdf, err := ZplToPdf(data, b.printers[i].ZplLabel)
+
+	if err != nil {
+		return "", err
+	}
+
+	return b.Backend.PrintPDF(printer, bytes.NewReader(pdf), PrintOptions{})
+}
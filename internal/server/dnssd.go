@@ -0,0 +1,116 @@
+package server
+
+import (
+	"github.com/downace/print-server/internal/printing"
+	"github.com/hashicorp/mdns"
+	"github.com/miekg/dns"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// mdnsZones answers DNS-SD queries for several services
+type mdnsZones []*mdns.MDNSService
+
+func (z mdnsZones) Records(q dns.Question) []dns.RR {
+	var records []dns.RR
+	for _, service := range z {
+		records = append(records, service.Records(q)...)
+	}
+	return records
+}
+
+// advertisePrinters announces each printer as IPP Everywhere printer, see PWG 5100.14.
+// Printers added later are not announced until listener is restarted
+func advertisePrinters(backend printing.Backend, host netip.Addr, port uint16, tls bool, authEnabled bool) (*mdns.Server, error) {
+	printers, err := backend.ListPrinters()
+
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, err := os.Hostname()
+
+	if err != nil {
+		return nil, err
+	}
+
+	ips, err := advertisedIps(host)
+
+	if err != nil {
+		return nil, err
+	}
+
+	serviceType := "_ipp._tcp"
+	if tls {
+		serviceType = "_ipps._tcp"
+	}
+
+	zones := make(mdnsZones, 0, len(printers))
+
+	for _, p := range printers {
+		// Zero details are fine, they only affect TXT record
+		details, _ := backend.GetPrinter(p.Name)
+
+		txt := []string{
+			"txtvers=1",
+			"qtotal=1",
+			"rp=" + strings.TrimPrefix(ippPrinterPath, "/") + p.Name,
+			"ty=" + p.Name,
+			"pdl=" + strings.Join(ippDocumentFormats, ","),
+			"UUID=" + strings.TrimPrefix(ippPrinterUuid(p.Name), "urn:uuid:"),
+			"Color=" + dnssdBool(details.Color),
+			"Duplex=" + dnssdBool(details.Duplex),
+			"kind=document",
+		}
+		if tls {
+			txt = append(txt, "TLS=1.2")
+		}
+		if authEnabled {
+			txt = append(txt, "air=username,password")
+		}
+
+		// Dots would be treated as DNS label separators
+		instance := strings.ReplaceAll(p.Name, ".", " ")
+		service, err := mdns.NewMDNSService(instance, serviceType, "", hostname+".local.", int(port), ips, txt)
+
+		if err != nil {
+			return nil, err
+		}
+
+		zones = append(zones, service)
+	}
+
+	return mdns.NewServer(&mdns.Config{Zone: zones})
+}
+
+// advertisedIps returns listen address, or all non-loopback addresses if server listens on all interfaces
+func advertisedIps(host netip.Addr) ([]net.IP, error) {
+	if !host.IsUnspecified() {
+		return []net.IP{host.AsSlice()}, nil
+	}
+
+	addrs, err := net.InterfaceAddrs()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var ips []net.IP
+
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && !ipNet.IP.IsLinkLocalUnicast() {
+			ips = append(ips, ipNet.IP)
+		}
+	}
+
+	return ips, nil
+}
+
+func dnssdBool(b bool) string {
+	if b {
+		return "T"
+	}
+	return "F"
+}
@@ -1,19 +1,37 @@
 package server
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"github.com/downace/print-server/internal/appconfig"
 	"github.com/downace/print-server/internal/printing"
 	"github.com/go-playground/form/v4"
 	"github.com/go-playground/validator/v10"
 	"github.com/go-rod/rod/lib/proto"
+	"github.com/gorilla/mux"
+	"github.com/samber/lo"
+	"io"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
 )
 
 func RespondOk(w http.ResponseWriter, data interface{}) {
 	respondJson(w, data, http.StatusOK)
 }
 
+func RespondAccepted(w http.ResponseWriter, data interface{}) {
+	respondJson(w, data, http.StatusAccepted)
+}
+
 func RespondError(w http.ResponseWriter, message string, status int) {
 	respondJson(w, map[string]string{"message": message}, status)
 }
@@ -34,26 +52,116 @@ func respondJson(w http.ResponseWriter, data interface{}, status int) {
 }
 
 func handleError(err error, w http.ResponseWriter) {
-	if errors.Is(err, printing.ErrNotSupported) {
+	var sizeErr *http.MaxBytesError
+	if errors.As(err, &sizeErr) {
+		respondBodyTooLarge(w, sizeErr)
+	} else if errors.Is(err, printing.ErrNotSupported) {
 		RespondError(w, err.Error(), http.StatusNotImplemented)
 	} else if errors.Is(err, printing.ErrRequestError) {
 		RespondError(w, err.Error(), http.StatusUnprocessableEntity)
+	} else if errors.Is(err, printing.ErrUrlNotAllowed) {
+		RespondError(w, err.Error(), http.StatusForbidden)
+	} else if errors.Is(err, printing.ErrJobNotFound) || errors.Is(err, printing.ErrPrinterNotFound) || errors.Is(err, printing.ErrTemplateNotFound) {
+		RespondError(w, err.Error(), http.StatusNotFound)
+	} else if errors.Is(err, printing.ErrJobNotCancellable) {
+		RespondError(w, err.Error(), http.StatusConflict)
+	} else if errors.Is(err, printing.ErrDocumentNotRetained) {
+		RespondError(w, err.Error(), http.StatusGone)
+	} else if errors.Is(err, printing.ErrQueueFull) || errors.Is(err, printing.ErrQueueClosed) {
+		RespondError(w, err.Error(), http.StatusServiceUnavailable)
 	} else {
 		RespondError(w, err.Error(), http.StatusInternalServerError)
 	}
 }
 
 func validateRequest[T any](r *http.Request) (*T, error) {
+	return validateValues[T](r.URL.Query())
+}
+
+// validateParamsRequest takes params from JSON object in request body, if request has JSON body,
+// so long params don't have to be put in URL. Query params are used as well, JSON params override them
+func validateParamsRequest[T any](r *http.Request) (*T, error) {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		return validateRequest[T](r)
+	}
+
+	values := r.URL.Query()
+	body, err := decodeJsonParams(r.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for name, value := range body {
+		values[name] = value
+	}
+
+	return validateValues[T](values)
+}
+
+// decodeJsonParams converts JSON object to params, so it is decoded the same way as query.
+// Arrays are the same as repeated params
+func decodeJsonParams(body io.Reader) (url.Values, error) {
+	decoder := json.NewDecoder(body)
+	// Keeps numbers as is, e.g. 1000000 would become 1e+06 otherwise
+	decoder.UseNumber()
+
+	var object map[string]any
+
+	if err := decoder.Decode(&object); err != nil {
+		return nil, fmt.Errorf("%w: invalid JSON: %w", printing.ErrRequestError, err)
+	}
+
+	values := url.Values{}
+
+	for name, value := range object {
+		items, ok := value.([]any)
+		if !ok {
+			items = []any{value}
+		}
+
+		for _, item := range items {
+			switch item.(type) {
+			case nil:
+			case map[string]any, []any:
+				return nil, fmt.Errorf("%w: %s must be a string, number or boolean", printing.ErrRequestError, name)
+			default:
+				values.Add(name, fmt.Sprint(item))
+			}
+		}
+	}
+
+	return values, nil
+}
+
+func validateValues[T any](values url.Values) (*T, error) {
 	dec := form.NewDecoder()
 	var result T
-	err := dec.Decode(&result, r.URL.Query())
+	err := dec.Decode(&result, values)
 
 	if err != nil {
 		return nil, err
 	}
 
-	validate := validator.New(validator.WithRequiredStructEnabled())
-	err = validate.Struct(result)
+	err = newValidator().Struct(result)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// decodeJsonBody is the same as validateRequest, but for JSON request body
+func decodeJsonBody[T any](r *http.Request) (*T, error) {
+	var result T
+	err := json.NewDecoder(r.Body).Decode(&result)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid JSON: %w", printing.ErrRequestError, err)
+	}
+
+	err = newValidator().Struct(result)
 
 	if err != nil {
 		return nil, err
@@ -62,17 +170,146 @@ func validateRequest[T any](r *http.Request) (*T, error) {
 	return &result, nil
 }
 
+func newValidator() *validator.Validate {
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	lo.Must0(validate.RegisterValidation("pageranges", validatePageRanges))
+	lo.Must0(validate.RegisterValidation("jobstate", validateJobState))
+	// Errors are reported using param names
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.Split(field.Tag.Get("form"), ",")[0]
+		if name == "" {
+			name = strings.Split(field.Tag.Get("json"), ",")[0]
+		}
+		return name
+	})
+	return validate
+}
+
+var pageRangesRegexp = regexp.MustCompile(`^\d+(-\d+)?(,\d+(-\d+)?)*$`)
+
+func validatePageRanges(fl validator.FieldLevel) bool {
+	return pageRangesRegexp.MatchString(fl.Field().String())
+}
+
+func validateJobState(fl validator.FieldLevel) bool {
+	return slices.Contains(printing.JobStates, printing.JobState(fl.Field().String()))
+}
+
+// handleValidateRequestError reports invalid params in "errors" field, e.g. {"copies": "must be at most 999"}
 func handleValidateRequestError(w http.ResponseWriter, err error) {
 	var valErr validator.ValidationErrors
-	if errors.As(err, &valErr) {
+	var decErr form.DecodeErrors
+	var sizeErr *http.MaxBytesError
+	if errors.As(err, &sizeErr) {
+		respondBodyTooLarge(w, sizeErr)
+	} else if errors.As(err, &valErr) {
+		respondInvalidParams(w, err, validationErrorMessages(valErr))
+	} else if errors.As(err, &decErr) {
+		respondInvalidParams(w, err, lo.MapValues(decErr, func(_ error, _ string) string {
+			return "has invalid value"
+		}))
+	} else if errors.Is(err, printing.ErrRequestError) {
 		RespondError(w, err.Error(), http.StatusUnprocessableEntity)
 	} else {
 		RespondError(w, err.Error(), http.StatusInternalServerError)
 	}
 }
 
-func getPrinters(w http.ResponseWriter, _ *http.Request) {
-	printers, err := printing.ListPrinters()
+func respondBodyTooLarge(w http.ResponseWriter, err *http.MaxBytesError) {
+	RespondError(w, fmt.Sprintf("request body is larger than %d bytes", err.Limit), http.StatusRequestEntityTooLarge)
+}
+
+func respondInvalidParams(w http.ResponseWriter, err error, messages map[string]string) {
+	respondJson(w, map[string]any{"message": err.Error(), "errors": messages}, http.StatusUnprocessableEntity)
+}
+
+// validationErrorMessages are keyed by param path, e.g. "url" or "elements[0].type"
+func validationErrorMessages(errs validator.ValidationErrors) map[string]string {
+	messages := make(map[string]string, len(errs))
+
+	for _, fe := range errs {
+		// Top-level struct and embedded structs have no param names, so their names are the same in both namespaces
+		structPath := strings.Split(fe.StructNamespace(), ".")
+		var path []string
+		for i, name := range strings.Split(fe.Namespace(), ".") {
+			if i >= len(structPath) || name != structPath[i] {
+				path = append(path, name)
+			}
+		}
+		messages[strings.Join(path, ".")] = validationErrorMessage(fe)
+	}
+
+	return messages
+}
+
+func validationErrorMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required", "required_if":
+		return "is required"
+	case "oneof":
+		return "must be one of: " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	case "url":
+		return "must be a valid URL"
+	case "base64":
+		return "must be base64-encoded"
+	case "pageranges":
+		return "must be page ranges, e.g. 1-3,5"
+	case "jobstate":
+		return "must be one of: " + strings.Join(lo.Map(printing.JobStates, func(s printing.JobState, _ int) string {
+			return string(s)
+		}), ", ")
+	case "gt":
+		return "must be greater than " + fe.Param()
+	case "gte":
+		return "must be at least " + fe.Param()
+	case "lte":
+		return "must be at most " + fe.Param()
+	case "max":
+		if fe.Kind() == reflect.Slice {
+			return "must have at most " + fe.Param() + " values"
+		}
+		return "must be at most " + fe.Param() + " characters long"
+	case "len":
+		return "must be " + fe.Param() + " characters long"
+	default:
+		return "is invalid"
+	}
+}
+
+type api struct {
+	backend printing.Backend
+	jobs    *printing.JobQueue
+	fonts   []appconfig.FontConfig
+	office  *printing.OfficeConverter
+	// Printers allowed to receive raw data from HTTP API
+	rawPrinters []string
+	templates   *printing.TemplateRegistry
+	browser     *printing.BrowserPool
+	urlPolicy   *printing.UrlPolicy
+	// Header and footer presets for pages converted to PDF
+	headerFooters []appconfig.HeaderFooterConfig
+	// Credentials for URLs printed by /print-pdf-url and /print-url
+	urlCredentials []appconfig.UrlCredentialsConfig
+}
+
+func (a *api) submitJob(w http.ResponseWriter, r *http.Request, request printing.JobRequest) {
+	request.ClientIP, _, _ = net.SplitHostPort(r.RemoteAddr)
+	if user, _, ok := r.BasicAuth(); ok {
+		request.User = user
+	}
+
+	job, err := a.jobs.Submit(request)
+
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+
+	RespondAccepted(w, job)
+}
+
+func (a *api) getPrinters(w http.ResponseWriter, _ *http.Request) {
+	printers, err := a.backend.ListPrinters()
 
 	if err != nil {
 		handleError(err, w)
@@ -82,11 +319,49 @@ func getPrinters(w http.ResponseWriter, _ *http.Request) {
 	RespondOk(w, map[string][]printing.Printer{"printers": printers})
 }
 
+func (a *api) getPrinter(w http.ResponseWriter, r *http.Request) {
+	printer, err := a.backend.GetPrinter(mux.Vars(r)["name"])
+
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+
+	RespondOk(w, printer)
+}
+
+type PrintOptionsQuery struct {
+	Copies      int    `form:"copies" validate:"gte=0,lte=999"`
+	Sides       string `form:"sides" validate:"omitempty,oneof=one-sided two-sided-long-edge two-sided-short-edge"`
+	ColorMode   string `form:"color-mode" validate:"omitempty,oneof=color monochrome"`
+	Media       string `form:"media" validate:"omitempty,max=64,printascii,excludesall=0x20"`
+	InputTray   string `form:"tray" validate:"omitempty,max=64,printascii,excludesall=0x20"`
+	PageRanges  string `form:"page-ranges" validate:"omitempty,pageranges"`
+	FitToPage   bool   `form:"fit-to-page"`
+	Orientation string `form:"orientation" validate:"omitempty,oneof=portrait landscape"`
+	Collate     *bool  `form:"collate"`
+}
+
+func (q PrintOptionsQuery) ToPrintOptions() printing.PrintOptions {
+	return printing.PrintOptions{
+		Copies:      q.Copies,
+		Sides:       q.Sides,
+		ColorMode:   q.ColorMode,
+		Media:       q.Media,
+		InputTray:   q.InputTray,
+		PageRanges:  q.PageRanges,
+		FitToPage:   q.FitToPage,
+		Orientation: q.Orientation,
+		Collate:     q.Collate,
+	}
+}
+
 type PrintPdfQuery struct {
 	Printer string `form:"printer" validate:"required"`
+	PrintOptionsQuery
 }
 
-func printPdf(w http.ResponseWriter, r *http.Request) {
+func (a *api) printPdf(w http.ResponseWriter, r *http.Request) {
 	q, err := validateRequest[PrintPdfQuery](r)
 
 	if err != nil {
@@ -94,81 +369,1170 @@ func printPdf(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = printing.PrintPDF(q.Printer, r.Body)
+	data, err := io.ReadAll(r.Body)
 
 	if err != nil {
 		handleError(err, w)
 		return
 	}
 
-	RespondOk(w, nil)
+	a.submitJob(w, r, printing.JobRequest{
+		Printer: q.Printer,
+		Source:  printing.JobSourceUpload,
+		Options: q.ToPrintOptions(),
+		Render:  printing.PdfRenderer(data),
+	})
 }
 
-type PrintPdfFromUrlQuery struct {
+type PrintPdfJsonRequest struct {
+	PrintPdfQuery
+	// Base64-encoded PDF file
+	Content string `form:"content" validate:"required,base64"`
+}
+
+// printPdfJson is the same as printPdf, but takes params and PDF file from JSON body
+func (a *api) printPdfJson(w http.ResponseWriter, r *http.Request) {
+	q, err := validateParamsRequest[PrintPdfJsonRequest](r)
+
+	if err != nil {
+		handleValidateRequestError(w, err)
+		return
+	}
+
+	data, err := base64.StdEncoding.DecodeString(q.Content)
+
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+
+	a.submitJob(w, r, printing.JobRequest{
+		Printer: q.Printer,
+		Source:  printing.JobSourceUpload,
+		Options: q.ToPrintOptions(),
+		Render:  printing.PdfRenderer(data),
+	})
+}
+
+type PrintDocumentQuery struct {
 	Printer string `form:"printer" validate:"required"`
-	Url     string `form:"url" validate:"required,url"`
+	PrintOptionsQuery
 }
 
-func printPdfFromUrl(w http.ResponseWriter, r *http.Request) {
-	q, err := validateRequest[PrintPdfFromUrlQuery](r)
+// printDocument accepts PDF and office documents, format is detected by content
+func (a *api) printDocument(w http.ResponseWriter, r *http.Request) {
+	q, err := validateRequest[PrintDocumentQuery](r)
 
 	if err != nil {
 		handleValidateRequestError(w, err)
 		return
 	}
 
-	err = printing.PrintPDFFromUrl(q.Printer, q.Url)
+	data, err := io.ReadAll(r.Body)
 
 	if err != nil {
 		handleError(err, w)
 		return
 	}
 
-	RespondOk(w, nil)
+	if !printing.IsPdf(data) && printing.OfficeDocumentType(data) == "" {
+		handleError(printing.ErrUnsupportedDocument, w)
+		return
+	}
+
+	a.submitJob(w, r, printing.JobRequest{
+		Printer: q.Printer,
+		Source:  printing.JobSourceDocument,
+		Options: q.ToPrintOptions(),
+		Render:  printing.DocumentRenderer(data, a.office),
+	})
 }
 
-type PrintFromUrlQuery struct {
+type PrintRawQuery struct {
 	Printer string `form:"printer" validate:"required"`
-	Url     string `form:"url" validate:"required,url"`
+}
 
-	// See proto.PagePrintToPDF
-	Orientation  *string  `form:"orientation" validate:"omitnil,oneof=portrait landscape"`
-	PaperWidth   *float64 `form:"paper-width" validate:"omitnil,gt=0"`
-	PaperHeight  *float64 `form:"paper-height" validate:"omitnil,gt=0"`
-	MarginTop    *float64 `form:"margin-top" validate:"omitnil,gte=0"`
-	MarginBottom *float64 `form:"margin-bottom" validate:"omitnil,gte=0"`
-	MarginLeft   *float64 `form:"margin-left" validate:"omitnil,gte=0"`
-	MarginRight  *float64 `form:"margin-right" validate:"omitnil,gte=0"`
-	Pages        string   `form:"pages"`
+// printRaw sends data to the printer as is, print options are not supported,
+// since they are part of printer-specific data
+func (a *api) printRaw(w http.ResponseWriter, r *http.Request) {
+	q, err := validateRequest[PrintRawQuery](r)
+
+	if err != nil {
+		handleValidateRequestError(w, err)
+		return
+	}
+
+	if !slices.Contains(a.rawPrinters, q.Printer) {
+		RespondError(w, "raw printing is not allowed for printer "+q.Printer, http.StatusForbidden)
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+
+	a.submitJob(w, r, printing.JobRequest{
+		Printer: q.Printer,
+		Source:  printing.JobSourceRaw,
+		Raw:     true,
+		Render:  printing.PdfRenderer(data),
+	})
+}
+
+type PrintReceiptQuery struct {
+	Printer string `form:"printer" validate:"required"`
+	// In mm
+	PaperWidth int `form:"paper-width" validate:"omitempty,oneof=58 80"`
+	// escpos is for thermal printers, pdf is for regular printers
+	Format string `form:"format" validate:"omitempty,oneof=escpos pdf"`
+	// Used with pdf format only
+	PrintOptionsQuery
+}
+
+// printReceipt compiles receipt when request is received, so invalid receipts are rejected immediately
+func (a *api) printReceipt(w http.ResponseWriter, r *http.Request) {
+	q, err := validateRequest[PrintReceiptQuery](r)
+
+	if err != nil {
+		handleValidateRequestError(w, err)
+		return
+	}
+
+	receipt, err := decodeJsonBody[printing.Receipt](r)
+
+	if err != nil {
+		handleValidateRequestError(w, err)
+		return
+	}
+
+	paperWidth := lo.CoalesceOrEmpty(q.PaperWidth, 80)
+
+	if q.Format == "pdf" {
+		data, err := printing.ReceiptToPdf(*receipt, paperWidth)
+
+		if err != nil {
+			handleError(err, w)
+			return
+		}
+
+		a.submitJob(w, r, printing.JobRequest{
+			Printer: q.Printer,
+			Source:  printing.JobSourceReceipt,
+			Options: q.ToPrintOptions(),
+			Render:  printing.PdfRenderer(data),
+		})
+		return
+	}
+
+	if !slices.Contains(a.rawPrinters, q.Printer) {
+		RespondError(w, "raw printing is not allowed for printer "+q.Printer, http.StatusForbidden)
+		return
+	}
+
+	data, err := printing.ReceiptToEscPos(*receipt, paperWidth)
+
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+
+	a.submitJob(w, r, printing.JobRequest{
+		Printer: q.Printer,
+		Source:  printing.JobSourceReceipt,
+		Raw:     true,
+		Render:  printing.PdfRenderer(data),
+	})
+}
+
+func (a *api) getTemplates(w http.ResponseWriter, _ *http.Request) {
+	templates, err := a.templates.List()
+
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+
+	RespondOk(w, map[string]any{"templates": templates})
+}
+
+type PrintTemplateQuery struct {
+	Printer string `form:"printer" validate:"required"`
+	// Query params override template settings
+	PrintOptionsQuery
+	PagePrintQuery
+	PageWaitQuery
+}
+
+func (q PrintTemplateQuery) ToPrintOptions() printing.PrintOptions {
+	options := q.PrintOptionsQuery.ToPrintOptions()
+	options.Orientation = ""
+	return options
+}
+
+// printTemplate renders template when request is received, so missing fields are reported immediately
+func (a *api) printTemplate(w http.ResponseWriter, r *http.Request) {
+	q, err := validateRequest[PrintTemplateQuery](r)
+
+	if err != nil {
+		handleValidateRequestError(w, err)
+		return
+	}
+
+	// Template data is not validated, except for required fields
+	var data map[string]any
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		handleError(fmt.Errorf("%w: invalid JSON: %w", printing.ErrRequestError, err), w)
+		return
+	}
+
+	document, settings, err := a.templates.Render(mux.Vars(r)["name"], data)
+
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+
+	params := settings.ToPrintParams()
+	if q.Orientation != "" {
+		params.Landscape = q.Orientation == "landscape"
+	}
+	q.applyTo(params)
+
+	if err := a.applyHeaderFooter(lo.CoalesceOrEmpty(q.HeaderFooter, settings.HeaderFooter), params); err != nil {
+		handleError(err, w)
+		return
+	}
+
+	a.submitJob(w, r, printing.JobRequest{
+		Printer: q.Printer,
+		Source:  printing.JobSourceTemplate,
+		Options: q.ToPrintOptions(),
+		Render:  printing.HtmlRenderer(document, params, q.ToPageWait(), a.browser),
+	})
+}
+
+type RenderZplQuery struct {
+	Dpi int `form:"dpi" validate:"omitempty,oneof=152 203 300 600"`
+	// Label size in inches
+	Width  float64 `form:"width" validate:"gte=0,lte=15"`
+	Height float64 `form:"height" validate:"gte=0,lte=15"`
+	Format string  `form:"format" validate:"omitempty,oneof=pdf png"`
+	// Label number for png format, starting with 1
+	Label int `form:"label" validate:"gte=0"`
+}
+
+// renderZpl responds with rendered labels instead of printing them, so labels can be previewed
+func (a *api) renderZpl(w http.ResponseWriter, r *http.Request) {
+	q, err := validateRequest[RenderZplQuery](r)
+
+	if err != nil {
+		handleValidateRequestError(w, err)
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+
+	label := printing.ZplLabel{Dpi: q.Dpi, Width: q.Width, Height: q.Height}
+	contentType := "application/pdf"
+	var result []byte
+
+	if q.Format == "png" {
+		contentType = "image/png"
+		result, err = printing.ZplToPng(data, label, lo.CoalesceOrEmpty(q.Label, 1)-1)
+	} else {
+		result, err = printing.ZplToPdf(data, label)
+	}
+
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	_, _ = w.Write(result)
+}
+
+// UrlAuthQuery adds credentials to requests to printed URL. Secrets should be stored in config and selected
+// by name, or at least sent in JSON body, since query strings are often logged
+type UrlAuthQuery struct {
+	// Name of credentials from config
+	Auth string `form:"auth" validate:"max=64"`
+	// "Name: value" pairs
+	Headers []string `form:"header" validate:"max=32,dive,max=8192"`
+	// "name=value" pairs
+	Cookies []string `form:"cookie" validate:"max=32,dive,max=8192"`
+}
+
+var headerNameRegexp = regexp.MustCompile(`^[\w.-]+$`)
+
+func urlCredentials(c appconfig.UrlCredentialsConfig) printing.UrlCredentials {
+	return printing.UrlCredentials{
+		Hosts:       c.Hosts,
+		Headers:     c.Headers,
+		Cookies:     c.Cookies,
+		Username:    c.Username,
+		Password:    c.Password,
+		BearerToken: c.BearerToken,
+	}
 }
 
-func (q PrintFromUrlQuery) ToPrintParams() *proto.PagePrintToPDF {
-	return &proto.PagePrintToPDF{
-		Landscape:    q.Orientation != nil && *q.Orientation == "landscape",
-		PaperWidth:   q.PaperWidth,
-		PaperHeight:  q.PaperHeight,
-		MarginTop:    q.MarginTop,
-		MarginBottom: q.MarginBottom,
-		MarginLeft:   q.MarginLeft,
-		MarginRight:  q.MarginRight,
-		PageRanges:   q.Pages,
+// urlAuth returns credentials from config without name along with credentials selected in query.
+// Credentials from config are sent only to their hosts, credentials from query only to the host of printed URL
+func (a *api) urlAuth(q UrlAuthQuery, rawUrl string) (printing.UrlAuth, error) {
+	var auth printing.UrlAuth
+
+	for _, c := range a.urlCredentials {
+		if c.Name == "" && len(c.Hosts) > 0 {
+			auth = append(auth, urlCredentials(c))
+		}
+	}
+
+	u, err := url.Parse(rawUrl)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", printing.ErrRequestError, err)
+	}
+
+	if q.Auth != "" {
+		c, ok := lo.Find(a.urlCredentials, func(c appconfig.UrlCredentialsConfig) bool { return c.Name == q.Auth })
+
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown URL credentials: %s", printing.ErrRequestError, q.Auth)
+		}
+
+		credentials := urlCredentials(c)
+
+		// Otherwise caller could send stored secrets to any host
+		if !credentials.Matches(u.Hostname()) {
+			return nil, fmt.Errorf("%w: URL credentials %s can't be used for host %s", printing.ErrRequestError, q.Auth, u.Hostname())
+		}
+
+		auth = append(auth, credentials)
+	}
+
+	if len(q.Headers) == 0 && len(q.Cookies) == 0 {
+		return auth, nil
+	}
+
+	credentials := printing.UrlCredentials{Hosts: []string{u.Hostname()}, Headers: map[string]string{}, Cookies: map[string]string{}}
+
+	for _, header := range q.Headers {
+		name, value, ok := strings.Cut(header, ":")
+		if !ok || !headerNameRegexp.MatchString(name) {
+			return nil, fmt.Errorf("%w: header must be \"Name: value\" pair: %s", printing.ErrRequestError, header)
+		}
+		credentials.Headers[name] = strings.TrimSpace(value)
+	}
+
+	for _, cookie := range q.Cookies {
+		name, value, ok := strings.Cut(cookie, "=")
+		if !ok || !headerNameRegexp.MatchString(name) {
+			return nil, fmt.Errorf("%w: cookie must be \"name=value\" pair: %s", printing.ErrRequestError, cookie)
+		}
+		credentials.Cookies[name] = value
 	}
+
+	return append(auth, credentials), nil
+}
+
+type PrintPdfFromUrlQuery struct {
+	Printer string `form:"printer" validate:"required"`
+	Url     string `form:"url" validate:"required,url"`
+	PrintOptionsQuery
+	UrlAuthQuery
 }
 
-func printFromUrl(w http.ResponseWriter, r *http.Request) {
-	q, err := validateRequest[PrintFromUrlQuery](r)
+func (a *api) printPdfFromUrl(w http.ResponseWriter, r *http.Request) {
+	q, err := validateParamsRequest[PrintPdfFromUrlQuery](r)
 
 	if err != nil {
 		handleValidateRequestError(w, err)
 		return
 	}
 
-	err = printing.PrintFromUrl(q.Printer, q.Url, q.ToPrintParams())
+	if err := a.urlPolicy.Check(r.Context(), q.Url); err != nil {
+		handleError(err, w)
+		return
+	}
+
+	auth, err := a.urlAuth(q.UrlAuthQuery, q.Url)
+
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+
+	a.submitJob(w, r, printing.JobRequest{
+		Printer: q.Printer,
+		Source:  printing.JobSourcePdfUrl,
+		Url:     q.Url,
+		Options: q.ToPrintOptions(),
+		Render:  printing.PdfUrlRenderer(q.Url, auth, a.urlPolicy, a.office),
+	})
+}
+
+// PagePrintQuery contains parameters of web page conversion to PDF, see proto.PagePrintToPDF
+type PagePrintQuery struct {
+	PaperWidth   *float64 `form:"paper-width" validate:"omitnil,gt=0"`
+	PaperHeight  *float64 `form:"paper-height" validate:"omitnil,gt=0"`
+	MarginTop    *float64 `form:"margin-top" validate:"omitnil,gte=0"`
+	MarginBottom *float64 `form:"margin-bottom" validate:"omitnil,gte=0"`
+	MarginLeft   *float64 `form:"margin-left" validate:"omitnil,gte=0"`
+	MarginRight  *float64 `form:"margin-right" validate:"omitnil,gte=0"`
+	Pages        string   `form:"pages"`
+	// Named "page-scale", since "scale" is image scaling mode in /print-batch
+	Scale             *float64 `form:"page-scale" validate:"omitnil,gte=0.1,lte=2"`
+	PrintBackground   *bool    `form:"print-background"`
+	PreferCssPageSize *bool    `form:"prefer-css-page-size"`
+	// HTML templates, see HeaderFooterConfig. Override header and footer of the preset
+	HeaderTemplate string `form:"header-template" validate:"max=65536"`
+	FooterTemplate string `form:"footer-template" validate:"max=65536"`
+	// Name of preset from config
+	HeaderFooter string `form:"header-footer" validate:"max=64"`
+}
+
+func (q PagePrintQuery) ToPrintParams(orientation string) *proto.PagePrintToPDF {
+	params := &proto.PagePrintToPDF{Landscape: orientation == "landscape"}
+	q.applyTo(params)
+	return params
+}
+
+// applyTo overrides parameters set in query
+func (q PagePrintQuery) applyTo(params *proto.PagePrintToPDF) {
+	params.PaperWidth = lo.CoalesceOrEmpty(q.PaperWidth, params.PaperWidth)
+	params.PaperHeight = lo.CoalesceOrEmpty(q.PaperHeight, params.PaperHeight)
+	params.MarginTop = lo.CoalesceOrEmpty(q.MarginTop, params.MarginTop)
+	params.MarginBottom = lo.CoalesceOrEmpty(q.MarginBottom, params.MarginBottom)
+	params.MarginLeft = lo.CoalesceOrEmpty(q.MarginLeft, params.MarginLeft)
+	params.MarginRight = lo.CoalesceOrEmpty(q.MarginRight, params.MarginRight)
+	params.PageRanges = lo.CoalesceOrEmpty(q.Pages, params.PageRanges)
+	params.Scale = lo.CoalesceOrEmpty(q.Scale, params.Scale)
+	params.PrintBackground = lo.FromPtrOr(q.PrintBackground, params.PrintBackground)
+	params.PreferCSSPageSize = lo.FromPtrOr(q.PreferCssPageSize, params.PreferCSSPageSize)
+	params.HeaderTemplate = lo.CoalesceOrEmpty(q.HeaderTemplate, params.HeaderTemplate)
+	params.FooterTemplate = lo.CoalesceOrEmpty(q.FooterTemplate, params.FooterTemplate)
+}
+
+// builtinHeaderFooters are available if config has no presets with the same names
+var builtinHeaderFooters = []appconfig.HeaderFooterConfig{
+	{
+		Name:   "page-numbers",
+		Footer: `<div style="width: 100%; font-size: 9px; text-align: center"><span class="pageNumber"></span> / <span class="totalPages"></span></div>`,
+	},
+	{
+		Name:   "report",
+		Header: `<div style="width: 100%; font-size: 9px; padding: 0 0.4in; display: flex; justify-content: space-between"><span class="title"></span><span class="date"></span></div>`,
+		Footer: `<div style="width: 100%; font-size: 9px; text-align: center">Page <span class="pageNumber"></span> of <span class="totalPages"></span></div>`,
+	},
+}
+
+// applyHeaderFooter fills header and footer, which are not set explicitly, from preset
+func (a *api) applyHeaderFooter(preset string, params *proto.PagePrintToPDF) error {
+	if preset != "" {
+		presets := slices.Concat(a.headerFooters, builtinHeaderFooters)
+		p, ok := lo.Find(presets, func(p appconfig.HeaderFooterConfig) bool { return p.Name == preset })
+
+		if !ok {
+			return fmt.Errorf("%w: unknown header and footer preset: %s", printing.ErrRequestError, preset)
+		}
+
+		params.HeaderTemplate = lo.CoalesceOrEmpty(params.HeaderTemplate, p.Header)
+		params.FooterTemplate = lo.CoalesceOrEmpty(params.FooterTemplate, p.Footer)
+	}
+
+	if params.HeaderTemplate != "" || params.FooterTemplate != "" {
+		params.DisplayHeaderFooter = true
+		// Browser prints its default header or footer if template is empty
+		params.HeaderTemplate = lo.CoalesceOrEmpty(params.HeaderTemplate, "<span></span>")
+		params.FooterTemplate = lo.CoalesceOrEmpty(params.FooterTemplate, "<span></span>")
+	}
+
+	return nil
+}
+
+// PageWaitQuery sets when page is ready to be printed, times are in seconds
+type PageWaitQuery struct {
+	Timeout     float64 `form:"timeout" validate:"gte=0,lte=600"`
+	NetworkIdle bool    `form:"wait-network-idle"`
+	WaitFor     string  `form:"wait-for" validate:"max=1024"`
+	WaitForJs   string  `form:"wait-for-js" validate:"max=4096"`
+	Delay       float64 `form:"delay" validate:"gte=0,lte=60"`
+}
+
+func (q PageWaitQuery) ToPageWait() printing.PageWait {
+	return printing.PageWait{
+		Timeout:     time.Duration(q.Timeout * float64(time.Second)),
+		NetworkIdle: q.NetworkIdle,
+		Selector:    q.WaitFor,
+		Expression:  q.WaitForJs,
+		Delay:       time.Duration(q.Delay * float64(time.Second)),
+	}
+}
+
+type PrintFromUrlQuery struct {
+	Printer string `form:"printer" validate:"required"`
+	Url     string `form:"url" validate:"required,url"`
+	// Orientation is applied when page is converted to PDF, not when it is printed
+	PrintOptionsQuery
+	PagePrintQuery
+	PageWaitQuery
+	UrlAuthQuery
+}
+
+func (q PrintFromUrlQuery) ToPrintOptions() printing.PrintOptions {
+	options := q.PrintOptionsQuery.ToPrintOptions()
+	options.Orientation = ""
+	return options
+}
+
+func (a *api) printFromUrl(w http.ResponseWriter, r *http.Request) {
+	q, err := validateParamsRequest[PrintFromUrlQuery](r)
+
+	if err != nil {
+		handleValidateRequestError(w, err)
+		return
+	}
+
+	params := q.ToPrintParams(q.Orientation)
+
+	if err := a.applyHeaderFooter(q.HeaderFooter, params); err != nil {
+		handleError(err, w)
+		return
+	}
+
+	if err := a.urlPolicy.Check(r.Context(), q.Url); err != nil {
+		handleError(err, w)
+		return
+	}
+
+	auth, err := a.urlAuth(q.UrlAuthQuery, q.Url)
+
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+
+	a.submitJob(w, r, printing.JobRequest{
+		Printer: q.Printer,
+		Source:  printing.JobSourcePageUrl,
+		Url:     q.Url,
+		Options: q.ToPrintOptions(),
+		Render:  printing.PageUrlRenderer(q.Url, params, q.ToPageWait(), auth, a.browser),
+	})
+}
+
+type PrintHtmlQuery struct {
+	Printer string `form:"printer" validate:"required"`
+	// Orientation is applied when page is converted to PDF, not when it is printed
+	PrintOptionsQuery
+	PagePrintQuery
+	PageWaitQuery
+}
+
+func (q PrintHtmlQuery) ToPrintOptions() printing.PrintOptions {
+	options := q.PrintOptionsQuery.ToPrintOptions()
+	options.Orientation = ""
+	return options
+}
+
+// printHtml accepts either HTML document, or multipart form where "html" part is the document,
+// and other parts are files it references, available by part name, e.g. "css/style.css"
+func (a *api) printHtml(w http.ResponseWriter, r *http.Request) {
+	q, err := validateRequest[PrintHtmlQuery](r)
+
+	if err != nil {
+		handleValidateRequestError(w, err)
+		return
+	}
+
+	var document printing.HtmlDocument
+
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		document, err = readHtmlBundle(r)
+	} else {
+		document.Html, err = io.ReadAll(r.Body)
+	}
+
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+
+	params := q.ToPrintParams(q.Orientation)
+
+	if err := a.applyHeaderFooter(q.HeaderFooter, params); err != nil {
+		handleError(err, w)
+		return
+	}
+
+	a.submitJob(w, r, printing.JobRequest{
+		Printer: q.Printer,
+		Source:  printing.JobSourceHtml,
+		Options: q.ToPrintOptions(),
+		Render:  printing.HtmlRenderer(document, params, q.ToPageWait(), a.browser),
+	})
+}
+
+func readHtmlBundle(r *http.Request) (printing.HtmlDocument, error) {
+	document := printing.HtmlDocument{Assets: map[string][]byte{}}
+
+	reader, err := r.MultipartReader()
+
+	if err != nil {
+		return document, fmt.Errorf("%w: %w", printing.ErrRequestError, err)
+	}
+
+	for {
+		part, err := reader.NextPart()
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return document, fmt.Errorf("%w: %w", printing.ErrRequestError, err)
+		}
+
+		data, err := io.ReadAll(part)
+
+		if err != nil {
+			return document, err
+		}
+
+		if part.FormName() == "html" {
+			document.Html = data
+		} else {
+			document.Assets[strings.TrimPrefix(part.FormName(), "/")] = data
+		}
+	}
+
+	if document.Html == nil {
+		return document, fmt.Errorf("%w: html part is missing", printing.ErrRequestError)
+	}
+
+	return document, nil
+}
+
+// PageLayoutQuery describes pages of documents generated by print server. Sizes are in inches,
+// named paper size is overridden by paper-width and paper-height
+type PageLayoutQuery struct {
+	Paper        string   `form:"paper" validate:"omitempty,oneof=a3 a4 a5 a6 letter legal tabloid 4x6"`
+	PaperWidth   *float64 `form:"paper-width" validate:"omitnil,gt=0"`
+	PaperHeight  *float64 `form:"paper-height" validate:"omitnil,gt=0"`
+	MarginTop    *float64 `form:"margin-top" validate:"omitnil,gte=0"`
+	MarginBottom *float64 `form:"margin-bottom" validate:"omitnil,gte=0"`
+	MarginLeft   *float64 `form:"margin-left" validate:"omitnil,gte=0"`
+	MarginRight  *float64 `form:"margin-right" validate:"omitnil,gte=0"`
+}
+
+// ToPageLayout uses the same defaults as PagePrintToPDF: Letter paper and 0.4 inch margins
+func (q PageLayoutQuery) ToPageLayout(orientation string) printing.PageLayout {
+	paper := printing.PaperSizes[lo.CoalesceOrEmpty(q.Paper, "letter")]
+	if q.PaperWidth != nil {
+		paper.Width = *q.PaperWidth
+	}
+	if q.PaperHeight != nil {
+		paper.Height = *q.PaperHeight
+	}
+	if orientation == "landscape" {
+		paper = paper.Landscape()
+	}
+
+	return printing.PageLayout{
+		Paper:        paper,
+		MarginTop:    lo.FromPtrOr(q.MarginTop, 0.4),
+		MarginBottom: lo.FromPtrOr(q.MarginBottom, 0.4),
+		MarginLeft:   lo.FromPtrOr(q.MarginLeft, 0.4),
+		MarginRight:  lo.FromPtrOr(q.MarginRight, 0.4),
+	}
+}
+
+type PrintImageQuery struct {
+	Printer string `form:"printer" validate:"required"`
+	// Orientation is applied when image is converted to PDF, not when it is printed
+	PrintOptionsQuery
+	PageLayoutQuery
+
+	Scale string `form:"scale" validate:"omitempty,oneof=fit fill actual-size"`
+	// Used with actual-size scale
+	Dpi    float64 `form:"dpi" validate:"gte=0,lte=4800"`
+	Rotate int     `form:"rotate" validate:"oneof=0 90 180 270"`
+}
+
+func (q PrintImageQuery) ToImageLayout() printing.ImageLayout {
+	return printing.ImageLayout{
+		PageLayout: q.ToPageLayout(q.Orientation),
+		Scale:      lo.CoalesceOrEmpty(q.Scale, printing.ImageScaleFit),
+		Dpi:        lo.CoalesceOrEmpty(q.Dpi, 96),
+		Rotate:     q.Rotate,
+	}
+}
+
+func (q PrintImageQuery) ToPrintOptions() printing.PrintOptions {
+	options := q.PrintOptionsQuery.ToPrintOptions()
+	options.Orientation = ""
+	return options
+}
+
+func (a *api) printImage(w http.ResponseWriter, r *http.Request) {
+	q, err := validateRequest[PrintImageQuery](r)
+
+	if err != nil {
+		handleValidateRequestError(w, err)
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+
+	// Reject unsupported files before the job is queued
+	if err := printing.CheckImage(data); err != nil {
+		handleError(err, w)
+		return
+	}
+
+	a.submitJob(w, r, printing.JobRequest{
+		Printer: q.Printer,
+		Source:  printing.JobSourceImage,
+		Options: q.ToPrintOptions(),
+		Render:  printing.ImageRenderer(data, q.ToImageLayout()),
+	})
+}
+
+type PrintTextQuery struct {
+	Printer string `form:"printer" validate:"required"`
+	// Orientation is applied when text is converted to PDF, not when it is printed
+	PrintOptionsQuery
+	PageLayoutQuery
+
+	// Overrides charset from Content-Type header
+	Charset string `form:"charset" validate:"omitempty,max=64"`
+	// monospace, sans-serif, serif or one of configured fonts
+	Font     string  `form:"font" validate:"omitempty,max=64"`
+	FontSize float64 `form:"font-size" validate:"gte=0,lte=144"`
+	Wrap     *bool   `form:"wrap"`
+	TabWidth *int    `form:"tab-width" validate:"omitnil,gte=0,lte=32"`
+	Header   string  `form:"header" validate:"max=256"`
+	Footer   string  `form:"footer" validate:"max=256"`
+}
+
+func (q PrintTextQuery) ToTextLayout() printing.TextLayout {
+	return printing.TextLayout{
+		PageLayout: q.ToPageLayout(q.Orientation),
+		Font:       lo.CoalesceOrEmpty(q.Font, "monospace"),
+		FontSize:   lo.CoalesceOrEmpty(q.FontSize, 10),
+		Wrap:       lo.FromPtrOr(q.Wrap, true),
+		TabWidth:   lo.FromPtrOr(q.TabWidth, 8),
+		Header:     q.Header,
+		Footer:     q.Footer,
+	}
+}
+
+func (q PrintTextQuery) ToPrintOptions() printing.PrintOptions {
+	options := q.PrintOptionsQuery.ToPrintOptions()
+	options.Orientation = ""
+	return options
+}
+
+// textLayout resolves font name to one of configured fonts or core fonts
+func (a *api) textLayout(q PrintTextQuery) (printing.TextLayout, error) {
+	layout := q.ToTextLayout()
+
+	if font, ok := lo.Find(a.fonts, func(f appconfig.FontConfig) bool { return f.Name == layout.Font }); ok {
+		layout.FontFile = font.File
+	} else if !printing.IsCoreFont(layout.Font) {
+		return layout, fmt.Errorf("%w: unknown font: %s", printing.ErrRequestError, layout.Font)
+	}
+
+	return layout, nil
+}
+
+func (a *api) printText(w http.ResponseWriter, r *http.Request) {
+	q, err := validateRequest[PrintTextQuery](r)
+
+	if err != nil {
+		handleValidateRequestError(w, err)
+		return
+	}
+
+	layout, err := a.textLayout(*q)
+
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+
+	charset := q.Charset
+	if charset == "" {
+		_, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		charset = params["charset"]
+	}
+
+	data, err := io.ReadAll(r.Body)
+
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+
+	text, err := printing.DecodeText(data, charset)
+
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+
+	a.submitJob(w, r, printing.JobRequest{
+		Printer: q.Printer,
+		Source:  printing.JobSourceText,
+		Options: q.ToPrintOptions(),
+		Render:  printing.TextRenderer(text, layout),
+	})
+}
+
+type PrintBatchQuery struct {
+	Printer string `form:"printer" validate:"required"`
+	// Orientation is applied when documents are converted to PDF, PDF documents are printed as is
+	PrintOptionsQuery
+}
+
+func (q PrintBatchQuery) ToPrintOptions() printing.PrintOptions {
+	options := q.PrintOptionsQuery.ToPrintOptions()
+	options.Orientation = ""
+	return options
+}
+
+// batchPart is a document of batch along with its options in query string format
+type batchPart struct {
+	name        string
+	contentType string
+	data        []byte
+	options     string
+}
+
+// printBatch prints several documents as a single job, so they are not interleaved with other jobs.
+// Each file part is a document, "<part name>.options" part contains its options, e.g. "paper=4x6&scale=fill".
+// Options not set for the document are taken from query. All documents are checked before the job is queued
+func (a *api) printBatch(w http.ResponseWriter, r *http.Request) {
+	q, err := validateRequest[PrintBatchQuery](r)
+
+	if err != nil {
+		handleValidateRequestError(w, err)
+		return
+	}
+
+	parts, err := readBatchParts(r)
+
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+
+	if len(parts) == 0 {
+		RespondError(w, "no documents in batch", http.StatusUnprocessableEntity)
+		return
+	}
+
+	renderers := make([]printing.JobRenderer, 0, len(parts))
+	partErrors := map[string]string{}
+
+	for _, part := range parts {
+		render, err := a.batchPartRenderer(r.URL.Query(), part)
+
+		if err != nil {
+			partErrors[part.name] = err.Error()
+			continue
+		}
+
+		renderers = append(renderers, render)
+	}
+
+	if len(partErrors) > 0 {
+		respondJson(w, map[string]any{
+			"message": "some documents are invalid",
+			"parts":   partErrors,
+		}, http.StatusUnprocessableEntity)
+		return
+	}
+
+	a.submitJob(w, r, printing.JobRequest{
+		Printer: q.Printer,
+		Source:  printing.JobSourceBatch,
+		Options: q.ToPrintOptions(),
+		Render:  printing.MergeRenderer(renderers),
+	})
+}
+
+// readBatchParts returns documents in the same order as they are sent
+func readBatchParts(r *http.Request) ([]*batchPart, error) {
+	reader, err := r.MultipartReader()
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", printing.ErrRequestError, err)
+	}
+
+	var parts []*batchPart
+	options := map[string]string{}
+
+	for {
+		part, err := reader.NextPart()
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", printing.ErrRequestError, err)
+		}
+
+		data, err := io.ReadAll(part)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if part.FileName() == "" {
+			if !strings.HasSuffix(part.FormName(), ".options") {
+				return nil, fmt.Errorf("%w: part %s is not a file", printing.ErrRequestError, part.FormName())
+			}
+			options[strings.TrimSuffix(part.FormName(), ".options")] = string(data)
+			continue
+		}
+
+		if slices.ContainsFunc(parts, func(p *batchPart) bool { return p.name == part.FormName() }) {
+			return nil, fmt.Errorf("%w: duplicate part %s", printing.ErrRequestError, part.FormName())
+		}
+
+		parts = append(parts, &batchPart{
+			name:        part.FormName(),
+			contentType: part.Header.Get("Content-Type"),
+			data:        data,
+		})
+	}
+
+	for name, value := range options {
+		part, ok := lo.Find(parts, func(p *batchPart) bool { return p.name == name })
+
+		if !ok {
+			return nil, fmt.Errorf("%w: options for unknown part %s", printing.ErrRequestError, name)
+		}
+
+		part.options = value
+	}
+
+	return parts, nil
+}
+
+// batchPartType detects document type by part Content-Type, or by content if type is not set.
+// Returns media type for unsupported documents
+func batchPartType(part *batchPart) string {
+	mediaType, _, _ := mime.ParseMediaType(part.contentType)
+
+	if mediaType == "" || mediaType == "application/octet-stream" {
+		mediaType, _, _ = mime.ParseMediaType(http.DetectContentType(part.data))
+	}
+
+	switch {
+	case mediaType == "application/pdf":
+		return "pdf"
+	case strings.HasPrefix(mediaType, "image/"):
+		return "image"
+	case mediaType == "text/html":
+		return "html"
+	case mediaType == "text/plain":
+		return "text"
+	}
+
+	return mediaType
+}
+
+// batchPartRenderer validates document and its options the same way as single document endpoints do
+func (a *api) batchPartRenderer(query url.Values, part *batchPart) (printing.JobRenderer, error) {
+	partQuery, err := url.ParseQuery(part.options)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid options: %w", printing.ErrRequestError, err)
+	}
+
+	values := url.Values{}
+	for name, value := range query {
+		values[name] = value
+	}
+	for name, value := range partQuery {
+		values[name] = value
+	}
+
+	partType := batchPartType(part)
+
+	switch partType {
+	case "pdf":
+		// Documents are merged, so PDF has to be parsed anyway
+		if printing.CountPdfPages(part.data) == 0 {
+			return nil, fmt.Errorf("%w: invalid PDF file", printing.ErrRequestError)
+		}
+
+		return printing.PdfRenderer(part.data), nil
+	case "image":
+		q, err := validateValues[PrintImageQuery](values)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err := printing.CheckImage(part.data); err != nil {
+			return nil, err
+		}
+
+		return printing.ImageRenderer(part.data, q.ToImageLayout()), nil
+	case "text":
+		q, err := validateValues[PrintTextQuery](values)
+
+		if err != nil {
+			return nil, err
+		}
+
+		layout, err := a.textLayout(*q)
+
+		if err != nil {
+			return nil, err
+		}
+
+		charset := q.Charset
+		if charset == "" {
+			_, params, _ := mime.ParseMediaType(part.contentType)
+			charset = params["charset"]
+		}
+
+		text, err := printing.DecodeText(part.data, charset)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return printing.TextRenderer(text, layout), nil
+	case "html":
+		q, err := validateValues[PrintHtmlQuery](values)
+
+		if err != nil {
+			return nil, err
+		}
+
+		params := q.ToPrintParams(q.Orientation)
+
+		if err := a.applyHeaderFooter(q.HeaderFooter, params); err != nil {
+			return nil, err
+		}
+
+		return printing.HtmlRenderer(printing.HtmlDocument{Html: part.data}, params, q.ToPageWait(), a.browser), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", printing.ErrUnsupportedDocument, partType)
+	}
+}
+
+type GetJobsQuery struct {
+	Printer string     `form:"printer"`
+	Status  string     `form:"status" validate:"omitempty,jobstate"`
+	Since   *time.Time `form:"since"`
+	Limit   int        `form:"limit" validate:"gte=0,lte=1000"`
+}
+
+func (a *api) getJobs(w http.ResponseWriter, r *http.Request) {
+	q, err := validateRequest[GetJobsQuery](r)
+
+	if err != nil {
+		handleValidateRequestError(w, err)
+		return
+	}
+
+	filter := printing.JobFilter{
+		Printer: q.Printer,
+		State:   printing.JobState(q.Status),
+		Limit:   q.Limit,
+	}
+	if q.Since != nil {
+		filter.Since = *q.Since
+	}
+	if filter.Limit == 0 {
+		filter.Limit = 100
+	}
+
+	jobs, err := a.jobs.List(filter)
+
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+
+	RespondOk(w, map[string][]printing.Job{"jobs": jobs})
+}
+
+func (a *api) getJob(w http.ResponseWriter, r *http.Request) {
+	job, err := a.jobs.Get(mux.Vars(r)["id"])
+
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+
+	RespondOk(w, job)
+}
+
+func (a *api) cancelJob(w http.ResponseWriter, r *http.Request) {
+	job, err := a.jobs.Cancel(mux.Vars(r)["id"])
+
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+
+	RespondOk(w, job)
+}
+
+type RetryJobQuery struct {
+	// Same printer is used if empty
+	Printer string `form:"printer"`
+}
+
+func (a *api) retryJob(w http.ResponseWriter, r *http.Request) {
+	q, err := validateRequest[RetryJobQuery](r)
+
+	if err != nil {
+		handleValidateRequestError(w, err)
+		return
+	}
+
+	job, err := a.jobs.Get(mux.Vars(r)["id"])
+
+	if err != nil {
+		handleError(err, w)
+		return
+	}
+
+	printer := lo.CoalesceOrEmpty(q.Printer, job.Printer)
+
+	// Raw document is sent as is, so target printer must be allowed to print it
+	if job.Raw && !slices.Contains(a.rawPrinters, printer) {
+		RespondError(w, "raw printing is not allowed for printer "+printer, http.StatusForbidden)
+		return
+	}
+
+	job, err = a.jobs.Retry(job.ID, printer)
 
 	if err != nil {
 		handleError(err, w)
 		return
 	}
 
-	RespondOk(w, nil)
+	RespondAccepted(w, job)
 }
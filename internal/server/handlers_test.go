@@ -0,0 +1,487 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/downace/print-server/internal/appconfig"
+	"github.com/downace/print-server/internal/logging"
+	"github.com/downace/print-server/internal/printing"
+	"github.com/downace/print-server/internal/printing/printingtest"
+	"github.com/go-rod/rod/lib/proto"
+	"github.com/gorilla/mux"
+	"github.com/samber/lo"
+	"io"
+	"log"
+	"maps"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestUrlAuth(t *testing.T) {
+	a := &api{urlCredentials: []appconfig.UrlCredentialsConfig{
+		{Hosts: []string{"intranet.example.com"}, BearerToken: "auto"},
+		{Name: "reports", Hosts: []string{"*.reports.example.com"}, BearerToken: "reports"},
+		{Name: "no-hosts", BearerToken: "no-hosts"},
+	}}
+
+	tests := []struct {
+		name    string
+		query   UrlAuthQuery
+		url     string
+		wantErr bool
+		// Number of credentials used for the URL
+		want int
+	}{
+		{name: "automatic", url: "https://intranet.example.com/report", want: 1},
+		{name: "automatic for other host", url: "https://example.com/report", want: 1},
+		{name: "named", query: UrlAuthQuery{Auth: "reports"}, url: "https://eu.reports.example.com/", want: 2},
+		{name: "named for other host", query: UrlAuthQuery{Auth: "reports"}, url: "https://attacker.example/", wantErr: true},
+		{name: "named without hosts", query: UrlAuthQuery{Auth: "no-hosts"}, url: "https://attacker.example/", wantErr: true},
+		{name: "unknown", query: UrlAuthQuery{Auth: "unknown"}, url: "https://example.com/", wantErr: true},
+		{name: "headers", query: UrlAuthQuery{Headers: []string{"X-Token: 1"}, Cookies: []string{"sid=2"}}, url: "https://example.com/", want: 2},
+		{name: "invalid header", query: UrlAuthQuery{Headers: []string{"X-Token"}}, url: "https://example.com/", wantErr: true},
+		{name: "invalid cookie", query: UrlAuthQuery{Cookies: []string{"sid"}}, url: "https://example.com/", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth, err := a.urlAuth(tt.query, tt.url)
+
+			if tt.wantErr {
+				if !errors.Is(err, printing.ErrRequestError) {
+					t.Errorf("expected request error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(auth) != tt.want {
+				t.Errorf("got %d credentials, want %d", len(auth), tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryRawJob(t *testing.T) {
+	backend, jobs := newTestJobQueue(t)
+	a := &api{backend: backend, jobs: jobs, rawPrinters: []string{"Labels"}}
+
+	job, err := jobs.Submit(printing.JobRequest{
+		Printer: "Labels",
+		Source:  printing.JobSourceRaw,
+		Raw:     true,
+		Render:  printing.PdfRenderer([]byte("^XA^XZ")),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	printingtest.WaitFinished(t, jobs, job.ID)
+
+	tests := []struct {
+		name    string
+		printer string
+		want    int
+	}{
+		{name: "same printer", printer: "", want: http.StatusAccepted},
+		{name: "allowed printer", printer: "Labels", want: http.StatusAccepted},
+		{name: "not allowed printer", printer: "Archive", want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/jobs/"+job.ID+"/retry?printer="+tt.printer, nil)
+			r = mux.SetURLVars(r, map[string]string{"id": job.ID})
+			w := httptest.NewRecorder()
+
+			a.retryJob(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestGetJobsQueryStatus(t *testing.T) {
+	for _, state := range printing.JobStates {
+		if _, err := validateValues[GetJobsQuery](url.Values{"status": {string(state)}}); err != nil {
+			t.Errorf("status %s is rejected: %s", state, err)
+		}
+	}
+
+	_, err := validateValues[GetJobsQuery](url.Values{"status": {"unknown"}})
+
+	w := httptest.NewRecorder()
+	handleValidateRequestError(w, err)
+
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "cancelled") {
+		t.Errorf("unexpected response %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestRequestBodyTooLarge(t *testing.T) {
+	logging.HttpLog = log.New(io.Discard, "", 0)
+	backend, jobs := newTestJobQueue(t)
+	config := appconfig.AppConfig{Host: "127.0.0.1", Jobs: appconfig.JobsConfig{MaxDocumentSizeMB: 1}}
+	handler := createServer(config, &api{backend: backend, jobs: jobs}).Handler
+
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+	}{
+		{name: "pdf", path: "/print-pdf?printer=Archive", contentType: "application/pdf", body: strings.Repeat("%", 2<<20)},
+		{name: "json", path: "/print-pdf?printer=Archive", contentType: "application/json", body: `{"data": "` + strings.Repeat("A", 2<<20) + `"}`},
+		{name: "zpl", path: "/render/zpl", contentType: "text/plain", body: strings.Repeat("^XA^XZ", 1<<20)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, r)
+
+			if w.Code != http.StatusRequestEntityTooLarge {
+				t.Errorf("got status %d, want 413: %s", w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestPrintTemplateInvalidData(t *testing.T) {
+	backend, jobs := newTestJobQueue(t)
+	a := &api{backend: backend, jobs: jobs, templates: printing.NewTemplateRegistry(t.TempDir())}
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "invalid JSON", body: `{"Number":`},
+		{name: "not an object", body: `["A-1"]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/print-template/invoice?printer=Archive", strings.NewReader(tt.body))
+			r = mux.SetURLVars(r, map[string]string{"name": "invoice"})
+			w := httptest.NewRecorder()
+
+			a.printTemplate(w, r)
+
+			if w.Code != http.StatusUnprocessableEntity {
+				t.Errorf("got status %d, want 422: %s", w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestPrintText(t *testing.T) {
+	backend, jobs := newTestJobQueue(t)
+	fontFile := filepath.Join(t.TempDir(), "font.ttf")
+	a := &api{backend: backend, jobs: jobs, fonts: []appconfig.FontConfig{{Name: "custom", File: fontFile}}}
+
+	tests := []struct {
+		name        string
+		query       string
+		contentType string
+		body        string
+		want        int
+	}{
+		{name: "defaults", query: "printer=Archive", body: "hello", want: http.StatusAccepted},
+		{name: "core font", query: "printer=Archive&font=serif&font-size=12&wrap=false&tab-width=4", body: "hello", want: http.StatusAccepted},
+		{name: "charset from header", query: "printer=Archive", contentType: "text/plain; charset=windows-1251", body: "\xEF\xF0\xE8", want: http.StatusAccepted},
+		{name: "unknown charset", query: "printer=Archive&charset=unknown", body: "hello", want: http.StatusUnprocessableEntity},
+		{name: "unknown font", query: "printer=Archive&font=fantasy", body: "hello", want: http.StatusUnprocessableEntity},
+		{name: "font size out of range", query: "printer=Archive&font-size=200", body: "hello", want: http.StatusUnprocessableEntity},
+		{name: "tab width out of range", query: "printer=Archive&tab-width=33", body: "hello", want: http.StatusUnprocessableEntity},
+		{name: "missing printer", query: "", body: "hello", want: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/print-text?"+tt.query, strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+
+			a.printText(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+
+	// Configured font is used by name, its file is read when text is rendered
+	layout, err := a.textLayout(PrintTextQuery{Font: "custom"})
+
+	if err != nil || layout.FontFile != fontFile {
+		t.Errorf("configured font is not resolved: %+v, %v", layout, err)
+	}
+}
+
+type testPart struct {
+	name        string
+	fileName    string
+	contentType string
+	data        string
+}
+
+func newMultipartRequest(t *testing.T, path string, parts []testPart) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	for _, p := range parts {
+		header := textproto.MIMEHeader{}
+		disposition := fmt.Sprintf(`form-data; name=%q`, p.name)
+		if p.fileName != "" {
+			disposition += fmt.Sprintf(`; filename=%q`, p.fileName)
+		}
+		header.Set("Content-Disposition", disposition)
+		if p.contentType != "" {
+			header.Set("Content-Type", p.contentType)
+		}
+
+		w, err := writer.CreatePart(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.WriteString(w, p.data)
+	}
+	_ = writer.Close()
+
+	r := httptest.NewRequest(http.MethodPost, path, &body)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+
+	return r
+}
+
+func TestReadHtmlBundle(t *testing.T) {
+	tests := []struct {
+		name    string
+		parts   []testPart
+		wantErr bool
+		// Asset names of the bundle
+		want []string
+	}{
+		{name: "html only", parts: []testPart{{name: "html", data: "<p>hi</p>"}}, want: []string{}},
+		{
+			name: "assets",
+			parts: []testPart{
+				{name: "html", data: `<img src="logo.png">`},
+				{name: "logo.png", fileName: "logo.png", data: "png"},
+				{name: "/css/style.css", data: "p {}"},
+			},
+			want: []string{"css/style.css", "logo.png"},
+		},
+		{name: "missing html", parts: []testPart{{name: "logo.png", data: "png"}}, wantErr: true},
+		{name: "empty", parts: []testPart{}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			document, err := readHtmlBundle(newMultipartRequest(t, "/print-html", tt.parts))
+
+			if tt.wantErr {
+				if !errors.Is(err, printing.ErrRequestError) {
+					t.Errorf("expected request error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := slices.Sorted(maps.Keys(document.Assets)); !slices.Equal(got, tt.want) {
+				t.Errorf("got assets %v, want %v", got, tt.want)
+			}
+			if string(document.Html) != tt.parts[0].data {
+				t.Errorf("unexpected html %q", document.Html)
+			}
+		})
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/print-html", strings.NewReader("<p>hi</p>"))
+	r.Header.Set("Content-Type", "text/html")
+
+	if _, err := readHtmlBundle(r); !errors.Is(err, printing.ErrRequestError) {
+		t.Errorf("expected request error for non-multipart body, got %v", err)
+	}
+}
+
+func TestReadBatchParts(t *testing.T) {
+	tests := []struct {
+		name    string
+		parts   []testPart
+		wantErr bool
+		// Parts as "name:options"
+		want []string
+	}{
+		{
+			name: "files in order",
+			parts: []testPart{
+				{name: "b", fileName: "b.pdf", data: "%PDF-"},
+				{name: "a", fileName: "a.png", contentType: "image/png", data: "png"},
+			},
+			want: []string{"b:", "a:"},
+		},
+		{
+			name: "options before file",
+			parts: []testPart{
+				{name: "label.options", data: "paper=4x6&scale=fill"},
+				{name: "label", fileName: "label.png", data: "png"},
+			},
+			want: []string{"label:paper=4x6&scale=fill"},
+		},
+		{name: "empty", parts: []testPart{}, want: nil},
+		{name: "not a file", parts: []testPart{{name: "note", data: "text"}}, wantErr: true},
+		{
+			name: "duplicate part",
+			parts: []testPart{
+				{name: "doc", fileName: "a.pdf", data: "%PDF-"},
+				{name: "doc", fileName: "b.pdf", data: "%PDF-"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "options for unknown part",
+			parts: []testPart{
+				{name: "doc", fileName: "a.pdf", data: "%PDF-"},
+				{name: "other.options", data: "copies=2"},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts, err := readBatchParts(newMultipartRequest(t, "/print-batch", tt.parts))
+
+			if tt.wantErr {
+				if !errors.Is(err, printing.ErrRequestError) {
+					t.Errorf("expected request error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := lo.Map(parts, func(p *batchPart, _ int) string { return p.name + ":" + p.options })
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got parts %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeJsonParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr bool
+		want    url.Values
+	}{
+		{name: "scalars", body: `{"printer": "Archive", "copies": 2, "duplex": true}`, want: url.Values{"printer": {"Archive"}, "copies": {"2"}, "duplex": {"true"}}},
+		{name: "large number", body: `{"width": 1000000, "scale": 0.5}`, want: url.Values{"width": {"1000000"}, "scale": {"0.5"}}},
+		{name: "array", body: `{"pages": ["1-2", 5]}`, want: url.Values{"pages": {"1-2", "5"}}},
+		{name: "null", body: `{"printer": "Archive", "paper": null, "tags": [null]}`, want: url.Values{"printer": {"Archive"}}},
+		{name: "empty", body: `{}`, want: url.Values{}},
+		{name: "nested object", body: `{"options": {"copies": 2}}`, wantErr: true},
+		{name: "nested array", body: `{"pages": [[1, 2]]}`, wantErr: true},
+		{name: "not an object", body: `["Archive"]`, wantErr: true},
+		{name: "invalid JSON", body: `{"printer":`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := decodeJsonParams(strings.NewReader(tt.body))
+
+			if tt.wantErr {
+				if !errors.Is(err, printing.ErrRequestError) {
+					t.Errorf("expected request error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !maps.EqualFunc(values, tt.want, slices.Equal) {
+				t.Errorf("got %v, want %v", values, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyHeaderFooter(t *testing.T) {
+	a := &api{headerFooters: []appconfig.HeaderFooterConfig{
+		{Name: "company", Header: "<b>ACME</b>"},
+		// Overrides the built-in preset
+		{Name: "page-numbers", Footer: "<i>page</i>"},
+	}}
+	empty := "<span></span>"
+
+	tests := []struct {
+		name    string
+		preset  string
+		params  proto.PagePrintToPDF
+		wantErr bool
+		want    proto.PagePrintToPDF
+	}{
+		{name: "none", want: proto.PagePrintToPDF{}},
+		{name: "configured", preset: "company", want: proto.PagePrintToPDF{DisplayHeaderFooter: true, HeaderTemplate: "<b>ACME</b>", FooterTemplate: empty}},
+		{name: "configured overrides built-in", preset: "page-numbers", want: proto.PagePrintToPDF{DisplayHeaderFooter: true, HeaderTemplate: empty, FooterTemplate: "<i>page</i>"}},
+		{
+			name:   "built-in",
+			preset: "report",
+			want:   proto.PagePrintToPDF{DisplayHeaderFooter: true, HeaderTemplate: builtinHeaderFooters[1].Header, FooterTemplate: builtinHeaderFooters[1].Footer},
+		},
+		{
+			name:   "explicit template overrides preset",
+			preset: "report",
+			params: proto.PagePrintToPDF{HeaderTemplate: "<b>custom</b>"},
+			want:   proto.PagePrintToPDF{DisplayHeaderFooter: true, HeaderTemplate: "<b>custom</b>", FooterTemplate: builtinHeaderFooters[1].Footer},
+		},
+		{
+			name:   "explicit template without preset",
+			params: proto.PagePrintToPDF{FooterTemplate: "<i>custom</i>"},
+			want:   proto.PagePrintToPDF{DisplayHeaderFooter: true, HeaderTemplate: empty, FooterTemplate: "<i>custom</i>"},
+		},
+		{name: "unknown", preset: "unknown", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := tt.params
+			err := a.applyHeaderFooter(tt.preset, &params)
+
+			if tt.wantErr {
+				if !errors.Is(err, printing.ErrRequestError) {
+					t.Errorf("expected request error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if params != tt.want {
+				t.Errorf("got %+v, want %+v", params, tt.want)
+			}
+		})
+	}
+}
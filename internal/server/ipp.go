@@ -0,0 +1,532 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/downace/print-server/internal/appconfig"
+	"github.com/downace/print-server/internal/ipp"
+	"github.com/downace/print-server/internal/logging"
+	"github.com/downace/print-server/internal/printing"
+	"github.com/gorilla/handlers"
+	"github.com/gorilla/mux"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultIppPort = 8631
+
+// ippPrinterPath is the resource path recommended by IPP Everywhere
+const ippPrinterPath = "/ipp/print/"
+
+// IPP job IDs of jobs removed from history are forgotten at most that often
+const ippJobIdsCleanupInterval = time.Hour
+
+var ippOperationsSupported = []ipp.Operation{
+	ipp.OpPrintJob,
+	ipp.OpValidateJob,
+	ipp.OpCancelJob,
+	ipp.OpGetJobAttributes,
+	ipp.OpGetJobs,
+	ipp.OpGetPrinterAttributes,
+}
+
+// ippListener serves each printer as IPP Everywhere printer on a separate port
+type ippListener struct {
+	server    *http.Server
+	printers  *ippPrinterServer
+	tls       appconfig.TLSConfig
+	host      netip.Addr
+	port      uint16
+	advertise bool
+}
+
+func createIppListener(host netip.Addr, config appconfig.AppConfig, backend printing.Backend, jobs *printing.JobQueue) listener {
+	port := config.IPPServer.Port
+	if port == 0 {
+		port = defaultIppPort
+	}
+
+	printers := &ippPrinterServer{
+		backend:         backend,
+		jobs:            jobs,
+		tls:             config.TLS.Enabled,
+		authEnabled:     config.Auth.Enabled,
+		maxDocumentSize: maxDocumentSize(config.Jobs),
+		startedAt:       time.Now(),
+		jobIds:          make(map[int]string),
+	}
+
+	router := mux.NewRouter()
+
+	router.
+		Path(ippPrinterPath+"{name}").
+		Methods("POST").
+		Headers("Content-Type", ipp.ContentType).
+		Handler(printers)
+
+	router.MethodNotAllowedHandler = http.HandlerFunc(methodNotAllowed)
+	router.NotFoundHandler = http.HandlerFunc(notFound)
+
+	router.Use(panicHandlerMiddleware)
+	if config.Auth.Enabled {
+		router.Use(basicAuthMiddleware(config.Auth.Username, config.Auth.Password))
+	}
+
+	return &ippListener{
+		server: &http.Server{
+			Addr:    netip.AddrPortFrom(host, port).String(),
+			Handler: handlers.CombinedLoggingHandler(logging.HttpLog.Writer(), router),
+		},
+		printers:  printers,
+		tls:       config.TLS,
+		host:      host,
+		port:      port,
+		advertise: config.IPPServer.Advertise,
+	}
+}
+
+func (l *ippListener) serve() error {
+	if l.advertise {
+		advertiser, err := advertisePrinters(l.printers.backend, l.host, l.port, l.tls.Enabled, l.printers.authEnabled)
+		if err != nil {
+			// Printers still can be added manually by URI
+			log.Printf("error advertising IPP printers: %s", err)
+		} else {
+			defer advertiser.Shutdown()
+		}
+	}
+
+	return runHttpServer(l.server, l.tls)
+}
+
+func (l *ippListener) close() error {
+	return l.server.Close()
+}
+
+// ippPrinterServer handles IPP requests. Jobs are submitted to the regular job queue
+type ippPrinterServer struct {
+	backend         printing.Backend
+	jobs            *printing.JobQueue
+	tls             bool
+	authEnabled     bool
+	maxDocumentSize int64
+	startedAt       time.Time
+
+	mu sync.Mutex
+	// IPP requires integer job IDs, they are mapped to queue job IDs
+	jobIds        map[int]string
+	lastJobId     int
+	jobIdsCleanAt time.Time
+}
+
+func (s *ippPrinterServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body := bufio.NewReader(http.MaxBytesReader(w, r.Body, s.maxDocumentSize))
+	request, err := ipp.Decode(body)
+
+	if err != nil {
+		RespondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := s.handle(r, request, body)
+
+	w.Header().Set("Content-Type", ipp.ContentType)
+	if err := response.Encode(w); err != nil {
+		log.Printf("error writing IPP response: %s", err)
+	}
+}
+
+func (s *ippPrinterServer) handle(r *http.Request, request *ipp.Message, document io.Reader) *ipp.Message {
+	if major := request.Version >> 8; major != 1 && major != 2 {
+		return ippErrorResponse(request, ipp.StatusErrorVersionNotSupported, "only IPP 1.x and 2.x are supported")
+	}
+
+	printer, err := s.backend.GetPrinter(mux.Vars(r)["name"])
+
+	if err != nil {
+		return ippErrorFromError(request, err)
+	}
+
+	switch request.Operation() {
+	case ipp.OpGetPrinterAttributes:
+		return s.getPrinterAttributes(r, request, printer)
+	case ipp.OpValidateJob:
+		return s.validateJob(request, printer)
+	case ipp.OpPrintJob:
+		return s.printJob(r, request, printer, document)
+	case ipp.OpGetJobAttributes:
+		return s.getJobAttributes(r, request, printer)
+	case ipp.OpGetJobs:
+		return s.getJobs(r, request, printer)
+	case ipp.OpCancelJob:
+		return s.cancelJob(request, printer)
+	default:
+		return ippErrorResponse(request, ipp.StatusErrorOperationNotSupported, "operation is not supported")
+	}
+}
+
+func (s *ippPrinterServer) printerUri(r *http.Request, printer string) string {
+	scheme := "ipp"
+	if s.tls {
+		scheme = "ipps"
+	}
+	return fmt.Sprintf("%s://%s%s%s", scheme, r.Host, ippPrinterPath, url.PathEscape(printer))
+}
+
+func (s *ippPrinterServer) getPrinterAttributes(r *http.Request, request *ipp.Message, printer printing.PrinterDetails) *ipp.Message {
+	requested := request.Group(ipp.TagOperationGroup).Get("requested-attributes").Strings()
+	// Group names are not distinguished, all attributes belong to these groups anyway
+	all := len(requested) == 0 || slices.ContainsFunc(requested, func(name string) bool {
+		return name == "all" || name == "printer-description" || name == "job-template"
+	})
+
+	attrs := ippPrinterAttributes(printer, s.printerUri(r, printer.Name), s.tls, s.authEnabled, time.Since(s.startedAt))
+
+	response := ipp.NewResponse(ipp.StatusOk, request.RequestID)
+	group := response.Group(ipp.TagPrinterGroup)
+
+	for _, attr := range attrs {
+		// media-col-database may be huge, so it is returned only if requested explicitly
+		if slices.Contains(requested, attr.Name) || all && attr.Name != "media-col-database" {
+			group.Add(attr)
+		}
+	}
+
+	return response
+}
+
+func (s *ippPrinterServer) validateJob(request *ipp.Message, printer printing.PrinterDetails) *ipp.Message {
+	options, unsupported, err := s.jobOptions(request, printer)
+
+	if err != nil {
+		return ippErrorFromError(request, err)
+	}
+
+	if format := request.Group(ipp.TagOperationGroup).Get("document-format"); len(format.Values) > 0 {
+		if !slices.Contains(ippDocumentFormats, format.First().String()) {
+			return ippErrorResponse(request, ipp.StatusErrorDocumentFormat, "document format is not supported")
+		}
+	}
+
+	if err := s.backend.CheckPrintOptions(printer.Name, options); err != nil {
+		return ippErrorFromError(request, err)
+	}
+
+	return ippJobResponse(request, unsupported)
+}
+
+func (s *ippPrinterServer) printJob(r *http.Request, request *ipp.Message, printer printing.PrinterDetails, document io.Reader) *ipp.Message {
+	operation := request.Group(ipp.TagOperationGroup)
+
+	if compression := operation.Get("compression").First().String(); compression != "" && compression != "none" {
+		return ippErrorResponse(request, ipp.StatusErrorCompressionNotSupported, "compression is not supported")
+	}
+
+	options, unsupported, err := s.jobOptions(request, printer)
+
+	if err != nil {
+		return ippErrorFromError(request, err)
+	}
+
+	data, err := io.ReadAll(document)
+
+	var sizeErr *http.MaxBytesError
+	if errors.As(err, &sizeErr) {
+		return ippErrorResponse(request, ipp.StatusErrorRequestEntityTooLarge, fmt.Sprintf("document is larger than %d bytes", sizeErr.Limit))
+	}
+	if err != nil {
+		return ippErrorResponse(request, ipp.StatusErrorBadRequest, err.Error())
+	}
+
+	format := operation.Get("document-format").First().String()
+	if format == "" || format == "application/octet-stream" {
+		format = sniffIppDocumentFormat(data)
+	}
+
+	var render printing.JobRenderer
+
+	switch format {
+	case "application/pdf":
+		render = printing.PdfRenderer(data)
+	case "image/pwg-raster":
+		render = printing.PwgRasterRenderer(data)
+	default:
+		return ippErrorResponse(request, ipp.StatusErrorDocumentFormat, "document format is not supported")
+	}
+
+	user := operation.Get("requesting-user-name").First().String()
+	if basicAuthUser, _, ok := r.BasicAuth(); ok {
+		user = basicAuthUser
+	}
+	clientIP, _, _ := net.SplitHostPort(r.RemoteAddr)
+
+	job, err := s.jobs.Submit(printing.JobRequest{
+		Printer:  printer.Name,
+		Source:   printing.JobSourceIPP,
+		ClientIP: clientIP,
+		User:     user,
+		Options:  options,
+		Render:   render,
+	})
+
+	if err != nil {
+		return ippErrorFromError(request, err)
+	}
+
+	response := ippJobResponse(request, unsupported)
+	response.Group(ipp.TagJobGroup).Add(s.jobAttributes(r, s.addJob(job.ID), job)...)
+
+	return response
+}
+
+func (s *ippPrinterServer) getJobAttributes(r *http.Request, request *ipp.Message, printer printing.PrinterDetails) *ipp.Message {
+	ippJobId, job, err := s.findJob(request, printer)
+
+	if err != nil {
+		return ippErrorFromError(request, err)
+	}
+
+	response := ipp.NewResponse(ipp.StatusOk, request.RequestID)
+	response.Group(ipp.TagJobGroup).Add(s.jobAttributes(r, ippJobId, job)...)
+
+	return response
+}
+
+func (s *ippPrinterServer) getJobs(r *http.Request, request *ipp.Message, printer printing.PrinterDetails) *ipp.Message {
+	operation := request.Group(ipp.TagOperationGroup)
+	whichJobs := operation.Get("which-jobs").First().String()
+	limit := operation.Get("limit").First().Int()
+	user := ""
+	if operation.Get("my-jobs").First().Bool() {
+		user = operation.Get("requesting-user-name").First().String()
+		if basicAuthUser, _, ok := r.BasicAuth(); ok {
+			user = basicAuthUser
+		}
+	}
+
+	switch whichJobs {
+	case "", "not-completed", "completed", "all":
+	default:
+		return ippErrorResponse(request, ipp.StatusErrorAttributesOrValues, "which-jobs value is not supported")
+	}
+
+	s.mu.Lock()
+	ippJobIds := make([]int, 0, len(s.jobIds))
+	for ippJobId := range s.jobIds {
+		ippJobIds = append(ippJobIds, ippJobId)
+	}
+	s.mu.Unlock()
+
+	// Newest first, like CUPS does
+	slices.Sort(ippJobIds)
+	slices.Reverse(ippJobIds)
+
+	response := ipp.NewResponse(ipp.StatusOk, request.RequestID)
+
+	count := 0
+	for _, ippJobId := range ippJobIds {
+		if limit > 0 && count >= limit {
+			break
+		}
+
+		job, err := s.jobs.Get(s.queueJobId(ippJobId))
+
+		// Job may be already removed from history
+		if err != nil || job.Printer != printer.Name || user != "" && job.User != user {
+			continue
+		}
+		if whichJobs == "completed" && !job.Finished() || (whichJobs == "" || whichJobs == "not-completed") && job.Finished() {
+			continue
+		}
+
+		response.Groups = append(response.Groups, ipp.Group{
+			Tag:        ipp.TagJobGroup,
+			Attributes: s.jobAttributes(r, ippJobId, job),
+		})
+		count++
+	}
+
+	return response
+}
+
+func (s *ippPrinterServer) cancelJob(request *ipp.Message, printer printing.PrinterDetails) *ipp.Message {
+	_, job, err := s.findJob(request, printer)
+
+	if err != nil {
+		return ippErrorFromError(request, err)
+	}
+
+	if _, err := s.jobs.Cancel(job.ID); err != nil {
+		return ippErrorFromError(request, err)
+	}
+
+	return ipp.NewResponse(ipp.StatusOk, request.RequestID)
+}
+
+// findJob accepts either job-id or job-uri operation attribute
+func (s *ippPrinterServer) findJob(request *ipp.Message, printer printing.PrinterDetails) (int, printing.Job, error) {
+	operation := request.Group(ipp.TagOperationGroup)
+	ippJobId := operation.Get("job-id").First().Int()
+
+	if jobUri := operation.Get("job-uri").First().String(); ippJobId == 0 && jobUri != "" {
+		ippJobId, _ = strconv.Atoi(jobUri[strings.LastIndex(jobUri, "/")+1:])
+	}
+
+	id := s.queueJobId(ippJobId)
+
+	if id == "" {
+		return 0, printing.Job{}, printing.ErrJobNotFound
+	}
+
+	job, err := s.jobs.Get(id)
+
+	if err != nil {
+		return 0, printing.Job{}, err
+	}
+
+	if job.Printer != printer.Name {
+		return 0, printing.Job{}, printing.ErrJobNotFound
+	}
+
+	return ippJobId, job, nil
+}
+
+func (s *ippPrinterServer) addJob(id string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if time.Since(s.jobIdsCleanAt) >= ippJobIdsCleanupInterval {
+		s.removeExpiredJobIds()
+		s.jobIdsCleanAt = time.Now()
+	}
+
+	s.lastJobId++
+	s.jobIds[s.lastJobId] = id
+
+	return s.lastJobId
+}
+
+// removeExpiredJobIds forgets jobs removed from history, must be called with mu locked
+func (s *ippPrinterServer) removeExpiredJobIds() {
+	for ippJobId, id := range s.jobIds {
+		if _, err := s.jobs.Get(id); errors.Is(err, printing.ErrJobNotFound) {
+			delete(s.jobIds, ippJobId)
+		}
+	}
+}
+
+func (s *ippPrinterServer) queueJobId(ippJobId int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.jobIds[ippJobId]
+}
+
+func (s *ippPrinterServer) jobAttributes(r *http.Request, ippJobId int, job printing.Job) []ipp.Attribute {
+	printerUri := s.printerUri(r, job.Printer)
+	state, reason := ippJobState(job)
+
+	attrs := []ipp.Attribute{
+		ipp.NewAttribute("job-id", ipp.Integer(ipp.TagInteger, ippJobId)),
+		ipp.NewAttribute("job-uri", ipp.String(ipp.TagUri, fmt.Sprintf("%s/%d", printerUri, ippJobId))),
+		ipp.NewAttribute("job-printer-uri", ipp.String(ipp.TagUri, printerUri)),
+		ipp.NewAttribute("job-name", ipp.String(ipp.TagName, job.ID)),
+		ipp.NewAttribute("job-originating-user-name", ipp.String(ipp.TagName, job.User)),
+		ipp.NewAttribute("job-state", ipp.Integer(ipp.TagEnum, state)),
+		ipp.Keywords("job-state-reasons", reason),
+		ipp.NewAttribute("time-at-creation", s.upTime(&job.CreatedAt)),
+		ipp.NewAttribute("time-at-processing", s.upTime(job.StartedAt)),
+		ipp.NewAttribute("time-at-completed", s.upTime(job.FinishedAt)),
+	}
+
+	if job.Error != "" {
+		attrs = append(attrs, ipp.NewAttribute("job-state-message", ipp.String(ipp.TagText, job.Error)))
+	}
+
+	return attrs
+}
+
+// upTime converts time to printer up-time in seconds, as expected in time-at-* attributes
+func (s *ippPrinterServer) upTime(t *time.Time) ipp.Value {
+	if t == nil {
+		return ipp.Value{Tag: ipp.TagNoValue}
+	}
+	return ipp.Integer(ipp.TagInteger, max(int(t.Sub(s.startedAt).Seconds()), 1))
+}
+
+// ippJobState returns job-state and job-state-reasons values
+func ippJobState(job printing.Job) (int, string) {
+	switch job.State {
+	case printing.JobStateRendering, printing.JobStateSpooling:
+		return ipp.JobStateProcessing, "job-printing"
+	case printing.JobStateCompleted:
+		return ipp.JobStateCompleted, "job-completed-successfully"
+	case printing.JobStateFailed:
+		return ipp.JobStateAborted, "aborted-by-system"
+	case printing.JobStateCancelled:
+		return ipp.JobStateCanceled, "job-canceled-by-user"
+	default:
+		return ipp.JobStatePending, "none"
+	}
+}
+
+func sniffIppDocumentFormat(data []byte) string {
+	switch {
+	case printing.IsPdf(data):
+		return "application/pdf"
+	case printing.IsPwgRaster(data):
+		return "image/pwg-raster"
+	default:
+		return ""
+	}
+}
+
+// ippJobResponse reports ignored job attributes, if any
+func ippJobResponse(request *ipp.Message, unsupported []ipp.Attribute) *ipp.Message {
+	if len(unsupported) == 0 {
+		return ipp.NewResponse(ipp.StatusOk, request.RequestID)
+	}
+
+	response := ipp.NewResponse(ipp.StatusOkIgnoredOrSubstituted, request.RequestID)
+	response.Group(ipp.TagUnsupportedGroup).Add(unsupported...)
+
+	return response
+}
+
+func ippErrorResponse(request *ipp.Message, status ipp.Status, message string) *ipp.Message {
+	response := ipp.NewResponse(status, request.RequestID)
+	response.Group(ipp.TagOperationGroup).Add(ipp.NewAttribute("status-message", ipp.String(ipp.TagText, message)))
+	return response
+}
+
+// ippErrorFromError is the IPP counterpart of handleError
+func ippErrorFromError(request *ipp.Message, err error) *ipp.Message {
+	var status ipp.Status
+
+	switch {
+	case errors.Is(err, printing.ErrPrinterNotFound), errors.Is(err, printing.ErrJobNotFound):
+		status = ipp.StatusErrorNotFound
+	case errors.Is(err, printing.ErrRequestError), errors.Is(err, printing.ErrNotSupported):
+		status = ipp.StatusErrorAttributesOrValues
+	case errors.Is(err, printing.ErrJobNotCancellable):
+		status = ipp.StatusErrorNotPossible
+	case errors.Is(err, printing.ErrQueueFull):
+		status = ipp.StatusErrorBusy
+	case errors.Is(err, printing.ErrQueueClosed):
+		status = ipp.StatusErrorNotAcceptingJobs
+	default:
+		status = ipp.StatusErrorInternal
+	}
+
+	return ippErrorResponse(request, status, err.Error())
+}
@@ -0,0 +1,412 @@
+package server
+
+import (
+	"fmt"
+	"github.com/downace/print-server/internal/ipp"
+	"github.com/downace/print-server/internal/printing"
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// application/octet-stream means the format is detected from document contents
+var ippDocumentFormats = []string{"application/pdf", "image/pwg-raster", "application/octet-stream"}
+
+// PWG raster documents are rendered by clients, so single resolution is enough
+const ippRasterResolution = 300
+
+// ippMediaSize is a media size supported by printer. Dimensions are in hundredths of millimeters, as in media-col
+type ippMediaSize struct {
+	// PWG self-describing name, e.g. iso_a4_210x297mm
+	Name string
+	// Name passed to backend in PrintOptions, empty if backend doesn't report media sizes
+	Option string
+	Width  int
+	Height int
+}
+
+// ippDefaultMediaSizes are used when backend doesn't report media sizes
+var ippDefaultMediaSizes = []string{"iso_a4_210x297mm", "na_letter_8.5x11in"}
+
+// ippPpdMediaNames maps common PPD page sizes, as reported by lpoptions, to PWG names
+var ippPpdMediaNames = map[string]string{
+	"A3":        "iso_a3_297x420mm",
+	"A4":        "iso_a4_210x297mm",
+	"A5":        "iso_a5_148x210mm",
+	"A6":        "iso_a6_105x148mm",
+	"Letter":    "na_letter_8.5x11in",
+	"Legal":     "na_legal_8.5x14in",
+	"Executive": "na_executive_7.25x10.5in",
+	"Tabloid":   "na_ledger_11x17in",
+}
+
+var pwgMediaNameRegexp = regexp.MustCompile(`_([\d.]+)x([\d.]+)(mm|in)$`)
+
+// parsePwgMediaName returns dimensions encoded in PWG self-describing media name
+func parsePwgMediaName(name string) (int, int, bool) {
+	match := pwgMediaNameRegexp.FindStringSubmatch(name)
+	if match == nil {
+		return 0, 0, false
+	}
+
+	width, errWidth := strconv.ParseFloat(match[1], 64)
+	height, errHeight := strconv.ParseFloat(match[2], 64)
+	if errWidth != nil || errHeight != nil {
+		return 0, 0, false
+	}
+
+	scale := 100.0
+	if match[3] == "in" {
+		scale = 2540
+	}
+
+	return int(math.Round(width * scale)), int(math.Round(height * scale)), true
+}
+
+// ippMediaSizes converts media reported by backend to PWG media sizes, skipping unknown ones
+func ippMediaSizes(printer printing.PrinterDetails) []ippMediaSize {
+	var sizes []ippMediaSize
+
+	for _, media := range printer.Media {
+		name := media
+		if pwgName, ok := ippPpdMediaNames[media]; ok {
+			name = pwgName
+		}
+		if width, height, ok := parsePwgMediaName(name); ok {
+			sizes = append(sizes, ippMediaSize{Name: name, Option: media, Width: width, Height: height})
+		}
+	}
+
+	if len(sizes) > 0 {
+		return sizes
+	}
+
+	for _, name := range ippDefaultMediaSizes {
+		width, height, _ := parsePwgMediaName(name)
+		sizes = append(sizes, ippMediaSize{Name: name, Width: width, Height: height})
+	}
+
+	return sizes
+}
+
+func ippMediaCol(size ippMediaSize, source string) ipp.Value {
+	members := []ipp.Attribute{
+		ipp.NewAttribute("media-size", ipp.Collection(
+			ipp.NewAttribute("x-dimension", ipp.Integer(ipp.TagInteger, size.Width)),
+			ipp.NewAttribute("y-dimension", ipp.Integer(ipp.TagInteger, size.Height)),
+		)),
+		ipp.NewAttribute("media-size-name", ipp.String(ipp.TagKeyword, size.Name)),
+		// Documents are passed to the printer as is, so margins are up to the printer
+		ipp.NewAttribute("media-top-margin", ipp.Integer(ipp.TagInteger, 0)),
+		ipp.NewAttribute("media-bottom-margin", ipp.Integer(ipp.TagInteger, 0)),
+		ipp.NewAttribute("media-left-margin", ipp.Integer(ipp.TagInteger, 0)),
+		ipp.NewAttribute("media-right-margin", ipp.Integer(ipp.TagInteger, 0)),
+	}
+	if source != "" {
+		members = append(members, ipp.Keywords("media-source", source))
+	}
+	return ipp.Collection(members...)
+}
+
+func ippSidesSupported(printer printing.PrinterDetails) []string {
+	if printer.Duplex {
+		return []string{"one-sided", "two-sided-long-edge", "two-sided-short-edge"}
+	}
+	return []string{"one-sided"}
+}
+
+func ippColorModesSupported(printer printing.PrinterDetails) []string {
+	if printer.Color {
+		return []string{"auto", "monochrome", "color"}
+	}
+	return []string{"auto", "monochrome"}
+}
+
+// ippPrinterAttributes returns printer description and job template attributes required by IPP Everywhere
+func ippPrinterAttributes(
+	printer printing.PrinterDetails,
+	printerUri string,
+	tls bool,
+	authEnabled bool,
+	upTime time.Duration,
+) []ipp.Attribute {
+	mediaSizes := ippMediaSizes(printer)
+	defaultMedia := mediaSizes[0]
+	mediaSource := ""
+	if len(printer.InputTrays) > 0 {
+		mediaSource = printer.InputTrays[0]
+	}
+
+	state := ipp.PrinterStateIdle
+	switch printer.State {
+	case printing.PrinterStateProcessing:
+		state = ipp.PrinterStateProcessing
+	case printing.PrinterStateStopped:
+		state = ipp.PrinterStateStopped
+	}
+
+	stateReasons := printer.StateReasons
+	if len(stateReasons) == 0 {
+		stateReasons = []string{"none"}
+	}
+
+	security := "none"
+	if tls {
+		security = "tls"
+	}
+	authentication := "requesting-user-name"
+	if authEnabled {
+		authentication = "basic"
+	}
+
+	colorMode := "monochrome"
+	if printer.Color {
+		colorMode = "color"
+	}
+
+	rasterTypes := []string{"sgray_8"}
+	if printer.Color {
+		rasterTypes = append(rasterTypes, "srgb_8")
+	}
+
+	mediaCols := lo.Map(mediaSizes, func(size ippMediaSize, _ int) ipp.Value {
+		return ippMediaCol(size, "")
+	})
+
+	mediaSizeValues := lo.Map(mediaSizes, func(size ippMediaSize, _ int) ipp.Value {
+		return ipp.Collection(
+			ipp.NewAttribute("x-dimension", ipp.Integer(ipp.TagInteger, size.Width)),
+			ipp.NewAttribute("y-dimension", ipp.Integer(ipp.TagInteger, size.Height)),
+		)
+	})
+
+	attrs := []ipp.Attribute{
+		ipp.NewAttribute("printer-uri-supported", ipp.String(ipp.TagUri, printerUri)),
+		ipp.Keywords("uri-security-supported", security),
+		ipp.Keywords("uri-authentication-supported", authentication),
+		ipp.NewAttribute("printer-name", ipp.String(ipp.TagName, printer.Name)),
+		ipp.NewAttribute("printer-info", ipp.String(ipp.TagText, printer.Name)),
+		ipp.NewAttribute("printer-make-and-model", ipp.String(ipp.TagText, "Print Server")),
+		ipp.NewAttribute("printer-uuid", ipp.String(ipp.TagUri, ippPrinterUuid(printer.Name))),
+		ipp.NewAttribute("printer-state", ipp.Integer(ipp.TagEnum, state)),
+		ipp.Keywords("printer-state-reasons", stateReasons...),
+		ipp.NewAttribute("printer-is-accepting-jobs", ipp.Boolean(printer.AcceptingJobs)),
+		ipp.NewAttribute("queued-job-count", ipp.Integer(ipp.TagInteger, printer.QueuedJobs)),
+		ipp.NewAttribute("printer-up-time", ipp.Integer(ipp.TagInteger, max(int(upTime.Seconds()), 1))),
+		ipp.Keywords("ipp-versions-supported", "1.1", "2.0"),
+		ipp.Keywords("ipp-features-supported", "ipp-everywhere"),
+		ipp.NewAttribute("operations-supported", lo.Map(ippOperationsSupported, func(op ipp.Operation, _ int) ipp.Value {
+			return ipp.Integer(ipp.TagEnum, int(op))
+		})...),
+		ipp.NewAttribute("charset-configured", ipp.String(ipp.TagCharset, "utf-8")),
+		ipp.NewAttribute("charset-supported", ipp.String(ipp.TagCharset, "utf-8")),
+		ipp.NewAttribute("natural-language-configured", ipp.String(ipp.TagLanguage, "en")),
+		ipp.NewAttribute("generated-natural-language-supported", ipp.String(ipp.TagLanguage, "en")),
+		ipp.NewAttribute("document-format-default", ipp.String(ipp.TagMimeType, "application/pdf")),
+		ipp.NewAttribute("document-format-supported", lo.Map(ippDocumentFormats, func(format string, _ int) ipp.Value {
+			return ipp.String(ipp.TagMimeType, format)
+		})...),
+		ipp.Keywords("compression-supported", "none"),
+		ipp.Keywords("pdl-override-supported", "attempted"),
+		ipp.NewAttribute("multiple-document-jobs-supported", ipp.Boolean(false)),
+		ipp.Keywords("which-jobs-supported", "completed", "not-completed", "all"),
+		ipp.NewAttribute("copies-default", ipp.Integer(ipp.TagInteger, 1)),
+		ipp.NewAttribute("copies-supported", ipp.Range(1, 999)),
+		ipp.Keywords("sides-default", "one-sided"),
+		ipp.Keywords("sides-supported", ippSidesSupported(printer)...),
+		ipp.Keywords("print-color-mode-default", colorMode),
+		ipp.Keywords("print-color-mode-supported", ippColorModesSupported(printer)...),
+		ipp.NewAttribute("orientation-requested-default", ipp.Integer(ipp.TagEnum, 3)),
+		ipp.NewAttribute("orientation-requested-supported", ipp.Integer(ipp.TagEnum, 3), ipp.Integer(ipp.TagEnum, 4)),
+		ipp.NewAttribute("print-quality-default", ipp.Integer(ipp.TagEnum, 4)),
+		ipp.NewAttribute("print-quality-supported", ipp.Integer(ipp.TagEnum, 4)),
+		ipp.Keywords("print-scaling-default", "auto"),
+		ipp.Keywords("print-scaling-supported", "auto", "fit"),
+		ipp.NewAttribute("page-ranges-supported", ipp.Boolean(true)),
+		ipp.Keywords("multiple-document-handling-supported",
+			"separate-documents-uncollated-copies",
+			"separate-documents-collated-copies",
+		),
+		ipp.NewAttribute("printer-resolution-default", ipp.Resolution(ippRasterResolution, ippRasterResolution)),
+		ipp.NewAttribute("printer-resolution-supported", ipp.Resolution(ippRasterResolution, ippRasterResolution)),
+		ipp.NewAttribute("pwg-raster-document-resolution-supported", ipp.Resolution(ippRasterResolution, ippRasterResolution)),
+		ipp.Keywords("pwg-raster-document-type-supported", rasterTypes...),
+		ipp.Keywords("pwg-raster-document-sheet-back", "normal"),
+		ipp.Keywords("media-default", defaultMedia.Name),
+		ipp.Keywords("media-supported", lo.Map(mediaSizes, func(size ippMediaSize, _ int) string {
+			return size.Name
+		})...),
+		ipp.Keywords("media-ready", defaultMedia.Name),
+		ipp.NewAttribute("media-col-default", ippMediaCol(defaultMedia, mediaSource)),
+		ipp.NewAttribute("media-col-ready", ippMediaCol(defaultMedia, mediaSource)),
+		ipp.NewAttribute("media-col-database", mediaCols...),
+		ipp.Keywords("media-col-supported",
+			"media-size",
+			"media-size-name",
+			"media-source",
+			"media-top-margin",
+			"media-bottom-margin",
+			"media-left-margin",
+			"media-right-margin",
+		),
+		ipp.NewAttribute("media-size-supported", mediaSizeValues...),
+		ipp.NewAttribute("media-top-margin-supported", ipp.Integer(ipp.TagInteger, 0)),
+		ipp.NewAttribute("media-bottom-margin-supported", ipp.Integer(ipp.TagInteger, 0)),
+		ipp.NewAttribute("media-left-margin-supported", ipp.Integer(ipp.TagInteger, 0)),
+		ipp.NewAttribute("media-right-margin-supported", ipp.Integer(ipp.TagInteger, 0)),
+	}
+
+	if len(printer.InputTrays) > 0 {
+		attrs = append(attrs,
+			ipp.Keywords("media-source-supported", printer.InputTrays...),
+		)
+	}
+
+	return attrs
+}
+
+// ippPrinterUuid is derived from printer name, so it stays the same between restarts
+func ippPrinterUuid(printer string) string {
+	return "urn:uuid:" + uuid.NewSHA1(uuid.NameSpaceURL, []byte(ippPrinterPath+printer)).String()
+}
+
+// jobOptions converts job template attributes to print options. Attributes which can't be applied
+// are returned separately, or cause error if client requested ipp-attribute-fidelity
+func (s *ippPrinterServer) jobOptions(request *ipp.Message, printer printing.PrinterDetails) (printing.PrintOptions, []ipp.Attribute, error) {
+	var options printing.PrintOptions
+	var unsupported []ipp.Attribute
+
+	mediaSizes := ippMediaSizes(printer)
+
+	for _, attr := range request.Group(ipp.TagJobGroup).Attributes {
+		value := attr.First()
+		ok := true
+
+		switch attr.Name {
+		case "copies":
+			options.Copies = value.Int()
+			ok = options.Copies >= 1 && options.Copies <= 999
+		case "sides":
+			options.Sides = value.String()
+			ok = slices.Contains(ippSidesSupported(printer), options.Sides)
+		case "print-color-mode":
+			ok = slices.Contains(ippColorModesSupported(printer), value.String())
+			if value.String() != "auto" {
+				options.ColorMode = value.String()
+			}
+		case "media":
+			size, found := lo.Find(mediaSizes, func(size ippMediaSize) bool {
+				return size.Name == value.String()
+			})
+			options.Media = size.Option
+			ok = found
+		case "media-col":
+			ok = applyIppMediaCol(&options, value, mediaSizes, printer.InputTrays)
+		case "orientation-requested":
+			switch value.Int() {
+			case 3:
+				options.Orientation = "portrait"
+			case 4:
+				options.Orientation = "landscape"
+			default:
+				ok = false
+			}
+		case "page-ranges":
+			options.PageRanges = strings.Join(lo.Map(attr.Values, func(v ipp.Value, _ int) string {
+				lower, upper := v.Range()
+				return fmt.Sprintf("%d-%d", lower, upper)
+			}), ",")
+		case "print-scaling":
+			switch value.String() {
+			case "fit":
+				options.FitToPage = true
+			case "auto":
+			default:
+				ok = false
+			}
+		case "multiple-document-handling":
+			switch value.String() {
+			case "separate-documents-collated-copies":
+				options.Collate = lo.ToPtr(true)
+			case "separate-documents-uncollated-copies":
+				options.Collate = lo.ToPtr(false)
+			default:
+				ok = false
+			}
+		case "print-quality", "printer-resolution":
+			// Only one value is supported, nothing to apply
+		default:
+			ok = false
+		}
+
+		if !ok {
+			unsupported = append(unsupported, attr)
+		}
+	}
+
+	fidelity := request.Group(ipp.TagOperationGroup).Get("ipp-attribute-fidelity").First().Bool()
+
+	if len(unsupported) > 0 && fidelity {
+		names := lo.Map(unsupported, func(attr ipp.Attribute, _ int) string {
+			return attr.Name
+		})
+		return options, unsupported, fmt.Errorf("%w: unsupported job attributes: %s", printing.ErrRequestError, strings.Join(names, ", "))
+	}
+
+	// Unsupported values are ignored
+	if !slices.Contains(ippSidesSupported(printer), options.Sides) {
+		options.Sides = ""
+	}
+	if !slices.Contains(ippColorModesSupported(printer), options.ColorMode) {
+		options.ColorMode = ""
+	}
+	if options.Copies < 1 || options.Copies > 999 {
+		options.Copies = 0
+	}
+
+	return options, unsupported, nil
+}
+
+// applyIppMediaCol handles media-col job attribute. Media size is matched by dimensions
+func applyIppMediaCol(options *printing.PrintOptions, value ipp.Value, mediaSizes []ippMediaSize, inputTrays []string) bool {
+	ok := true
+
+	for _, member := range value.Members {
+		switch member.Name {
+		case "media-size":
+			var width, height int
+			for _, dimension := range member.First().Members {
+				switch dimension.Name {
+				case "x-dimension":
+					width = dimension.First().Int()
+				case "y-dimension":
+					height = dimension.First().Int()
+				}
+			}
+			size, found := lo.Find(mediaSizes, func(size ippMediaSize) bool {
+				return size.Width == width && size.Height == height
+			})
+			options.Media = size.Option
+			ok = ok && found
+		case "media-size-name":
+			size, found := lo.Find(mediaSizes, func(size ippMediaSize) bool {
+				return size.Name == member.First().String()
+			})
+			options.Media = size.Option
+			ok = ok && found
+		case "media-source":
+			if slices.Contains(inputTrays, member.First().String()) {
+				options.InputTray = member.First().String()
+			} else if member.First().String() != "auto" {
+				ok = false
+			}
+		}
+	}
+
+	return ok
+}
@@ -0,0 +1,187 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"github.com/downace/print-server/internal/appconfig"
+	"github.com/downace/print-server/internal/ipp"
+	"github.com/downace/print-server/internal/logging"
+	"github.com/downace/print-server/internal/printing"
+	"github.com/downace/print-server/internal/printing/printingtest"
+	"io"
+	"log"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+const testPdf = "%PDF-1.4\n%%EOF\n"
+
+func newTestIppServer(t *testing.T, config appconfig.AppConfig) (*ippPrinterServer, *printing.JobQueue, *ipp.Client) {
+	t.Helper()
+
+	logging.HttpLog = log.New(io.Discard, "", 0)
+	backend, jobs := newTestJobQueue(t)
+	l := createIppListener(netip.MustParseAddr("127.0.0.1"), config, backend, jobs).(*ippListener)
+
+	server := httptest.NewServer(l.server.Handler)
+	t.Cleanup(server.Close)
+
+	client, err := ipp.NewClient(server.URL, "", "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return l.printers, jobs, client
+}
+
+func ippJobRequest(client *ipp.Client, op ipp.Operation, ippJobId int) *ipp.Message {
+	request := client.NewRequest(op)
+	request.Group(ipp.TagOperationGroup).Add(ipp.NewAttribute("job-id", ipp.Integer(ipp.TagInteger, ippJobId)))
+	return request
+}
+
+func ippStatus(err error) ipp.Status {
+	var statusErr *ipp.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Status
+	}
+	return ipp.StatusOk
+}
+
+func TestIppPrintJob(t *testing.T) {
+	printers, jobs, client := newTestIppServer(t, appconfig.AppConfig{})
+	path := ippPrinterPath + "Archive"
+
+	request := client.NewRequest(ipp.OpPrintJob)
+	request.Group(ipp.TagOperationGroup).Add(ipp.NewAttribute("requesting-user-name", ipp.String(ipp.TagName, "alice")))
+
+	response, err := client.Do(path, request, bytes.NewReader([]byte(testPdf)))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ippJobId := response.Group(ipp.TagJobGroup).Get("job-id").First().Int()
+	printingtest.WaitFinished(t, jobs, printers.queueJobId(ippJobId))
+
+	response, err = client.Do(path, ippJobRequest(client, ipp.OpGetJobAttributes, ippJobId), nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attrs := response.Group(ipp.TagJobGroup)
+	if state := attrs.Get("job-state").First().Int(); state != ipp.JobStateCompleted {
+		t.Errorf("got job-state %d, want completed", state)
+	}
+	if user := attrs.Get("job-originating-user-name").First().String(); user != "alice" {
+		t.Errorf("got user %q, want alice", user)
+	}
+
+	// Job of another printer is not found
+	_, err = client.Do(ippPrinterPath+"Labels", ippJobRequest(client, ipp.OpGetJobAttributes, ippJobId), nil)
+
+	if status := ippStatus(err); status != ipp.StatusErrorNotFound {
+		t.Errorf("got status 0x%04x for another printer, want not found", status)
+	}
+
+	// Completed job can't be cancelled
+	_, err = client.Do(path, ippJobRequest(client, ipp.OpCancelJob, ippJobId), nil)
+
+	if status := ippStatus(err); status != ipp.StatusErrorNotPossible {
+		t.Errorf("got status 0x%04x for completed job, want not possible", status)
+	}
+}
+
+func TestIppCancelJob(t *testing.T) {
+	printers, jobs, client := newTestIppServer(t, appconfig.AppConfig{})
+	path := ippPrinterPath + "Archive"
+
+	// Queue has a single worker, so IPP job waits until this one is rendered
+	release := make(chan struct{})
+	blocking, err := jobs.Submit(printing.JobRequest{
+		Printer: "Archive",
+		Render: func() ([]byte, error) {
+			<-release
+			return []byte(testPdf), nil
+		},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := client.Do(path, client.NewRequest(ipp.OpPrintJob), bytes.NewReader([]byte(testPdf)))
+
+	if err != nil {
+		close(release)
+		t.Fatal(err)
+	}
+
+	ippJobId := response.Group(ipp.TagJobGroup).Get("job-id").First().Int()
+
+	_, err = client.Do(path, ippJobRequest(client, ipp.OpCancelJob, ippJobId), nil)
+	close(release)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	printingtest.WaitFinished(t, jobs, blocking.ID)
+
+	response, err = client.Do(path, ippJobRequest(client, ipp.OpGetJobAttributes, ippJobId), nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state := response.Group(ipp.TagJobGroup).Get("job-state").First().Int(); state != ipp.JobStateCanceled {
+		t.Errorf("got job-state %d, want canceled", state)
+	}
+	if job, _ := jobs.Get(printers.queueJobId(ippJobId)); job.State != printing.JobStateCancelled {
+		t.Errorf("queue job is %s, want cancelled", job.State)
+	}
+
+	_, err = client.Do(path, ippJobRequest(client, ipp.OpCancelJob, ippJobId+1), nil)
+
+	if status := ippStatus(err); status != ipp.StatusErrorNotFound {
+		t.Errorf("got status 0x%04x for unknown job, want not found", status)
+	}
+}
+
+func TestIppPrintJobTooLarge(t *testing.T) {
+	_, _, client := newTestIppServer(t, appconfig.AppConfig{Jobs: appconfig.JobsConfig{MaxDocumentSizeMB: 1}})
+
+	document := append([]byte(testPdf), bytes.Repeat([]byte{' '}, 2<<20)...)
+	_, err := client.Do(ippPrinterPath+"Archive", client.NewRequest(ipp.OpPrintJob), bytes.NewReader(document))
+
+	if status := ippStatus(err); status != ipp.StatusErrorRequestEntityTooLarge {
+		t.Errorf("got status 0x%04x (%v), want request entity too large", status, err)
+	}
+}
+
+func TestIppRemoveExpiredJobIds(t *testing.T) {
+	printers, jobs, _ := newTestIppServer(t, appconfig.AppConfig{})
+
+	job, err := jobs.Submit(printing.JobRequest{Printer: "Archive", Render: printing.PdfRenderer([]byte(testPdf))})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kept := printers.addJob(job.ID)
+	expired := printers.addJob("removed-from-history")
+
+	// Cleanup is due on the next job
+	printers.jobIdsCleanAt = printers.jobIdsCleanAt.Add(-ippJobIdsCleanupInterval)
+	printers.addJob(job.ID)
+
+	if printers.queueJobId(kept) != job.ID {
+		t.Error("existing job is forgotten")
+	}
+	if printers.queueJobId(expired) != "" {
+		t.Error("job removed from history is not forgotten")
+	}
+}
@@ -0,0 +1,534 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/downace/print-server/internal/printing"
+	"github.com/samber/lo"
+	"io"
+	"log"
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultLpdPort = 515
+
+const lpdIdleTimeout = 30 * time.Second
+
+// LPD job numbers have 3 digits
+const lpdMaxJobNumber = 999
+
+// Control file contains just a few short lines
+const lpdMaxControlFileSize = 64 * 1024
+
+// LPD commands and "receive a printer job" subcommands, see RFC 1179
+const (
+	lpdPrintWaitingJobs   = 1
+	lpdReceiveJob         = 2
+	lpdSendQueueShort     = 3
+	lpdSendQueueLong      = 4
+	lpdRemoveJobs         = 5
+	lpdAbortJob           = 1
+	lpdReceiveControlFile = 2
+	lpdReceiveDataFile    = 3
+)
+
+var lpdAck = []byte{0}
+var lpdNak = []byte{1}
+
+// lpdPrintCommands are control file commands which print a data file, each one prints a copy
+const lpdPrintCommands = "cdfglnoprtv"
+
+// lpdListener accepts jobs from LPR clients. LPD queue names are printer names
+type lpdListener struct {
+	tcpListener
+	backend printing.Backend
+	jobs    *printing.JobQueue
+	// Max total size of data files of a job
+	maxSize int64
+	// Printers allowed to receive raw data, other printers accept PDF only
+	rawPrinters []string
+
+	mu sync.Mutex
+	// LPD requires job numbers, they are assigned to queue jobs when needed
+	jobNumbers    map[string]int
+	jobIds        map[int]string
+	lastJobNumber int
+	// Names of files received using LPD, by queue job ID
+	fileNames map[string]string
+}
+
+// lpdJob is a job received from LPR client
+type lpdJob struct {
+	user string
+	// Paths of temporary files by data file name
+	dataFiles map[string]string
+	// File names in order of receiving
+	dataFileNames []string
+	controlFile   string
+}
+
+func createLpdListener(
+	host netip.Addr,
+	port uint16,
+	maxSize int64,
+	rawPrinters []string,
+	backend printing.Backend,
+	jobs *printing.JobQueue,
+) listener {
+	if port == 0 {
+		port = defaultLpdPort
+	}
+
+	l := &lpdListener{
+		tcpListener: tcpListener{addr: netip.AddrPortFrom(host, port)},
+		backend:     backend,
+		jobs:        jobs,
+		maxSize:     maxSize,
+		rawPrinters: rawPrinters,
+		jobNumbers:  make(map[string]int),
+		jobIds:      make(map[int]string),
+		fileNames:   make(map[string]string),
+	}
+	l.handler = l.handle
+	return l
+}
+
+func (l *lpdListener) handle(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(idleTimeoutConn{Conn: conn, timeout: lpdIdleTimeout})
+	code, args, err := readLpdCommand(r)
+
+	if err != nil {
+		return
+	}
+
+	switch code {
+	case lpdPrintWaitingJobs:
+		// Jobs are always printed as soon as possible
+	case lpdReceiveJob:
+		l.receiveJob(conn, r, args)
+	case lpdSendQueueShort, lpdSendQueueLong:
+		l.sendQueueState(conn, args, code == lpdSendQueueLong)
+	case lpdRemoveJobs:
+		l.removeJobs(conn, args)
+	}
+}
+
+// readLpdCommand reads command code and its space-separated operands
+func readLpdCommand(r *bufio.Reader) (byte, []string, error) {
+	line, err := r.ReadString('\n')
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	line = strings.TrimSuffix(line, "\n")
+
+	if line == "" {
+		return 0, nil, fmt.Errorf("empty LPD command")
+	}
+
+	return line[0], strings.Fields(line[1:]), nil
+}
+
+func (l *lpdListener) findPrinter(queue string) (bool, error) {
+	printers, err := l.backend.ListPrinters()
+
+	if err != nil {
+		return false, err
+	}
+
+	return lo.ContainsBy(printers, func(p printing.Printer) bool {
+		return p.Name == queue
+	}), nil
+}
+
+func (l *lpdListener) receiveJob(conn net.Conn, r *bufio.Reader, args []string) {
+	if len(args) == 0 {
+		_, _ = conn.Write(lpdNak)
+		return
+	}
+
+	printer := args[0]
+
+	if found, err := l.findPrinter(printer); err != nil || !found {
+		_, _ = conn.Write(lpdNak)
+		return
+	}
+
+	_, _ = conn.Write(lpdAck)
+
+	job := lpdJob{dataFiles: make(map[string]string)}
+
+	defer func() {
+		for _, path := range job.dataFiles {
+			_ = os.Remove(path)
+		}
+	}()
+
+	var received int64
+
+	// Client sends files and closes connection when the job is complete
+	for {
+		code, args, err := readLpdCommand(r)
+
+		if errors.Is(err, io.EOF) || errors.Is(err, os.ErrDeadlineExceeded) {
+			break
+		}
+		if err != nil {
+			log.Printf("error receiving LPD job: %s", err)
+			return
+		}
+
+		if code == lpdAbortJob {
+			return
+		}
+
+		if code != lpdReceiveControlFile && code != lpdReceiveDataFile || len(args) < 2 {
+			_, _ = conn.Write(lpdNak)
+			return
+		}
+
+		maxSize := l.maxSize - received
+		if code == lpdReceiveControlFile {
+			maxSize = lpdMaxControlFileSize
+		}
+
+		count, err := strconv.ParseInt(args[0], 10, 64)
+
+		if err != nil || count <= 0 || count > maxSize {
+			_, _ = conn.Write(lpdNak)
+			return
+		}
+
+		_, _ = conn.Write(lpdAck)
+
+		if code == lpdReceiveControlFile {
+			// File is followed by zero byte
+			data := make([]byte, count+1)
+			_, err = io.ReadFull(r, data)
+			job.controlFile = string(data[:count])
+		} else {
+			var path string
+			path, err = receiveLpdDataFile(r, count)
+			if err == nil {
+				// File sent again replaces the previous one
+				if oldPath, ok := job.dataFiles[args[1]]; ok {
+					_ = os.Remove(oldPath)
+				} else {
+					job.dataFileNames = append(job.dataFileNames, args[1])
+				}
+				job.dataFiles[args[1]] = path
+				received += count
+			}
+		}
+
+		if err != nil {
+			log.Printf("error receiving LPD job file: %s", err)
+			return
+		}
+
+		_, _ = conn.Write(lpdAck)
+	}
+
+	clientIP, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+
+	l.submitJob(printer, clientIP, job)
+}
+
+// receiveLpdDataFile saves data file to temporary file, so memory is used only for data actually received
+func receiveLpdDataFile(r *bufio.Reader, count int64) (string, error) {
+	f, err := os.CreateTemp("", "print-server-lpd-*")
+
+	if err != nil {
+		return "", err
+	}
+
+	_, err = io.CopyN(f, r, count)
+
+	// File is followed by zero byte
+	if err == nil {
+		_, err = r.ReadByte()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+
+	return f.Name(), nil
+}
+
+// submitJob submits each data file as a separate job. Control file may request several copies of a file
+func (l *lpdListener) submitJob(printer string, clientIP string, job lpdJob) {
+	copies := make(map[string]int)
+	names := make(map[string]string)
+	lastFile := ""
+
+	for _, line := range strings.Split(job.controlFile, "\n") {
+		if line == "" {
+			continue
+		}
+		switch {
+		case line[0] == 'P':
+			job.user = line[1:]
+		case line[0] == 'N':
+			// Source file name follows print command of its data file
+			names[lastFile] = line[1:]
+		case strings.IndexByte(lpdPrintCommands, line[0]) >= 0:
+			lastFile = line[1:]
+			copies[lastFile]++
+		}
+	}
+
+	for _, fileName := range job.dataFileNames {
+		n := copies[fileName]
+
+		// Without control file each data file is printed once
+		if job.controlFile == "" {
+			n = 1
+		}
+		if n == 0 {
+			continue
+		}
+
+		data, err := os.ReadFile(job.dataFiles[fileName])
+
+		if err != nil {
+			log.Printf("error reading LPD job file: %s", err)
+			return
+		}
+
+		request := printing.JobRequest{
+			Printer:  printer,
+			Source:   printing.JobSourceLPD,
+			ClientIP: clientIP,
+			User:     job.user,
+			Raw:      !printing.IsPdf(data),
+			Render:   printing.PdfRenderer(data),
+		}
+
+		if request.Raw && !slices.Contains(l.rawPrinters, printer) {
+			log.Printf("LPD job file %s is not PDF and raw printing is not allowed for printer %s", fileName, printer)
+			continue
+		}
+
+		// Copies of raw documents can't be requested from the printer
+		submissions := 1
+		if request.Raw {
+			submissions = n
+		} else if n > 1 {
+			request.Options.Copies = n
+		}
+
+		for range submissions {
+			queued, err := l.jobs.Submit(request)
+
+			if err != nil {
+				log.Printf("error submitting LPD job: %s", err)
+				return
+			}
+
+			// Number is assigned right away, so it's known to the client in the order of submission
+			l.jobNumber(queued.ID)
+
+			l.mu.Lock()
+			l.fileNames[queued.ID] = lo.CoalesceOrEmpty(names[fileName], fileName)
+			l.mu.Unlock()
+		}
+	}
+}
+
+// jobNumber returns LPD number of the job, assigning it if needed. Numbers are reused after 999
+func (l *lpdListener) jobNumber(id string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if number, ok := l.jobNumbers[id]; ok {
+		return number
+	}
+
+	l.lastJobNumber = l.lastJobNumber%lpdMaxJobNumber + 1
+	number := l.lastJobNumber
+
+	if oldId, ok := l.jobIds[number]; ok {
+		delete(l.jobNumbers, oldId)
+		delete(l.fileNames, oldId)
+	}
+
+	l.jobNumbers[id] = number
+	l.jobIds[number] = id
+
+	return number
+}
+
+// pendingJobs returns unfinished jobs of the printer, oldest first, matching user names or job numbers from the list
+func (l *lpdListener) pendingJobs(printer string, list []string) ([]printing.Job, error) {
+	jobs, err := l.jobs.List(printing.JobFilter{Printer: printer, Limit: 1000})
+
+	if err != nil {
+		return nil, err
+	}
+
+	jobs = lo.Filter(jobs, func(job printing.Job, _ int) bool {
+		if job.Finished() {
+			return false
+		}
+		if len(list) == 0 {
+			return true
+		}
+		return slices.ContainsFunc(list, func(item string) bool {
+			number, err := strconv.Atoi(item)
+			if err == nil {
+				return l.jobNumber(job.ID) == number
+			}
+			return job.User == item
+		})
+	})
+
+	slices.Reverse(jobs)
+
+	return jobs, nil
+}
+
+// sendQueueState responds in a format similar to BSD lpd
+func (l *lpdListener) sendQueueState(conn net.Conn, args []string, long bool) {
+	if len(args) == 0 {
+		return
+	}
+
+	printer := args[0]
+
+	if found, err := l.findPrinter(printer); err != nil || !found {
+		_, _ = fmt.Fprintf(conn, "%s: unknown printer\n", printer)
+		return
+	}
+
+	jobs, err := l.pendingJobs(printer, args[1:])
+
+	if err != nil {
+		_, _ = fmt.Fprintf(conn, "%s: %s\n", printer, err)
+		return
+	}
+
+	var out strings.Builder
+
+	active := slices.ContainsFunc(jobs, func(job printing.Job) bool {
+		return job.State != printing.JobStateQueued
+	})
+
+	if active {
+		out.WriteString(fmt.Sprintf("%s is ready and printing\n", printer))
+	} else {
+		out.WriteString(fmt.Sprintf("%s is ready\n", printer))
+	}
+
+	if len(jobs) == 0 {
+		out.WriteString("no entries\n")
+	} else if !long {
+		out.WriteString(fmt.Sprintf("%-7s %-10s %-4s %-37s %s\n", "Rank", "Owner", "Job", "File(s)", "Total Size"))
+	}
+
+	// Active jobs go first, then queued ones in order
+	slices.SortStableFunc(jobs, func(a, b printing.Job) int {
+		return lo.Ternary(a.State == printing.JobStateQueued, 1, 0) - lo.Ternary(b.State == printing.JobStateQueued, 1, 0)
+	})
+
+	queued := 0
+	for _, job := range jobs {
+		rank := "active"
+		if job.State == printing.JobStateQueued {
+			queued++
+			rank = lpdRank(queued)
+		}
+
+		number := l.jobNumber(job.ID)
+		owner := lo.CoalesceOrEmpty(job.User, "unknown")
+		fileName := l.fileName(job)
+
+		if long {
+			out.WriteString(fmt.Sprintf("\n%s: %-34s [job %03d %s]\n", owner, rank, number, job.ClientIP))
+			out.WriteString(fmt.Sprintf("        %-32s %d bytes\n", fileName, job.Size))
+		} else {
+			out.WriteString(fmt.Sprintf("%-7s %-10s %-4d %-37s %d bytes\n", rank, owner, number, fileName, job.Size))
+		}
+	}
+
+	_, _ = conn.Write([]byte(out.String()))
+}
+
+// removeJobs cancels jobs from the list. Agent may remove only own jobs, unless it's root.
+// Agent name is sent by client as is, so root is trusted only on the same host
+func (l *lpdListener) removeJobs(conn net.Conn, args []string) {
+	if len(args) < 2 {
+		return
+	}
+
+	printer, agent := args[0], args[1]
+	clientAddr, _ := netip.ParseAddrPort(conn.RemoteAddr().String())
+	isRoot := agent == "root" && clientAddr.Addr().Unmap().IsLoopback()
+
+	if found, err := l.findPrinter(printer); err != nil || !found {
+		_, _ = fmt.Fprintf(conn, "%s: unknown printer\n", printer)
+		return
+	}
+
+	jobs, err := l.pendingJobs(printer, args[2:])
+
+	if err != nil {
+		_, _ = fmt.Fprintf(conn, "%s: %s\n", printer, err)
+		return
+	}
+
+	for _, job := range jobs {
+		if !isRoot && job.User != agent {
+			continue
+		}
+
+		number := l.jobNumber(job.ID)
+
+		if _, err := l.jobs.Cancel(job.ID); err != nil {
+			_, _ = fmt.Fprintf(conn, "job %03d: %s\n", number, err)
+		} else {
+			_, _ = fmt.Fprintf(conn, "job %03d dequeued\n", number)
+		}
+	}
+}
+
+func (l *lpdListener) fileName(job printing.Job) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if name, ok := l.fileNames[job.ID]; ok {
+		return name
+	}
+	return lo.CoalesceOrEmpty(job.Url, string(job.Source))
+}
+
+// lpdRank returns ordinal number, e.g. 1st or 12th
+func lpdRank(n int) string {
+	switch {
+	case n%100 >= 11 && n%100 <= 13:
+		return fmt.Sprintf("%dth", n)
+	case n%10 == 1:
+		return fmt.Sprintf("%dst", n)
+	case n%10 == 2:
+		return fmt.Sprintf("%dnd", n)
+	case n%10 == 3:
+		return fmt.Sprintf("%drd", n)
+	default:
+		return fmt.Sprintf("%dth", n)
+	}
+}
@@ -0,0 +1,260 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"github.com/downace/print-server/internal/printing"
+	"github.com/downace/print-server/internal/printing/printingtest"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+)
+
+// newTestJobQueue returns queue printing to virtual printers Archive and Labels
+func newTestJobQueue(t *testing.T) (printing.Backend, *printing.JobQueue) {
+	t.Helper()
+
+	backend, err := printing.NewVirtualBackend([]printing.VirtualPrinter{
+		{Name: "Archive", Directory: t.TempDir()},
+		{Name: "Labels", Directory: t.TempDir()},
+	}, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return backend, printingtest.NewJobQueue(t, backend)
+}
+
+// lpdExchange sends LPD messages one by one, reading one byte of response after each of them.
+// Returns responses until connection is closed by server
+func lpdExchange(t *testing.T, l *lpdListener, messages ...string) []byte {
+	t.Helper()
+
+	client, server := net.Pipe()
+	done := make(chan struct{})
+
+	go func() {
+		l.handle(server)
+		close(done)
+	}()
+
+	var responses []byte
+
+	for _, message := range messages {
+		if _, err := io.WriteString(client, message); err != nil {
+			break
+		}
+		response := make([]byte, 1)
+		if _, err := io.ReadFull(client, response); err != nil {
+			break
+		}
+		responses = append(responses, response[0])
+	}
+
+	_ = client.Close()
+	<-done
+
+	return responses
+}
+
+func TestLpdReceiveJob(t *testing.T) {
+	backend, jobs := newTestJobQueue(t)
+	l := createLpdListener(netip.IPv4Unspecified(), 515, 1024, []string{"Archive"}, backend, jobs).(*lpdListener)
+
+	control := "Hhost\nPuser\nldfA001host\nNlabel.zpl\n"
+	data := "^XA^FDtest^FS^XZ"
+
+	responses := lpdExchange(t, l,
+		"\x02Archive\n",
+		fmt.Sprintf("\x02%d cfA001host\n", len(control)),
+		control+"\x00",
+		fmt.Sprintf("\x03%d dfA001host\n", len(data)),
+		data+"\x00",
+	)
+
+	if string(responses) != "\x00\x00\x00\x00\x00" {
+		t.Fatalf("unexpected responses: %q", responses)
+	}
+
+	list, err := jobs.List(printing.JobFilter{Printer: "Archive"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].User != "user" || !list[0].Raw {
+		t.Fatalf("unexpected jobs: %+v", list)
+	}
+}
+
+func TestLpdRejectsFileSize(t *testing.T) {
+	backend, jobs := newTestJobQueue(t)
+	l := createLpdListener(netip.IPv4Unspecified(), 515, 1024, []string{"Archive"}, backend, jobs).(*lpdListener)
+
+	tests := []struct {
+		name       string
+		subcommand string
+	}{
+		{name: "zero", subcommand: "\x030 dfA001host\n"},
+		{name: "negative", subcommand: "\x03-1 dfA001host\n"},
+		{name: "larger than max size", subcommand: "\x031025 dfA001host\n"},
+		{name: "huge", subcommand: "\x039223372036854775807 dfA001host\n"},
+		{name: "invalid", subcommand: "\x03abc dfA001host\n"},
+		{name: "large control file", subcommand: "\x021000000 cfA001host\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			responses := lpdExchange(t, l, "\x02Archive\n", tt.subcommand)
+
+			if string(responses) != "\x00\x01" {
+				t.Errorf("unexpected responses: %q", responses)
+			}
+		})
+	}
+}
+
+func TestLpdRejectsTotalSize(t *testing.T) {
+	backend, jobs := newTestJobQueue(t)
+	l := createLpdListener(netip.IPv4Unspecified(), 515, 10, []string{"Archive"}, backend, jobs).(*lpdListener)
+
+	responses := lpdExchange(t, l,
+		"\x02Archive\n",
+		"\x036 dfA001host\n",
+		"123456\x00",
+		"\x036 dfB001host\n",
+	)
+
+	if string(responses) != "\x00\x00\x00\x01" {
+		t.Errorf("unexpected responses: %q", responses)
+	}
+}
+
+func TestTcpListenerRecoversPanic(t *testing.T) {
+	l := &tcpListener{handler: func(net.Conn) {
+		panic("handler bug")
+	}}
+
+	client, server := net.Pipe()
+	l.handle(server)
+
+	// Connection is closed after panic
+	if _, err := client.Read(make([]byte, 1)); err == nil {
+		t.Error("expected closed connection")
+	}
+}
+
+func TestLpdSkipsRawDataForNotAllowedPrinter(t *testing.T) {
+	backend, jobs := newTestJobQueue(t)
+	l := createLpdListener(netip.IPv4Unspecified(), 515, 1024, []string{"Archive"}, backend, jobs).(*lpdListener)
+
+	raw := "^XA^FDtest^FS^XZ"
+	pdf := "%PDF-1.4\n"
+
+	responses := lpdExchange(t, l,
+		"\x02Labels\n",
+		fmt.Sprintf("\x03%d dfA001host\n", len(raw)),
+		raw+"\x00",
+		fmt.Sprintf("\x03%d dfB001host\n", len(pdf)),
+		pdf+"\x00",
+	)
+
+	if string(responses) != "\x00\x00\x00\x00\x00" {
+		t.Fatalf("unexpected responses: %q", responses)
+	}
+
+	list, err := jobs.List(printing.JobFilter{Printer: "Labels"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Raw {
+		t.Fatalf("expected PDF job only, got %+v", list)
+	}
+}
+
+func TestLpdRemoveJobs(t *testing.T) {
+	tests := []struct {
+		name     string
+		agent    string
+		loopback bool
+		// Whether job of alice is cancelled
+		want bool
+	}{
+		{name: "owner", agent: "alice", want: true},
+		{name: "other user", agent: "bob", want: false},
+		{name: "remote root", agent: "root", want: false},
+		{name: "local root", agent: "root", loopback: true, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend, jobs := newTestJobQueue(t)
+			l := createLpdListener(netip.IPv4Unspecified(), 515, 1024, []string{"Archive"}, backend, jobs).(*lpdListener)
+
+			// Queue has a single worker, so job of alice waits until this one is rendered
+			release := make(chan struct{})
+			defer close(release)
+			_, err := jobs.Submit(printing.JobRequest{
+				Printer: "Archive",
+				Render: func() ([]byte, error) {
+					<-release
+					return nil, errors.New("not printed")
+				},
+			})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			job, err := jobs.Submit(printing.JobRequest{Printer: "Archive", User: "alice", Render: printing.PdfRenderer(nil)})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			client, server := net.Pipe()
+			if tt.loopback {
+				client, server = loopbackConn(t)
+			}
+
+			go l.handle(server)
+			_, _ = io.WriteString(client, "\x05Archive "+tt.agent+"\n")
+			_, _ = io.ReadAll(client)
+			_ = client.Close()
+
+			job, _ = jobs.Get(job.ID)
+
+			if cancelled := job.State == printing.JobStateCancelled; cancelled != tt.want {
+				t.Errorf("job is %s", job.State)
+			}
+		})
+	}
+}
+
+// loopbackConn returns both ends of TCP connection on loopback interface
+func loopbackConn(t *testing.T) (net.Conn, net.Conn) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := ln.Accept()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client, server
+}
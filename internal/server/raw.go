@@ -0,0 +1,81 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"github.com/downace/print-server/internal/appconfig"
+	"github.com/downace/print-server/internal/printing"
+	"io"
+	"log"
+	"net"
+	"net/netip"
+	"os"
+	"time"
+)
+
+// rawIdleTimeout ends the document if client stops sending data but doesn't close connection
+const rawIdleTimeout = 30 * time.Second
+
+// rawListener accepts print data on TCP port, like JetDirect port 9100 of network printers.
+// Document ends when client closes connection
+type rawListener struct {
+	tcpListener
+	printer string
+	maxSize int64
+	jobs    *printing.JobQueue
+}
+
+func createRawListener(host netip.Addr, config appconfig.RawPortConfig, maxSize int64, jobs *printing.JobQueue) listener {
+	l := &rawListener{
+		tcpListener: tcpListener{addr: netip.AddrPortFrom(host, config.Port)},
+		printer:     config.Printer,
+		maxSize:     maxSize,
+		jobs:        jobs,
+	}
+	l.handler = l.handle
+	return l
+}
+
+func (l *rawListener) serve() error {
+	if l.printer == "" {
+		return fmt.Errorf("printer is not set for raw port %d", l.addr.Port())
+	}
+	return l.tcpListener.serve()
+}
+
+func (l *rawListener) handle(conn net.Conn) {
+	defer conn.Close()
+
+	data, err := io.ReadAll(io.LimitReader(idleTimeoutConn{Conn: conn, timeout: rawIdleTimeout}, l.maxSize+1))
+
+	if err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
+		log.Printf("error reading data on %s: %s", l.addr, err)
+		return
+	}
+
+	if int64(len(data)) > l.maxSize {
+		log.Printf("document received on %s is larger than %d bytes", l.addr, l.maxSize)
+		return
+	}
+
+	if len(data) == 0 {
+		return
+	}
+
+	clientIP, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+
+	job, err := l.jobs.Submit(printing.JobRequest{
+		Printer:  l.printer,
+		Source:   printing.JobSourceSocket,
+		ClientIP: clientIP,
+		Raw:      !printing.IsPdf(data),
+		Render:   printing.PdfRenderer(data),
+	})
+
+	if err != nil {
+		log.Printf("error submitting job received on %s: %s", l.addr, err)
+		return
+	}
+
+	log.Printf("job %s received on %s from %s", job.ID, l.addr, clientIP)
+}
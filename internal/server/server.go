@@ -1,15 +1,20 @@
 package server
 
 import (
+	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"github.com/downace/print-server/internal/appconfig"
 	"github.com/downace/print-server/internal/logging"
+	"github.com/downace/print-server/internal/printing"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
+	"github.com/samber/lo"
 	"net/http"
 	"net/netip"
 	"strings"
+	"time"
 )
 
 func methodNotAllowed(writer http.ResponseWriter, _ *http.Request) {
@@ -42,6 +47,16 @@ func responseHeadersMiddleware(headers map[string]string) func(next http.Handler
 	}
 }
 
+// maxBodySizeMiddleware limits request bodies, handlers respond with 413 when the limit is exceeded
+func maxBodySizeMiddleware(size int64) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			request.Body = http.MaxBytesReader(writer, request.Body, size)
+			next.ServeHTTP(writer, request)
+		})
+	}
+}
+
 func checkBasicAuth(request *http.Request, username string, password string) (authorized bool) {
 	authHeader := request.Header.Get("Authorization")
 	if authHeader == "" {
@@ -74,66 +89,289 @@ func basicAuthMiddleware(username string, password string) func(next http.Handle
 	}
 }
 
-func CreateServer(config appconfig.AppConfig) *http.Server {
-	return createServer(
-		netip.AddrPortFrom(netip.MustParseAddr(config.Host), config.Port),
-		config.ResponseHeaders,
-		config.Auth.Enabled,
-		config.Auth.Username,
-		config.Auth.Password,
-	)
+// OpenJobQueue creates job queue backed by job history file. Queue outlives servers,
+// so jobs are not lost when server is restarted
+func OpenJobQueue(config appconfig.AppConfig, backend printing.Backend) (*printing.JobQueue, error) {
+	historyFile, err := appconfig.ResolvePath(lo.CoalesceOrEmpty(config.Jobs.HistoryFile, "jobs.db"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	retention := time.Duration(config.Jobs.RetentionDays) * 24 * time.Hour
+	documentRetention := time.Duration(config.Jobs.DocumentRetentionHours) * time.Hour
+
+	store, err := printing.OpenJobStore(historyFile, retention, documentRetention)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return printing.NewJobQueue(backend, store, config.Jobs.Workers, config.Jobs.QueueSize), nil
+}
+
+const defaultMaxDocumentSizeMB = 100
+
+// maxDocumentSize returns max size in bytes of documents and request bodies received by listeners
+func maxDocumentSize(config appconfig.JobsConfig) int64 {
+	sizeMB := config.MaxDocumentSizeMB
+	if sizeMB <= 0 {
+		sizeMB = defaultMaxDocumentSizeMB
+	}
+	return int64(sizeMB) << 20
+}
+
+// listener is a print protocol endpoint running alongside the HTTP API, e.g. IPP
+type listener interface {
+	// serve blocks until listener is closed, then returns http.ErrServerClosed
+	serve() error
+	close() error
+}
+
+// Renderers are shared by servers and the job queue. They are closed after the queue,
+// since queued jobs keep rendering documents when servers are closed or restarted
+type Renderers struct {
+	UrlPolicy *printing.UrlPolicy
+	Browser   *printing.BrowserPool
+	Office    *printing.OfficeConverter
+}
+
+// NewRenderers doesn't start anything, browser and office are started on first use
+func NewRenderers(config appconfig.AppConfig) *Renderers {
+	urlPolicy := printing.NewUrlPolicy(config.UrlPolicy)
+
+	return &Renderers{
+		UrlPolicy: urlPolicy,
+		Browser:   printing.NewBrowserPool(config.Browser, urlPolicy),
+		Office:    printing.NewOfficeConverter(config.Office),
+	}
+}
+
+// Close closes browser and removes office profiles, waiting for running office conversions
+func (r *Renderers) Close() error {
+	return errors.Join(r.Browser.Close(), r.Office.Close())
+}
+
+// Server is the HTTP API server along with additional listeners enabled in config
+type Server struct {
+	*http.Server
+	listeners []listener
+}
+
+func (s *Server) Close() error {
+	for _, l := range s.listeners {
+		_ = l.close()
+	}
+	return s.Server.Close()
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	for _, l := range s.listeners {
+		_ = l.close()
+	}
+	return s.Server.Shutdown(ctx)
 }
 
-func createServer(
-	addr netip.AddrPort,
-	responseHeaders map[string]string,
-	authEnabled bool,
-	authUsername string,
-	authPassword string,
-) *http.Server {
+func CreateServer(config appconfig.AppConfig, backend printing.Backend, jobs *printing.JobQueue, renderers *Renderers) *Server {
+	host := netip.MustParseAddr(config.Host)
+	templatesDir, err := appconfig.ResolvePath(lo.CoalesceOrEmpty(config.Templates.Directory, "templates"))
+	if err != nil {
+		// Working directory is gone, templates are looked up relative to it anyway
+		templatesDir = config.Templates.Directory
+	}
+	server := &Server{
+		Server: createServer(config, &api{
+			backend:        backend,
+			jobs:           jobs,
+			fonts:          config.Fonts,
+			office:         renderers.Office,
+			rawPrinters:    config.RawPrinters,
+			templates:      printing.NewTemplateRegistry(templatesDir),
+			browser:        renderers.Browser,
+			urlPolicy:      renderers.UrlPolicy,
+			headerFooters:  config.HeaderFooterPresets,
+			urlCredentials: config.UrlCredentials,
+		}),
+	}
+
+	if config.IPPServer.Enabled {
+		server.listeners = append(server.listeners, createIppListener(host, config, backend, jobs))
+	}
+
+	for _, rawPort := range config.RawPorts {
+		server.listeners = append(server.listeners, createRawListener(host, rawPort, maxDocumentSize(config.Jobs), jobs))
+	}
+
+	if config.LPDServer.Enabled {
+		server.listeners = append(server.listeners, createLpdListener(
+			host,
+			config.LPDServer.Port,
+			maxDocumentSize(config.Jobs),
+			config.RawPrinters,
+			backend,
+			jobs,
+		))
+	}
+
+	return server
+}
+
+// createServer routes API requests to handlers, server address and middlewares are taken from config
+func createServer(config appconfig.AppConfig, a *api) *http.Server {
 	router := mux.NewRouter()
 
 	router.
 		Path("/printers").
 		Methods("GET").
-		HandlerFunc(getPrinters)
+		HandlerFunc(a.getPrinters)
+
+	router.
+		Path("/printers/{name}").
+		Methods("GET").
+		HandlerFunc(a.getPrinter)
 
 	router.
 		Path("/print-pdf").
 		Methods("POST").
 		Headers("Content-Type", "application/pdf").
-		HandlerFunc(printPdf)
+		HandlerFunc(a.printPdf)
+
+	router.
+		Path("/print-pdf").
+		Methods("POST").
+		HeadersRegexp("Content-Type", "^application/json").
+		HandlerFunc(a.printPdfJson)
 
 	router.
 		Path("/print-pdf-url").
 		Methods("POST").
-		HandlerFunc(printPdfFromUrl)
+		HandlerFunc(a.printPdfFromUrl)
 
 	router.
 		Path("/print-url").
 		Methods("POST").
-		HandlerFunc(printFromUrl)
+		HandlerFunc(a.printFromUrl)
+
+	router.
+		Path("/print-raw").
+		Methods("POST").
+		HandlerFunc(a.printRaw)
+
+	router.
+		Path("/print-receipt").
+		Methods("POST").
+		Headers("Content-Type", "application/json").
+		HandlerFunc(a.printReceipt)
+
+	router.
+		Path("/print-document").
+		Methods("POST").
+		HandlerFunc(a.printDocument)
+
+	router.
+		Path("/print-html").
+		Methods("POST").
+		HeadersRegexp("Content-Type", "^(text/html|multipart/form-data)").
+		HandlerFunc(a.printHtml)
+
+	router.
+		Path("/print-image").
+		Methods("POST").
+		HeadersRegexp("Content-Type", "^image/").
+		HandlerFunc(a.printImage)
+
+	router.
+		Path("/print-text").
+		Methods("POST").
+		HeadersRegexp("Content-Type", "^text/plain").
+		HandlerFunc(a.printText)
+
+	router.
+		Path("/print-batch").
+		Methods("POST").
+		HeadersRegexp("Content-Type", "^multipart/form-data").
+		HandlerFunc(a.printBatch)
+
+	router.
+		Path("/templates").
+		Methods("GET").
+		HandlerFunc(a.getTemplates)
+
+	router.
+		Path("/print-template/{name}").
+		Methods("POST").
+		Headers("Content-Type", "application/json").
+		HandlerFunc(a.printTemplate)
+
+	router.
+		Path("/render/zpl").
+		Methods("POST").
+		HandlerFunc(a.renderZpl)
+
+	router.
+		Path("/jobs").
+		Methods("GET").
+		HandlerFunc(a.getJobs)
+
+	router.
+		Path("/jobs/{id}").
+		Methods("GET").
+		HandlerFunc(a.getJob)
+
+	router.
+		Path("/jobs/{id}").
+		Methods("DELETE").
+		HandlerFunc(a.cancelJob)
+
+	router.
+		Path("/jobs/{id}/retry").
+		Methods("POST").
+		HandlerFunc(a.retryJob)
 
 	router.MethodNotAllowedHandler = http.HandlerFunc(methodNotAllowed)
 	router.NotFoundHandler = http.HandlerFunc(notFound)
 
 	router.Use(panicHandlerMiddleware)
-	router.Use(responseHeadersMiddleware(responseHeaders))
-	if authEnabled {
-		router.Use(basicAuthMiddleware(authUsername, authPassword))
+	router.Use(responseHeadersMiddleware(config.ResponseHeaders))
+	router.Use(maxBodySizeMiddleware(maxDocumentSize(config.Jobs)))
+	if config.Auth.Enabled {
+		router.Use(basicAuthMiddleware(config.Auth.Username, config.Auth.Password))
 	}
 
 	handler := handlers.CombinedLoggingHandler(logging.HttpLog.Writer(), router)
 
 	return &http.Server{
-		Addr:    addr.String(),
+		Addr:    netip.AddrPortFrom(netip.MustParseAddr(config.Host), config.Port).String(),
 		Handler: handler,
 	}
 }
 
-func RunServer(server *http.Server, config appconfig.AppConfig) error {
-	if config.TLS.Enabled {
-		return server.ListenAndServeTLS(config.TLS.CertFile, config.TLS.KeyFile)
+// RunServer blocks until the server or any of its listeners stops. If one of them fails, the rest are closed
+func RunServer(server *Server, config appconfig.AppConfig) error {
+	errs := make(chan error, len(server.listeners)+1)
+
+	for _, l := range server.listeners {
+		go func() {
+			errs <- l.serve()
+		}()
+	}
+
+	go func() {
+		errs <- runHttpServer(server.Server, config.TLS)
+	}()
+
+	err := <-errs
+
+	if !errors.Is(err, http.ErrServerClosed) {
+		_ = server.Close()
+	}
+
+	return err
+}
+
+func runHttpServer(server *http.Server, tls appconfig.TLSConfig) error {
+	if tls.Enabled {
+		return server.ListenAndServeTLS(tls.CertFile, tls.KeyFile)
 	} else {
 		return server.ListenAndServe()
 	}
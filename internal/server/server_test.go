@@ -0,0 +1,73 @@
+package server
+
+import (
+	"github.com/downace/print-server/internal/appconfig"
+	"github.com/downace/print-server/internal/logging"
+	"github.com/downace/print-server/internal/printing"
+	"github.com/downace/print-server/internal/printing/printingtest"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRenderersOutliveServer(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake converter is a shell script")
+	}
+
+	// Fake soffice records each run and writes PDF to the output directory
+	dir := t.TempDir()
+	runs := filepath.Join(dir, "runs.log")
+	command := filepath.Join(dir, "soffice")
+	script := "#!/bin/sh\necho run >> " + runs + "\nprintf '%%PDF-1.4' > \"$7/document.pdf\"\n"
+
+	if err := os.WriteFile(command, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	logging.HttpLog = log.New(io.Discard, "", 0)
+	config := appconfig.AppConfig{Host: "127.0.0.1", Office: appconfig.OfficeConfig{Command: command}}
+	backend, jobs := newTestJobQueue(t)
+	renderers := NewRenderers(config)
+
+	if err := CreateServer(config, backend, jobs, renderers).Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	submit := func() printing.Job {
+		job, err := jobs.Submit(printing.JobRequest{
+			Printer: "Archive",
+			Source:  printing.JobSourceUpload,
+			Render:  printing.DocumentRenderer([]byte(`{\rtf1}`), renderers.Office),
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return printingtest.WaitFinished(t, jobs, job.ID)
+	}
+
+	// Queue outlives server, so its jobs are still rendered
+	if job := submit(); job.State != printing.JobStateCompleted {
+		t.Errorf("job is %s after server is closed: %s", job.State, job.Error)
+	}
+
+	if err := renderers.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Converter is not started again once renderers are closed
+	if job := submit(); job.State != printing.JobStateFailed {
+		t.Errorf("job is %s after renderers are closed", job.State)
+	}
+
+	logged, _ := os.ReadFile(runs)
+	if count := strings.Count(string(logged), "run"); count != 1 {
+		t.Errorf("converter is started %d times, want 1", count)
+	}
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// tcpMaxConnectionTime limits connection time, e.g. if client sends data too slowly. Idle connections are
+// closed by handlers much earlier
+const tcpMaxConnectionTime = 30 * time.Minute
+
+// tcpListener accepts connections and handles each one in a separate goroutine.
+// It's used by listeners of protocols other than HTTP
+type tcpListener struct {
+	addr    netip.AddrPort
+	handler func(conn net.Conn)
+
+	mu       sync.Mutex
+	listener net.Listener
+	closed   bool
+}
+
+func (l *tcpListener) serve() error {
+	if l.addr.Port() == 0 {
+		return fmt.Errorf("listen port is not set")
+	}
+
+	ln, err := net.Listen("tcp", l.addr.String())
+
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		_ = ln.Close()
+		return http.ErrServerClosed
+	}
+	l.listener = ln
+	l.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+
+		if errors.Is(err, net.ErrClosed) {
+			return http.ErrServerClosed
+		}
+		if err != nil {
+			log.Printf("error accepting connection on %s: %s", l.addr, err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		go l.handle(conn)
+	}
+}
+
+// handle closes connection if it's open for too long and recovers from handler panic,
+// so a bad client can't crash the server or hold connection forever
+func (l *tcpListener) handle(conn net.Conn) {
+	timer := time.AfterFunc(tcpMaxConnectionTime, func() {
+		_ = conn.Close()
+	})
+	defer timer.Stop()
+
+	defer func() {
+		if err := recover(); err != nil {
+			log.Printf("error handling connection on %s: %v\n%s", l.addr, err, debug.Stack())
+			_ = conn.Close()
+		}
+	}()
+
+	l.handler(conn)
+}
+
+func (l *tcpListener) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.closed = true
+	if l.listener != nil {
+		return l.listener.Close()
+	}
+	return nil
+}
+
+// idleTimeoutConn fails reads with os.ErrDeadlineExceeded if client doesn't send anything for timeout
+type idleTimeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c idleTimeoutConn) Read(p []byte) (int, error) {
+	_ = c.SetReadDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Read(p)
+}
@@ -0,0 +1,280 @@
+package zpl
+
+import (
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/code128"
+	"github.com/boombuler/barcode/qr"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+)
+
+var (
+	// Scalable font 0 is bold and condensed, other built-in fonts are monospaced bitmap fonts
+	scalableFont  = mustParseFont(gobold.TTF)
+	monospaceFont = mustParseFont(gomono.TTF)
+)
+
+func mustParseFont(ttf []byte) *opentype.Font {
+	f, err := opentype.Parse(ttf)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+type fontKey struct {
+	name   byte
+	height int
+}
+
+type fontCache map[fontKey]font.Face
+
+// face returns font face with character cell of given height in dots
+func (c fontCache) face(name byte, height int) font.Face {
+	key := fontKey{name: name, height: height}
+
+	if face, ok := c[key]; ok {
+		return face
+	}
+
+	f := monospaceFont
+	if name == '0' {
+		f = scalableFont
+	}
+
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: float64(height), DPI: 72, Hinting: font.HintingFull})
+
+	if err != nil {
+		panic(err)
+	}
+
+	c[key] = face
+	return face
+}
+
+// textScale is horizontal scale of font, so that characters have width set in font command.
+// Width of scalable font equals to its height by default
+func textScale(f field) float64 {
+	if f.fontWidth == 0 || f.fontHeight == 0 {
+		return 1
+	}
+	natural := float64(f.fontHeight)
+	if f.fontName != '0' {
+		// Monospace characters are 0.6 of font size wide
+		natural *= 0.6
+	}
+	return float64(f.fontWidth) / natural
+}
+
+func (r *renderer) drawText(f field, text string) {
+	height := max(1, f.fontHeight)
+	face := r.fonts.face(f.fontName, height)
+	scale := textScale(f)
+	ascent := face.Metrics().Ascent.Ceil()
+
+	baseline := f.y + ascent
+	if f.typeset {
+		baseline = f.y
+	}
+
+	if f.block == nil {
+		r.drawTextLine(face, scale, f.x, baseline, text)
+		return
+	}
+
+	lines := wrapText(face, scale, text, f.block.width, f.block.maxLines)
+
+	for i, line := range lines {
+		width := measureText(face, scale, line)
+		x := f.x
+		switch f.block.justify {
+		case "C":
+			x += (f.block.width - width) / 2
+		case "R":
+			x += f.block.width - width
+		}
+		r.drawTextLine(face, scale, x, baseline+i*(height+f.block.lineSpacing), line)
+	}
+}
+
+func measureText(face font.Face, scale float64, text string) int {
+	return int(float64(font.MeasureString(face, text).Ceil()) * scale)
+}
+
+// wrapText splits text by words to fit width, "\&" is a line break in field blocks
+func wrapText(face font.Face, scale float64, text string, width int, maxLines int) []string {
+	var lines []string
+
+	for _, paragraph := range strings.Split(text, `\&`) {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			candidate := strings.TrimSpace(line + " " + word)
+			if line != "" && measureText(face, scale, candidate) > width {
+				lines = append(lines, line)
+				line = word
+			} else {
+				line = candidate
+			}
+		}
+		lines = append(lines, line)
+	}
+
+	return lines[:min(len(lines), maxLines)]
+}
+
+// drawTextLine draws text in black, scaling it horizontally. Antialiased pixels are rounded
+// to black or white, like on thermal printer
+func (r *renderer) drawTextLine(face font.Face, scale float64, x int, baseline int, text string) {
+	metrics := face.Metrics()
+	width := font.MeasureString(face, text).Ceil()
+	height := metrics.Ascent.Ceil() + metrics.Descent.Ceil()
+
+	// Text beyond the right edge of label is not drawn
+	width = min(width, int(float64(r.img.Bounds().Dx()-x)/scale)+1)
+
+	if width <= 0 || height <= 0 {
+		return
+	}
+
+	mask := image.NewAlpha(image.Rect(0, 0, width, height))
+	drawer := font.Drawer{
+		Dst:  mask,
+		Src:  image.Opaque,
+		Face: face,
+		Dot:  fixed.P(0, metrics.Ascent.Ceil()),
+	}
+	drawer.DrawString(text)
+
+	top := baseline - metrics.Ascent.Ceil()
+	scaledWidth := min(int(float64(width)*scale), r.img.Bounds().Dx()-x)
+
+	for dy := 0; dy < height; dy++ {
+		for dx := 0; dx < scaledWidth; dx++ {
+			if mask.AlphaAt(int(float64(dx)/scale), dy).A >= 128 {
+				r.img.SetGray(x+dx, top+dy, color.Gray{Y: 0})
+			}
+		}
+	}
+}
+
+func (r *renderer) fillRect(x0, y0, x1, y1 int, c color.Gray) {
+	draw.Draw(r.img, image.Rect(x0, y0, x1, y1), image.NewUniform(c), image.Point{}, draw.Src)
+}
+
+func (r *renderer) drawBox(f field) {
+	b := f.box
+	x, y := f.x, f.y
+	if f.typeset {
+		y -= b.height
+	}
+
+	// Box is filled if borders overlap
+	if b.thickness*2 >= b.width || b.thickness*2 >= b.height {
+		r.fillRect(x, y, x+b.width, y+b.height, b.color)
+		return
+	}
+
+	r.fillRect(x, y, x+b.width, y+b.thickness, b.color)
+	r.fillRect(x, y+b.height-b.thickness, x+b.width, y+b.height, b.color)
+	r.fillRect(x, y, x+b.thickness, y+b.height, b.color)
+	r.fillRect(x+b.width-b.thickness, y, x+b.width, y+b.height, b.color)
+}
+
+// drawCode128 ignores subset invocation codes (e.g. >; or >:), the encoder chooses subsets itself
+func (r *renderer) drawCode128(f field, data string) {
+	if len(data) >= 2 && data[0] == '>' && strings.ContainsRune(";:5", rune(data[1])) {
+		data = data[2:]
+	}
+
+	code, err := code128.Encode(data)
+
+	// Printers don't print invalid barcodes either
+	if err != nil {
+		return
+	}
+
+	moduleWidth := r.moduleWidth
+	height := f.barcodeHeight
+	textHeight := 10 * moduleWidth
+	x, y := f.x, f.y
+
+	if f.typeset {
+		y -= height
+	}
+	if f.barcodeText && f.textAbove {
+		y += textHeight
+	}
+
+	r.drawModules(code, x, y, moduleWidth, height)
+
+	if f.barcodeText {
+		face := r.fonts.face('0', textHeight)
+		textX := x + (code.Bounds().Dx()*moduleWidth-measureText(face, 1, data))/2
+		textY := y + height + face.Metrics().Ascent.Ceil()
+		if f.textAbove {
+			textY = y - face.Metrics().Descent.Ceil()
+		}
+		r.drawTextLine(face, 1, textX, textY, data)
+	}
+}
+
+// drawQrCode expects data to start with error correction level and input mode, e.g. QA,https://example.com
+func (r *renderer) drawQrCode(f field, data string) {
+	level := qr.M
+
+	if i := strings.IndexByte(data, ','); i >= 0 && i <= 2 {
+		if i > 0 {
+			switch data[0] {
+			case 'H':
+				level = qr.H
+			case 'Q':
+				level = qr.Q
+			case 'L':
+				level = qr.L
+			}
+		}
+		data = data[i+1:]
+	}
+
+	code, err := qr.Encode(data, level, qr.Auto)
+
+	if err != nil {
+		return
+	}
+
+	size := code.Bounds().Dy() * f.magnification
+	x, y := f.x, f.y
+	if f.typeset {
+		y -= size
+	}
+
+	r.drawModules(code, x, y, f.magnification, size)
+}
+
+// drawModules draws barcode with each module scaled to given width, barcode image is 1 pixel per module
+func (r *renderer) drawModules(code barcode.Barcode, x int, y int, moduleSize int, height int) {
+	bounds := code.Bounds()
+	moduleHeight := max(1, height/bounds.Dy())
+
+	for my := 0; my < bounds.Dy(); my++ {
+		for mx := 0; mx < bounds.Dx(); mx++ {
+			c := color.GrayModel.Convert(code.At(bounds.Min.X+mx, bounds.Min.Y+my)).(color.Gray)
+			if c.Y < 128 {
+				top := y + my*moduleHeight
+				bottom := top + moduleHeight
+				// 1D barcodes are 1 pixel high, so bars take the whole height
+				if bounds.Dy() == 1 {
+					bottom = y + height
+				}
+				r.fillRect(x+mx*moduleSize, top, x+(mx+1)*moduleSize, bottom, color.Gray{Y: 0})
+			}
+		}
+	}
+}
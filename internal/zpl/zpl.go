@@ -0,0 +1,348 @@
+// Package zpl renders labels written in Zebra Programming Language, so they can be printed on regular printers.
+// Only common commands are supported: fields (^FO, ^FT, ^FD, ^FS, ^FB, ^FH), fonts (^A, ^CF),
+// barcodes (^BY, ^BC, ^BQ), boxes (^GB) and label settings (^LH, ^PW, ^LL). Fields are always drawn
+// in normal orientation, other commands are ignored
+package zpl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strconv"
+	"strings"
+)
+
+var ErrNoLabels = errors.New("no labels found, ZPL label starts with ^XA and ends with ^XZ")
+
+// maxLabelPixels limits memory used by a single label, it is more than enough for 8x12 inch label at 600 DPI
+const maxLabelPixels = 1 << 26
+
+// All labels are kept in memory, so their number and total size are limited as well
+const (
+	maxLabels         = 1000
+	maxDocumentPixels = 1 << 28
+)
+
+// IsZpl checks whether data contains ZPL label
+func IsZpl(data []byte) bool {
+	return bytes.Contains(data, []byte("^XA"))
+}
+
+type command struct {
+	code   string
+	params string
+}
+
+// Render draws each label on a separate image of given size in inches, ZPL coordinates are printer dots
+func Render(data []byte, dpi int, width float64, height float64) ([]*image.Gray, error) {
+	var labels []*image.Gray
+	var label []command
+	inLabel := false
+	pixels := 0
+
+	for _, cmd := range parse(data) {
+		switch {
+		case cmd.code == "XA":
+			inLabel = true
+			label = nil
+		case cmd.code == "XZ" && inLabel:
+			inLabel = false
+			if len(labels) >= maxLabels {
+				return nil, fmt.Errorf("document has more than %d labels", maxLabels)
+			}
+			img, err := renderLabel(label, dpi, width, height)
+			if err != nil {
+				return nil, err
+			}
+			pixels += len(img.Pix)
+			if pixels > maxDocumentPixels {
+				return nil, errors.New("labels are too large in total")
+			}
+			labels = append(labels, img)
+		case inLabel:
+			label = append(label, cmd)
+		}
+	}
+
+	if len(labels) == 0 {
+		return nil, ErrNoLabels
+	}
+
+	return labels, nil
+}
+
+// parse splits data into commands. Command code is 2 characters long, except font command ^A,
+// which is followed by font name. Field data ends only with the next caret
+func parse(data []byte) []command {
+	// Line breaks are ignored by printers
+	text := strings.NewReplacer("\r", "", "\n", "").Replace(string(data))
+
+	var commands []command
+
+	for i := 0; i < len(text); {
+		if text[i] != '^' && text[i] != '~' {
+			i++
+			continue
+		}
+
+		start := i + 1
+		codeLength := min(2, len(text)-start)
+		code := strings.ToUpper(text[start : start+codeLength])
+
+		end := start + codeLength
+		for end < len(text) && text[end] != '^' && (text[end] != '~' || code == "FD") {
+			end++
+		}
+
+		// Control commands (e.g. ~DG) are not supported
+		if text[i] == '^' {
+			commands = append(commands, command{code: code, params: text[start+codeLength : end]})
+		}
+
+		i = end
+	}
+
+	return commands
+}
+
+// renderer keeps state of label being drawn
+type renderer struct {
+	img *image.Gray
+	dpi int
+	// Label home, added to field positions
+	homeX, homeY int
+	// Defaults set by ^CF
+	fontName   byte
+	fontHeight int
+	fontWidth  int
+	// Defaults set by ^BY
+	moduleWidth   int
+	barcodeHeight int
+	field         field
+	fonts         fontCache
+}
+
+// field is collected from commands between field origin and ^FS
+type field struct {
+	x, y int
+	// ^FT sets baseline position instead of top left corner
+	typeset    bool
+	fontName   byte
+	fontHeight int
+	fontWidth  int
+	// Empty for text fields
+	kind          string
+	barcodeHeight int
+	barcodeText   bool
+	textAbove     bool
+	magnification int
+	box           box
+	block         *fieldBlock
+	hexIndicator  byte
+	data          string
+}
+
+type box struct {
+	width, height, thickness int
+	color                    color.Gray
+}
+
+type fieldBlock struct {
+	width       int
+	maxLines    int
+	lineSpacing int
+	justify     string
+}
+
+func renderLabel(commands []command, dpi int, width float64, height float64) (*image.Gray, error) {
+	widthDots := int(width * float64(dpi))
+	heightDots := int(height * float64(dpi))
+
+	// Label size set in ZPL overrides requested size
+	for _, cmd := range commands {
+		switch cmd.code {
+		case "PW":
+			widthDots = intParam(splitParams(cmd.params), 0, widthDots)
+		case "LL":
+			heightDots = intParam(splitParams(cmd.params), 0, heightDots)
+		}
+	}
+
+	// Sides are checked separately, so their product can't overflow
+	if widthDots <= 0 || heightDots <= 0 || widthDots > maxLabelPixels/heightDots {
+		return nil, errors.New("label size is out of range")
+	}
+
+	r := renderer{
+		img:           image.NewGray(image.Rect(0, 0, widthDots, heightDots)),
+		dpi:           dpi,
+		fontName:      'A',
+		fontHeight:    9,
+		moduleWidth:   2,
+		barcodeHeight: 10,
+		fonts:         fontCache{},
+	}
+	draw.Draw(r.img, r.img.Bounds(), image.White, image.Point{}, draw.Src)
+	r.resetField()
+
+	for _, cmd := range commands {
+		r.execute(cmd)
+	}
+
+	return r.img, nil
+}
+
+func (r *renderer) resetField() {
+	r.field = field{
+		fontName:   r.fontName,
+		fontHeight: r.fontHeight,
+		fontWidth:  r.fontWidth,
+	}
+}
+
+func (r *renderer) execute(cmd command) {
+	params := splitParams(cmd.params)
+
+	switch {
+	case cmd.code == "FO" || cmd.code == "FT":
+		r.field.x = r.homeX + intParam(params, 0, 0)
+		r.field.y = r.homeY + intParam(params, 1, 0)
+		r.field.typeset = cmd.code == "FT"
+	case cmd.code == "A@":
+		// Fonts by file name are not available, so default font is used
+		r.field.fontName = '0'
+		r.setFieldFontSize(params)
+	case strings.HasPrefix(cmd.code, "A"):
+		r.field.fontName = cmd.code[1]
+		// Orientation goes right after font name, e.g. ^A0N,30,30
+		r.setFieldFontSize(params)
+	case cmd.code == "CF":
+		if len(params) > 0 && params[0] != "" {
+			r.fontName = params[0][0]
+		}
+		r.fontHeight, r.fontWidth = r.clampFontSize(intParam(params, 1, r.fontHeight), intParam(params, 2, r.fontWidth))
+		r.resetField()
+	case cmd.code == "BY":
+		r.moduleWidth = max(1, intParam(params, 0, r.moduleWidth))
+		r.barcodeHeight = max(1, intParam(params, 2, r.barcodeHeight))
+	case cmd.code == "BC":
+		r.field.kind = "code128"
+		r.field.barcodeHeight = max(1, intParam(params, 1, r.barcodeHeight))
+		r.field.barcodeText = stringParam(params, 2, "Y") == "Y"
+		r.field.textAbove = stringParam(params, 3, "N") == "Y"
+	case cmd.code == "BQ":
+		r.field.kind = "qr"
+		r.field.magnification = max(1, intParam(params, 2, max(1, r.dpi/100)))
+	case cmd.code == "GB":
+		thickness := max(1, intParam(params, 2, 1))
+		r.field.kind = "box"
+		r.field.box = box{
+			width:     max(thickness, intParam(params, 0, thickness)),
+			height:    max(thickness, intParam(params, 1, thickness)),
+			thickness: thickness,
+			color:     color.Gray{Y: 0},
+		}
+		if stringParam(params, 3, "B") == "W" {
+			r.field.box.color = color.Gray{Y: 255}
+		}
+	case cmd.code == "FB":
+		r.field.block = &fieldBlock{
+			width:       intParam(params, 0, 0),
+			maxLines:    max(1, intParam(params, 1, 1)),
+			lineSpacing: intParam(params, 2, 0),
+			justify:     stringParam(params, 3, "L"),
+		}
+	case cmd.code == "FH":
+		r.field.hexIndicator = '_'
+		if cmd.params != "" {
+			r.field.hexIndicator = cmd.params[0]
+		}
+	case cmd.code == "FD":
+		r.field.data += cmd.params
+	case cmd.code == "FS":
+		r.drawField()
+		r.resetField()
+	case cmd.code == "LH":
+		r.homeX = intParam(params, 0, 0)
+		r.homeY = intParam(params, 1, 0)
+	}
+}
+
+func (r *renderer) setFieldFontSize(params []string) {
+	r.field.fontHeight, r.field.fontWidth = r.clampFontSize(intParam(params, 1, r.fontHeight), intParam(params, 2, 0))
+}
+
+// clampFontSize limits font size to label size, larger characters wouldn't fit on the label anyway
+func (r *renderer) clampFontSize(height int, width int) (int, int) {
+	bounds := r.img.Bounds()
+	return min(height, bounds.Dy()), min(width, bounds.Dx())
+}
+
+func (r *renderer) drawField() {
+	f := r.field
+	data := f.data
+
+	if f.hexIndicator != 0 {
+		data = decodeHex(data, f.hexIndicator)
+	}
+
+	switch f.kind {
+	case "code128":
+		r.drawCode128(f, data)
+	case "qr":
+		r.drawQrCode(f, data)
+	case "box":
+		r.drawBox(f)
+	default:
+		if data != "" {
+			r.drawText(f, data)
+		}
+	}
+}
+
+// decodeHex replaces hex codes following indicator with characters, e.g. _5E is ^
+func decodeHex(data string, indicator byte) string {
+	var result []byte
+
+	for i := 0; i < len(data); i++ {
+		if data[i] == indicator && i+2 < len(data) {
+			if b, err := strconv.ParseUint(data[i+1:i+3], 16, 8); err == nil {
+				result = append(result, byte(b))
+				i += 2
+				continue
+			}
+		}
+		result = append(result, data[i])
+	}
+
+	return string(result)
+}
+
+func splitParams(params string) []string {
+	return strings.Split(params, ",")
+}
+
+// intParam returns default value if parameter is missing or invalid, like printers do
+func intParam(params []string, i int, defaultValue int) int {
+	if i >= len(params) {
+		return defaultValue
+	}
+
+	value, err := strconv.Atoi(strings.TrimSpace(params[i]))
+
+	if err != nil || value < 0 {
+		return defaultValue
+	}
+
+	return value
+}
+
+func stringParam(params []string, i int, defaultValue string) string {
+	if i >= len(params) || strings.TrimSpace(params[i]) == "" {
+		return defaultValue
+	}
+	return strings.ToUpper(strings.TrimSpace(params[i]))
+}
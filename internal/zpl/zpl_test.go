@@ -0,0 +1,110 @@
+package zpl
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRenderLabelSize(t *testing.T) {
+	tests := []struct {
+		name       string
+		zpl        string
+		wantWidth  int
+		wantHeight int
+		wantErr    bool
+	}{
+		{name: "requested size", zpl: "^XA^FO10,10^FDtest^FS^XZ", wantWidth: 406, wantHeight: 203},
+		{name: "size from ZPL", zpl: "^XA^PW300^LL100^XZ", wantWidth: 300, wantHeight: 100},
+		{name: "too large", zpl: "^XA^PW100000^LL100000^XZ", wantErr: true},
+		// Product of sides overflows int
+		{name: "overflow", zpl: "^XA^PW4294967296^LL4294967296^XZ", wantErr: true},
+		{name: "zero width", zpl: "^XA^PW0^XZ", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels, err := Render([]byte(tt.zpl), 203, 2, 1)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			bounds := labels[0].Bounds()
+			if bounds.Dx() != tt.wantWidth || bounds.Dy() != tt.wantHeight {
+				t.Errorf("label size is %dx%d, want %dx%d", bounds.Dx(), bounds.Dy(), tt.wantWidth, tt.wantHeight)
+			}
+		})
+	}
+}
+
+func TestRenderHugeFont(t *testing.T) {
+	tests := []string{
+		"^XA^A0N,1000000000,1000000000^FO0,0^FDtext^FS^XZ",
+		"^XA^CF0,1000000000,1000000000^FO0,0^FDtext^FS^XZ",
+		"^XA^AAN,1,1000000000^FO0,0^FDlong text is cut at the label edge^FS^XZ",
+		"^XA^FO0,0^FB100000,3^A0N,100000,100000^FDwrapped text^FS^XZ",
+	}
+
+	for _, zpl := range tests {
+		t.Run(zpl, func(t *testing.T) {
+			if _, err := Render([]byte(zpl), 203, 2, 1); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestRenderNoLabels(t *testing.T) {
+	if _, err := Render([]byte("^FDtext^FS"), 203, 2, 1); !errors.Is(err, ErrNoLabels) {
+		t.Errorf("expected ErrNoLabels, got %v", err)
+	}
+}
+
+func TestRenderDocumentLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		zpl     string
+		wantErr bool
+	}{
+		{name: "max labels", zpl: strings.Repeat("^XA^XZ", maxLabels)},
+		{name: "too many labels", zpl: strings.Repeat("^XA^XZ", maxLabels+1), wantErr: true},
+		// Each label is 8000x8000 dots, just under the label limit
+		{name: "too large in total", zpl: strings.Repeat("^XA^PW8000^LL8000^XZ", 5), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Render([]byte(tt.zpl), 203, 0.1, 0.1)
+
+			if tt.wantErr && err == nil {
+				t.Error("expected error")
+			} else if !tt.wantErr && err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestDecodeHex(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{data: "_5E_7E", want: "^~"},
+		{data: "a_2", want: "a_2"},
+		{data: "_zz", want: "_zz"},
+	}
+
+	for _, tt := range tests {
+		if got := decodeHex(tt.data, '_'); got != tt.want {
+			t.Errorf("decodeHex(%q) = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}